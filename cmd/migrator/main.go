@@ -1,49 +1,213 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"strconv"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/service/apps"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
 )
 
+const usage = `usage: migrator [flags] [command]
+
+commands:
+  up         apply every pending migration (default)
+  down N     roll back N migrations
+  goto V     migrate up or down to version V
+  version    print the current version
+  force V    set version V without migrating and clear the dirty flag
+  create-app NAME
+             register an app and print its id, client id and secret, for
+             the first app, before any admin can call CreateApp
+
+flags:
+`
+
 func main() {
-	var storagePath,
+	var driver,
+		storagePath,
 		migrationsPath string
 
-	flag.StringVar(&storagePath, "storage-path", "", "path to storage")
-	flag.StringVar(&migrationsPath, "migrations-path", "", "path to migrations")
+	flag.StringVar(&driver, "driver", storage.DriverSQLite, "storage driver, sqlite or postgres")
+	flag.StringVar(&storagePath, "storage-path", "", "path to storage, connection url for postgres")
+	flag.StringVar(&migrationsPath, "migrations-path", "", "path to migrations, the embedded ones if empty")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
-	validateFlags(storagePath, migrationsPath)
+	validateFlags(storagePath)
+
+	if flag.Arg(0) == "create-app" {
+		err := createApp(driver, storagePath, flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	mInstance, err := migrate.New(
-		"file://"+migrationsPath,
-		"sqlite3://"+storagePath,
-	)
+		return
+	}
+
+	mInstance, err := newMigrator(driver, storagePath, migrationsPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer mInstance.Close()
 
-	err = mInstance.Up()
+	err = run(mInstance, flag.Args())
 	if err != nil {
 		if errors.Is(err, migrate.ErrNoChange) {
 			log.Println("no changes")
-		} else {
-			log.Fatal(err)
+
+			return
 		}
+
+		log.Fatal(err)
 	}
 }
 
-func validateFlags(storagePath, migrationsPath string) {
-	if storagePath == "" {
-		panic("storage path should be not empty")
+func run(mInstance *migrate.Migrate, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return mInstance.Up() //nolint:wrapcheck
+	case "down":
+		steps, err := intArg(args)
+		if err != nil {
+			return err
+		}
+
+		if steps <= 0 {
+			return fmt.Errorf("down: N should be positive, got %d", steps)
+		}
+
+		return mInstance.Steps(-steps) //nolint:wrapcheck
+	case "goto":
+		version, err := intArg(args)
+		if err != nil {
+			return err
+		}
+
+		if version < 0 {
+			return fmt.Errorf("goto: V should not be negative, got %d", version)
+		}
+
+		return mInstance.Migrate(uint(version)) //nolint:wrapcheck
+	case "version":
+		version, dirty, err := mInstance.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			log.Println("no migrations applied")
+
+			return nil
+		}
+
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		log.Printf("version %d, dirty %t", version, dirty)
+
+		return nil
+	case "force":
+		// -1 forgets every applied migration.
+		version, err := intArg(args)
+		if err != nil {
+			return err
+		}
+
+		return mInstance.Force(version) //nolint:wrapcheck
+	default:
+		flag.Usage()
+		os.Exit(2)
 	}
 
+	return nil
+}
+
+// createApp registers an app in a migrated database. Its generated id does not
+// collide with apps inserted by migrations.
+func createApp(driver, storagePath string, args []string) error {
+	if len(args) != 2 { //nolint:mnd
+		return fmt.Errorf("%s: expected a name", args[0])
+	}
+
+	err := storage.CheckSchema(driver, storagePath)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	strg, err := storage.New(slog.Default(), driver, storagePath, nil)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	secret, secretHash, err := apps.NewClientSecret()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	app, err := strg.SaveApp(context.Background(), &entity.App{
+		Name:             args[1],
+		ClientSecretHash: secretHash,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	// the secret is not stored, it is only shown here.
+	fmt.Printf("app id: %d\nclient id: %s\nclient secret: %s\n", app.ID, app.ClientID, secret)
+
+	return nil
+}
+
+func intArg(args []string) (int, error) {
+	if len(args) != 2 {
+		return 0, fmt.Errorf("%s: expected one argument", args[0])
+	}
+
+	value, err := strconv.Atoi(args[1])
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	return value, nil
+}
+
+func newMigrator(driver, storagePath, migrationsPath string) (*migrate.Migrate, error) {
 	if migrationsPath == "" {
-		panic("migrations path should be not empty")
+		return storage.NewMigrator(driver, storagePath) //nolint:wrapcheck
+	}
+
+	databaseURL := storagePath
+
+	switch driver {
+	case storage.DriverSQLite:
+		databaseURL = "sqlite3://" + storagePath
+	case storage.DriverPostgres:
+	default:
+		panic("storage driver should be sqlite or postgres")
+	}
+
+	return migrate.New("file://"+migrationsPath, databaseURL) //nolint:wrapcheck
+}
+
+func validateFlags(storagePath string) {
+	if storagePath == "" {
+		panic("storage path should be not empty")
 	}
 }
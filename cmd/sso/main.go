@@ -27,22 +27,33 @@ func main() {
 	logg.Info("logger setuped", slog.String("env", cfg.Env))
 
 	logg.Info("current secret key", slog.Int("length", len(cfg.SecretKey)))
+	logg.Info("access token signing method", slog.String("alg", cfg.SigningMethod))
 
 	application, err := setupApp(logg, cfg)
 	if err != nil{
-		logg.Debug("failed to create app instance", sl.Err(err))
+		logg.Error("failed to create app instance", sl.Err(err))
 		os.Exit(1)
 	}
 
 	go application.GRPCServer.MustRun()
 
+	if application.HTTPServer != nil {
+		go application.HTTPServer.MustRun()
+	}
+
+	if application.MetricsServer != nil {
+		go application.MetricsServer.MustRun()
+	}
+
+	application.RunBackground()
+
 	// graceful stop
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
 	<-stop
 
-	application.GRPCServer.GracefulStop()
+	application.GracefulStop()
 	logg.Info("sso server stopped")
 }
 
@@ -1,64 +1,385 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+
 	grpcApp "github.com/aspirin100/gRPC-SSO/internal/app/grpc"
+	httpApp "github.com/aspirin100/gRPC-SSO/internal/app/http"
 	"github.com/aspirin100/gRPC-SSO/internal/config"
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	httpAuth "github.com/aspirin100/gRPC-SSO/internal/http/auth"
+	"github.com/aspirin100/gRPC-SSO/internal/passwords"
+	"github.com/aspirin100/gRPC-SSO/internal/service/apps"
 	"github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	"github.com/aspirin100/gRPC-SSO/internal/service/janitor"
 	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/storage/memory"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
 )
 
 type App struct {
 	GRPCServer *grpcApp.App
+	HTTPServer *httpApp.App // nil when http server is disabled
+	// MetricsServer publishes /debug/vars, nil when disabled.
+	MetricsServer *httpApp.App
+
+	logg           *slog.Logger
+	janitor        *janitor.Janitor // nil when disabled
+	stopBackground context.CancelFunc
+	background     sync.WaitGroup
+}
+
+// appStorage is what the services need from a storage backend.
+type appStorage interface {
+	auth.AuthManager
+	apps.AppManager
+	janitor.SessionPurger
+	HashLegacyRefreshTokens(ctx context.Context) (int, error)
 }
 
+// demoAppName is the app registered on startup with the memory storage,
+// which has no other way to get one.
+const demoAppName = "demo"
+
 type AppConfig struct {
-	host        string
-	port        int
-	storagePath string
-	refreshTTL  time.Duration
-	accessTTL   time.Duration
-	secretKey   string
-	reflection  bool
+	host           string
+	port           int
+	clientIPKey    string
+	storageDriver  string
+	storagePath    string
+	migrateOnStart bool
+	refreshTTL     time.Duration
+	accessTTL      time.Duration
+	issuer         string
+	legacyClaims   bool
+	secretKey      string
+	tokenHashKey   string
+	signingMethod  string
+	privateKeyPath string
+	keyRotation    config.KeyRotation
+	janitor        config.JanitorConfig
+	loginThrottle  config.LoginThrottle
+	passwordHash   config.PasswordHash
+	reflection     bool
+	httpEnabled    bool
+	httpHost       string
+	httpPort       int
+	httpIPHeader   string // set by trustedProxies to the end user's address
+	trustedProxies []string
+	metricsEnabled bool
+	metricsHost    string
+	metricsPort    int
+	// device flow verification page, empty if it is not served.
+	verificationURI string
 }
 
 func New(
 	logg *slog.Logger,
 	cfg *AppConfig,
 ) (*App, error) {
-	storage, err := storage.New(logg, cfg.storagePath)
+	storage, err := newStorage(logg, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct storage: %w", err)
 	}
 
+	hashed, err := storage.HashLegacyRefreshTokens(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash stored refresh tokens: %w", err)
+	}
+
+	if hashed > 0 {
+		logg.Info("stored refresh tokens hashed", slog.Int("count", hashed))
+	}
+
+	keyRing, err := newKeyRing(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	hashParams := passwords.DefaultArgon2idParams
+	hashParams.Memory = cfg.passwordHash.Memory
+	hashParams.Iterations = cfg.passwordHash.Iterations
+	hashParams.Parallelism = cfg.passwordHash.Parallelism
+
 	// service layer constructor
 	authService := auth.New(
 		logg,
 		storage,
-		cfg.accessTTL, cfg.refreshTTL,
-		cfg.secretKey)
+		keyRing,
+		passwords.NewArgon2id(hashParams, cfg.passwordHash.MaxConcurrent),
+		auth.TokenConfig{
+			AccessTTL:    cfg.accessTTL,
+			RefreshTTL:   cfg.refreshTTL,
+			Issuer:       cfg.issuer,
+			LegacyClaims: cfg.legacyClaims,
+
+			VerificationURI: cfg.verificationURI,
+			LoginThrottle: auth.LoginThrottleConfig{
+				Enabled:          cfg.loginThrottle.Enabled,
+				FreeFailures:     cfg.loginThrottle.FreeFailures,
+				IPFreeFailures:   cfg.loginThrottle.IPFreeFailures,
+				BackoffBase:      cfg.loginThrottle.BackoffBase,
+				BackoffMax:       cfg.loginThrottle.BackoffMax,
+				AccountThreshold: cfg.loginThrottle.AccountThreshold,
+				IPThreshold:      cfg.loginThrottle.IPThreshold,
+				Lockout:          cfg.loginThrottle.Lockout,
+			},
+		})
+
+	appsService := apps.New(logg, storage, authService, keyRing.Retention())
 
 	// business logic layer constructor
 	grpcApplication := grpcApp.New(logg,
-		authService, cfg.host, cfg.port, cfg.reflection)
+		authService, appsService, cfg.host, cfg.port, cfg.clientIPKey, cfg.reflection)
 
-
-	return &App{
+	application := &App{
 		GRPCServer: grpcApplication,
-	}, nil
+		logg:       logg,
+	}
+
+	if cfg.janitor.Interval > 0 {
+		application.janitor = janitor.New(logg, storage, janitor.Config{
+			Interval:  cfg.janitor.Interval,
+			Retention: cfg.janitor.Retention,
+			BatchSize: cfg.janitor.BatchSize,
+		})
+	}
+
+	if cfg.httpEnabled {
+		clientIP, err := newClientIPConfig(cfg.httpIPHeader, cfg.trustedProxies)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http client address config: %w", err)
+		}
+
+		application.HTTPServer = httpApp.New(logg,
+			authService, clientIP, cfg.httpHost, cfg.httpPort)
+	}
+
+	if cfg.metricsEnabled {
+		application.MetricsServer = httpApp.NewMetrics(logg, cfg.metricsHost, cfg.metricsPort)
+	}
+
+	return application, nil
+}
+
+// RunBackground starts periodic jobs, they are stopped by GracefulStop.
+func (a *App) RunBackground() {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopBackground = cancel
+
+	if a.janitor != nil {
+		a.background.Add(1)
+
+		go func() {
+			defer a.background.Done()
+
+			a.janitor.Run(ctx)
+		}()
+	}
+}
+
+// GracefulStop stops servers and background jobs.
+func (a *App) GracefulStop() {
+	if a.stopBackground != nil {
+		a.stopBackground()
+		a.background.Wait()
+	}
+
+	a.GRPCServer.GracefulStop()
+
+	if a.HTTPServer != nil {
+		a.HTTPServer.GracefulStop()
+	}
+
+	if a.MetricsServer != nil {
+		a.MetricsServer.GracefulStop()
+	}
+}
+
+func newStorage(logg *slog.Logger, cfg *AppConfig) (appStorage, error) {
+	if cfg.storageDriver != storage.DriverMemory {
+		err := prepareSchema(logg, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return storage.New(logg, cfg.storageDriver, cfg.storagePath, []byte(cfg.tokenHashKey)) //nolint:wrapcheck
+	}
+
+	logg.Warn("memory storage is used, data is lost on exit")
+
+	strg := memory.New()
+
+	app, err := strg.SaveApp(context.Background(), &entity.App{Name: demoAppName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register demo app: %w", err)
+	}
+
+	logg.Info("demo app registered",
+		slog.Int("appID", int(app.ID)),
+		slog.String("clientID", app.ClientID))
+
+	return strg, nil
+}
+
+// prepareSchema migrates the database if configured and checks it has the
+// schema version of the binary.
+func prepareSchema(logg *slog.Logger, cfg *AppConfig) error {
+	if cfg.migrateOnStart {
+		err := storage.MigrateUp(cfg.storageDriver, cfg.storagePath)
+		if err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+
+	err := storage.CheckSchema(cfg.storageDriver, cfg.storagePath)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	version, err := storage.SchemaVersion(cfg.storageDriver)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	logg.Info("database schema checked", slog.Uint64("version", uint64(version)))
+
+	return nil
+}
+
+func newKeyRing(cfg *AppConfig) (*tokens.KeyRing, error) {
+	current, err := tokens.LoadSigningKey(cfg.signingMethod,
+		cfg.privateKeyPath, cfg.secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("current key: %w", err)
+	}
+
+	previous := make([]*tokens.SigningKey, 0,
+		len(cfg.keyRotation.PreviousKeyPaths)+len(cfg.keyRotation.PreviousSecretKeys))
+
+	for _, path := range cfg.keyRotation.PreviousKeyPaths {
+		key, err := tokens.LoadVerificationKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("previous key %s: %w", path, err)
+		}
+
+		previous = append(previous, key)
+	}
+
+	for _, secret := range cfg.keyRotation.PreviousSecretKeys {
+		key, err := tokens.NewVerificationSecretKey(secret)
+		if err != nil {
+			return nil, fmt.Errorf("previous secret key: %w", err)
+		}
+
+		previous = append(previous, key)
+	}
+
+	// tokens signed with a retired key must be expired, so keep keys for the longest token TTL.
+	retention := cfg.keyRotation.Retention
+	if retention < cfg.accessTTL {
+		retention = cfg.accessTTL
+	}
+
+	ring := tokens.NewKeyRing(current, retention, previous...)
+
+	for _, scheduled := range cfg.keyRotation.Scheduled {
+		key, err := loadScheduledKey(scheduled)
+		if err != nil {
+			return nil, fmt.Errorf("scheduled key %s: %w", scheduled.KeyPath, err)
+		}
+
+		ring.Schedule(key, scheduled.ActivateAt)
+	}
+
+	return ring, nil
+}
+
+// newClientIPConfig parses the trusted proxies, single addresses are ranges
+// of one.
+func newClientIPConfig(header string, trustedProxies []string) (httpAuth.ClientIPConfig, error) {
+	clientIP := httpAuth.ClientIPConfig{
+		Header:         header,
+		TrustedProxies: make([]netip.Prefix, 0, len(trustedProxies)),
+	}
+
+	for _, proxy := range trustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return clientIP, fmt.Errorf("trusted proxy %q: %w", proxy, err)
+			}
+
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		clientIP.TrustedProxies = append(clientIP.TrustedProxies, prefix.Masked())
+	}
+
+	return clientIP, nil
+}
+
+// loadScheduledKey reads the private key of a scheduled key, or the secret of
+// HMAC methods, which is not safe to put in the config file itself.
+func loadScheduledKey(scheduled config.ScheduledKey) (*tokens.SigningKey, error) {
+	if _, ok := jwt.GetSigningMethod(scheduled.SigningMethod).(*jwt.SigningMethodHMAC); !ok {
+		return tokens.LoadSigningKey(scheduled.SigningMethod, scheduled.KeyPath, "") //nolint:wrapcheck
+	}
+
+	secret, err := os.ReadFile(scheduled.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret key: %w", err)
+	}
+
+	return tokens.LoadSigningKey(scheduled.SigningMethod, "", strings.TrimSpace(string(secret))) //nolint:wrapcheck
 }
 
 func NewAppConfig(cfg *config.Config, reflection bool) *AppConfig {
 	appCfg := &AppConfig{
-		port:        cfg.GRPC.Port,
-		storagePath: cfg.StoragePath,
-		refreshTTL:  cfg.RefreshTTL,
-		accessTTL:   cfg.AccessTTL,
-		secretKey:   cfg.SecretKey,
-		reflection:  reflection,
+		port:           cfg.GRPC.Port,
+		clientIPKey:    cfg.GRPC.ClientIPMetadataKey,
+		storageDriver:  cfg.Storage.Driver,
+		storagePath:    cfg.StoragePath,
+		migrateOnStart: cfg.Storage.MigrateOnStart,
+		refreshTTL:     cfg.RefreshTTL,
+		accessTTL:      cfg.AccessTTL,
+		issuer:         cfg.Issuer,
+		legacyClaims:   cfg.LegacyClaims,
+		secretKey:      cfg.SecretKey,
+		tokenHashKey:   cfg.TokenHashKey,
+		signingMethod:  cfg.SigningMethod,
+		privateKeyPath: cfg.PrivateKeyPath,
+		keyRotation:    cfg.KeyRotation,
+		janitor:        cfg.Janitor,
+		loginThrottle:  cfg.LoginThrottle,
+		passwordHash:   cfg.PasswordHash,
+		reflection:     reflection,
+		httpEnabled:    cfg.HTTP.Enabled,
+		httpHost:       cfg.HTTP.Host,
+		httpPort:       cfg.HTTP.Port,
+		httpIPHeader:   cfg.HTTP.ClientIPHeader,
+		trustedProxies: cfg.HTTP.TrustedProxies,
+		metricsEnabled: cfg.Metrics.Enabled,
+		metricsHost:    cfg.Metrics.Host,
+		metricsPort:    cfg.Metrics.Port,
+	}
+
+	if appCfg.tokenHashKey == "" {
+		appCfg.tokenHashKey = cfg.SecretKey
+	}
+
+	if cfg.HTTP.Enabled && cfg.HTTP.PublicURL != "" {
+		appCfg.verificationURI = strings.TrimSuffix(cfg.HTTP.PublicURL, "/") + httpAuth.DevicePath
 	}
 
 	return appCfg
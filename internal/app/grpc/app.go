@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"net"
 
+	grpcApps "github.com/aspirin100/gRPC-SSO/internal/grpc/apps"
 	grpcAuth "github.com/aspirin100/gRPC-SSO/internal/grpc/auth"
 
 	"google.golang.org/grpc"
@@ -21,11 +22,14 @@ type App struct {
 func New(
 	logg *slog.Logger,
 	authService grpcAuth.Auth,
+	appsService grpcApps.Apps,
 	host string, port int,
+	clientIPKey string,
 	enableReflection bool) *App {
 	gRPCServer := grpc.NewServer()
 
-	grpcAuth.RegisterAuthServer(gRPCServer, authService)
+	grpcAuth.RegisterAuthServer(gRPCServer, authService, clientIPKey)
+	grpcApps.RegisterAppAdminServer(gRPCServer, appsService)
 
 	if enableReflection {
 		reflection.Register(gRPCServer)
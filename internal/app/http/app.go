@@ -0,0 +1,98 @@
+package httpApp //nolint:stylecheck
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	httpAuth "github.com/aspirin100/gRPC-SSO/internal/http/auth"
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 30 * time.Second
+)
+
+type App struct {
+	logg       *slog.Logger
+	name       string // in logs, http or metrics
+	httpServer *http.Server
+}
+
+func New(
+	logg *slog.Logger,
+	authService httpAuth.Auth,
+	clientIP httpAuth.ClientIPConfig,
+	host string, port int) *App {
+	mux := http.NewServeMux()
+
+	httpAuth.RegisterAuthHandlers(mux, logg, authService, clientIP)
+
+	return newApp(logg, "http", mux, host, port)
+}
+
+// NewMetrics returns a server publishing expvar metrics on /debug/vars. It is
+// kept off the public server, bind it to an address only operators reach.
+func NewMetrics(logg *slog.Logger, host string, port int) *App {
+	mux := http.NewServeMux()
+
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return newApp(logg, "metrics", mux, host, port)
+}
+
+func newApp(logg *slog.Logger, name string, handler http.Handler, host string, port int) *App {
+	return &App{
+		logg: logg,
+		name: name,
+		httpServer: &http.Server{
+			Addr:              net.JoinHostPort(host, strconv.Itoa(port)),
+			Handler:           handler,
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+	}
+}
+
+func (a *App) MustRun() {
+	err := a.Run()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "httpApp.Run"
+	logg := a.logg.With(slog.String("op", op))
+
+	listener, err := net.Listen("tcp", a.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("%s:%w", op, err)
+	}
+
+	logg.Info(a.name+" server is running",
+		slog.String("addr", listener.Addr().String()))
+
+	err = a.httpServer.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to run %s server: %w", a.name, err)
+	}
+
+	return nil
+}
+
+func (a *App) GracefulStop() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := a.httpServer.Shutdown(ctx)
+	if err != nil {
+		a.logg.Warn(a.name+" server shutdown error", sl.Err(err))
+	}
+}
@@ -16,22 +16,121 @@ var (
 )
 
 type Config struct {
-	Env         string        `yaml:"env" env:"ENV" env-default:"local"`
-	StoragePath string        `yaml:"storagePath" env:"STORAGE_PATH" env-required:"true"`
-	AccessTTL   time.Duration `yaml:"accessTokenTTL" env:"ACCESS_TTL" env-default:"60m"`      //nolint:tagliatelle
-	RefreshTTL  time.Duration `yaml:"refreshTokenTTL" env:"REFRESH_TTL" env-default:"43200m"` //nolint:tagliatelle
-	GRPC        GRPCConfig    `yaml:"grpc" env:"GRPC"`
-	SecretKey   string        `env:"SECRET_KEY" env-required:"true"` // not safe to save in config file.
+	Env            string        `yaml:"env" env:"ENV" env-default:"local"`
+	Storage        StorageConfig `yaml:"storage"`
+	StoragePath    string        `yaml:"storagePath" env:"STORAGE_PATH" env-required:"true"`     // sqlite file or postgres url, unused by memory
+	AccessTTL      time.Duration `yaml:"accessTokenTTL" env:"ACCESS_TTL" env-default:"60m"`      //nolint:tagliatelle
+	RefreshTTL     time.Duration `yaml:"refreshTokenTTL" env:"REFRESH_TTL" env-default:"43200m"` //nolint:tagliatelle
+	Issuer         string        `yaml:"issuer" env:"ISSUER" env-default:"sso"`
+	LegacyClaims   bool          `yaml:"legacyClaims" env:"LEGACY_CLAIMS" env-default:"false"` // appID, userID, expiresAt
+	SigningMethod  string        `yaml:"signingMethod" env:"SIGNING_METHOD" env-default:"HS256"`
+	PrivateKeyPath string        `yaml:"privateKeyPath" env:"PRIVATE_KEY_PATH"` // PEM, required for RS*, PS*, ES*, EdDSA.
+	KeyRotation    KeyRotation   `yaml:"keyRotation"`
+	Janitor        JanitorConfig `yaml:"janitor"`
+	LoginThrottle  LoginThrottle `yaml:"loginThrottle"`
+	PasswordHash   PasswordHash  `yaml:"passwordHash"`
+	GRPC           GRPCConfig    `yaml:"grpc" env:"GRPC"`
+	HTTP           HTTPConfig    `yaml:"http" env:"HTTP"`
+	Metrics        MetricsConfig `yaml:"metrics"`
+	SecretKey      string        `env:"SECRET_KEY" env-required:"true"` // not safe to save in config file.
+	// HMAC key of refresh tokens stored in the database, SecretKey if empty.
+	// Changing it invalidates every refresh session.
+	TokenHashKey string `env:"TOKEN_HASH_KEY"`
+}
+
+// StorageConfig selects the database, sqlite or postgres. Each needs its own
+// migrations. memory keeps everything in process memory, for demos.
+type StorageConfig struct {
+	Driver string `yaml:"driver" env:"STORAGE_DRIVER" env-default:"sqlite"`
+	// apply pending migrations on startup, also set by the --migrate-on-start flag.
+	// Otherwise the service refuses to start on a database of another schema version.
+	MigrateOnStart bool `yaml:"migrateOnStart" env:"MIGRATE_ON_START" env-default:"false"`
 }
 
 type GRPCConfig struct {
 	Host    string        `yaml:"host" env:"HOST" env-default:"localhost"`
 	Port    int           `yaml:"port" env:"PORT" env-default:"8000"`
 	Timeout time.Duration `yaml:"timeout" env:"TIMEOUT" env-default:"300m"`
+	// metadata key the calling backend sets to the end user's address, e.g.
+	// x-client-ip. Logins are not throttled per address over grpc without it.
+	ClientIPMetadataKey string `yaml:"clientIPMetadataKey" env:"GRPC_CLIENT_IP_METADATA_KEY"`
+}
+
+// KeyRotation lists keys that signed tokens before the current one. They keep
+// verifying for Retention (AccessTTL by default) after startup. Scheduled keys
+// take over signing at their activation time, the key before keeps verifying
+// for Retention after it.
+type KeyRotation struct {
+	Retention          time.Duration  `yaml:"retention" env:"KEY_RETENTION"`
+	PreviousKeyPaths   []string       `yaml:"previousKeyPaths" env:"PREVIOUS_KEY_PATHS"`
+	PreviousSecretKeys []string       `env:"PREVIOUS_SECRET_KEYS"` // not safe to save in config file.
+	Scheduled          []ScheduledKey `yaml:"scheduled"`
+}
+
+// ScheduledKey signs tokens from ActivateAt on.
+type ScheduledKey struct {
+	SigningMethod string    `yaml:"signingMethod"`
+	KeyPath       string    `yaml:"keyPath"` // PEM private key, or a file holding the secret of HMAC methods.
+	ActivateAt    time.Time `yaml:"activateAt"`
+}
+
+// JanitorConfig schedules deleting refresh sessions used or expired longer
+// than Retention ago. Replaying a token deleted by it no longer revokes its family.
+type JanitorConfig struct {
+	Interval  time.Duration `yaml:"interval" env:"JANITOR_INTERVAL" env-default:"1h"` // 0 disables the janitor.
+	Retention time.Duration `yaml:"retention" env:"JANITOR_RETENTION" env-default:"168h"`
+	BatchSize int           `yaml:"batchSize" env:"JANITOR_BATCH_SIZE" env-default:"1000"`
+}
+
+// LoginThrottle backs off failed password logins per account and per client
+// address, doubling the wait from BackoffBase after FreeFailures (IPFreeFailures
+// for addresses), and locks them out for Lockout at the thresholds.
+type LoginThrottle struct {
+	Enabled          bool          `yaml:"enabled" env:"LOGIN_THROTTLE_ENABLED" env-default:"true"`
+	FreeFailures     int           `yaml:"freeFailures" env:"LOGIN_FREE_FAILURES" env-default:"3"`
+	IPFreeFailures   int           `yaml:"ipFreeFailures" env:"LOGIN_IP_FREE_FAILURES" env-default:"20"`
+	BackoffBase      time.Duration `yaml:"backoffBase" env:"LOGIN_BACKOFF_BASE" env-default:"1s"`
+	BackoffMax       time.Duration `yaml:"backoffMax" env:"LOGIN_BACKOFF_MAX" env-default:"5m"`
+	AccountThreshold int           `yaml:"accountThreshold" env:"LOGIN_ACCOUNT_THRESHOLD" env-default:"10"` // 0 never locks accounts out.
+	IPThreshold      int           `yaml:"ipThreshold" env:"LOGIN_IP_THRESHOLD" env-default:"50"`           // 0 never locks addresses out.
+	Lockout          time.Duration `yaml:"lockout" env:"LOGIN_LOCKOUT" env-default:"15m"`
+}
+
+// PasswordHash sets Argon2id parameters of new password hashes. Stored hashes
+// made with other parameters or with bcrypt are rehashed on login.
+type PasswordHash struct {
+	Memory      uint32 `yaml:"memory" env:"PASSWORD_HASH_MEMORY" env-default:"65536"` // KiB
+	Iterations  uint32 `yaml:"iterations" env:"PASSWORD_HASH_ITERATIONS" env-default:"3"`
+	Parallelism uint8  `yaml:"parallelism" env:"PASSWORD_HASH_PARALLELISM" env-default:"4"`
+	// hashes run at once, each holding Memory KiB. 0 is the number of CPUs.
+	MaxConcurrent int `yaml:"maxConcurrent" env:"PASSWORD_HASH_MAX_CONCURRENT" env-default:"0"`
+}
+
+// HTTPConfig configures the optional HTTP server publishing /.well-known/jwks.json
+// and the OAuth 2.0 and OpenID Connect endpoints.
+type HTTPConfig struct {
+	Enabled bool   `yaml:"enabled" env:"HTTP_ENABLED" env-default:"false"`
+	Host    string `yaml:"host" env:"HTTP_HOST" env-default:"localhost"`
+	Port    int    `yaml:"port" env:"HTTP_PORT" env-default:"8080"`
+	// public base url of the server, e.g. https://sso.example.com. Required by the device flow.
+	PublicURL string `yaml:"publicURL" env:"HTTP_PUBLIC_URL"`
+	// header reverse proxies set to the end user's address, e.g.
+	// X-Forwarded-For. Only read from requests of TrustedProxies.
+	ClientIPHeader string `yaml:"clientIPHeader" env:"HTTP_CLIENT_IP_HEADER"`
+	// addresses or cidr ranges of the reverse proxies, e.g. 10.0.0.0/8.
+	TrustedProxies []string `yaml:"trustedProxies" env:"HTTP_TRUSTED_PROXIES"`
+}
+
+// MetricsConfig configures the optional server publishing expvar metrics on
+// /debug/vars, separate from the public HTTP server.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" env:"METRICS_ENABLED" env-default:"false"`
+	Host    string `yaml:"host" env:"METRICS_HOST" env-default:"localhost"`
+	Port    int    `yaml:"port" env:"METRICS_PORT" env-default:"9090"`
 }
 
 func Load() (*Config, error) {
-	path := fetchConfigPath()
+	path, migrateOnStart := fetchFlags()
 	if path == "" {
 		return nil, ErrEmptyPath //nolint:wrapcheck
 	}
@@ -48,6 +147,10 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
 
+	if migrateOnStart {
+		config.Storage.MigrateOnStart = true
+	}
+
 	return &config, nil
 }
 
@@ -67,15 +170,19 @@ func MustLoadByPath(path string) *Config {
 	return &config
 }
 
-func fetchConfigPath() string {
-	var path string
+func fetchFlags() (string, bool) {
+	var (
+		path           string
+		migrateOnStart bool
+	)
 
 	flag.StringVar(&path, "confpath", "", "path to config file")
+	flag.BoolVar(&migrateOnStart, "migrate-on-start", false, "apply pending database migrations on startup")
 	flag.Parse()
 
 	if path == "" {
 		path = os.Getenv("CONFIG_PATH")
 	}
 
-	return path
+	return path, migrateOnStart
 }
@@ -1,6 +1,46 @@
 package entity
 
+import (
+	"slices"
+	"time"
+)
+
+// grant types an app may allow.
+const (
+	GrantTypePassword          = "password"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// GrantTypes are every grant type the service issues tokens with.
+var GrantTypes = []string{
+	GrantTypePassword,
+	GrantTypeRefreshToken,
+	GrantTypeAuthorizationCode,
+	GrantTypeClientCredentials,
+	GrantTypeDeviceCode,
+}
+
 type App struct {
 	ID   int32  `db:"id"`
 	Name string `db:"name"`
-}
\ No newline at end of file
+
+	// oauth client registration.
+	ClientID         string
+	ClientSecretHash []byte // bcrypt hash, the secret itself is only shown once
+	RedirectURIs     []string
+
+	// token policy, zero values fall back to the service defaults.
+	AccessTTL         time.Duration
+	RefreshTTL        time.Duration
+	IdleTimeout       time.Duration // refresh sessions end after this long without a refresh
+	Audience          string        // extra aud claim value of access tokens
+	AllowedGrantTypes []string      // every grant type is allowed if empty
+}
+
+// AllowsGrantType reports whether tokens may be issued to the app with grantType.
+func (a *App) AllowsGrantType(grantType string) bool {
+	return len(a.AllowedGrantTypes) == 0 || slices.Contains(a.AllowedGrantTypes, grantType)
+}
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// AuthorizationCode is an oauth authorization code issued by /authorize.
+type AuthorizationCode struct {
+	Code          string // raw code, only known when the code is created
+	UserID        string
+	AppID         int32
+	RedirectURI   string
+	CodeChallenge string // PKCE S256 challenge
+	FamilyID      string // refresh token family started by the exchange
+	Scope         string // granted scopes, space separated
+	Nonce         string // OpenID Connect nonce, echoed in the ID token
+	ExpiresAt     time.Time
+	IsUsed        bool
+}
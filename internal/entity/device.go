@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// states of a device authorization.
+const (
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+)
+
+// DeviceAuthorization is an RFC 8628 device authorization request, approved
+// or denied by a user on the verification page while the device polls.
+type DeviceAuthorization struct {
+	DeviceCode   string // raw code, only known when the request is created
+	UserCode     string // normalized, without the separator
+	AppID        int32
+	Scope        string // granted scopes, space separated
+	Status       string
+	UserID       string        // user who approved or denied the request
+	Interval     time.Duration // minimal time between polls
+	LastPolledAt time.Time
+	ExpiresAt    time.Time
+}
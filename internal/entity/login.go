@@ -0,0 +1,10 @@
+package entity
+
+import "time"
+
+// LoginFailures counts failed logins of one account or client address since
+// the counter was last reset.
+type LoginFailures struct {
+	Failures      int
+	LastFailureAt time.Time // zero if Failures is 0
+}
@@ -0,0 +1,43 @@
+package entity
+
+// oauth scopes of the OpenID Connect layer.
+const (
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopeProfile = "profile"
+)
+
+// Scopes are every scope the service grants, others are ignored.
+var Scopes = []string{
+	ScopeOpenID,
+	ScopeEmail,
+	ScopeProfile,
+}
+
+// UserInfo are the claims about a user released by the granted scopes,
+// OpenID Connect Core section 5.1.
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email,omitempty"`              // email scope
+	PreferredUsername string `json:"preferred_username,omitempty"` //nolint:tagliatelle // profile scope
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`                  //nolint:tagliatelle
+	TokenEndpoint                     string   `json:"token_endpoint"`                          //nolint:tagliatelle
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`                       //nolint:tagliatelle
+	JWKSURI                           string   `json:"jwks_uri"`                                //nolint:tagliatelle
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint,omitempty"` //nolint:tagliatelle
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`                  //nolint:tagliatelle
+	RevocationEndpoint                string   `json:"revocation_endpoint"`                     //nolint:tagliatelle
+	ScopesSupported                   []string `json:"scopes_supported"`                        //nolint:tagliatelle
+	ResponseTypesSupported            []string `json:"response_types_supported"`                //nolint:tagliatelle
+	GrantTypesSupported               []string `json:"grant_types_supported"`                   //nolint:tagliatelle
+	SubjectTypesSupported             []string `json:"subject_types_supported"`                 //nolint:tagliatelle
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`   //nolint:tagliatelle
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`   //nolint:tagliatelle
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`        //nolint:tagliatelle
+	ClaimsSupported                   []string `json:"claims_supported"`                        //nolint:tagliatelle
+}
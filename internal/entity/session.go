@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// RefreshSession is a stored refresh token. Every token rotated from one
+// login shares its FamilyID.
+type RefreshSession struct {
+	RefreshToken string // raw token, only known when the session is created
+	ParentToken  string // token this one was rotated from, empty after login
+	UserID       string
+	AppID        int32
+	FamilyID     string
+	Scope        string // granted oauth scopes, space separated
+	ExpiresAt    time.Time
+	// absolute end of the login session, zero if it is only bounded by ExpiresAt.
+	SessionExpiresAt time.Time
+	IsUsed           bool
+	IsRevoked        bool
+}
@@ -1,7 +1,62 @@
 package entity
 
+import "time"
+
 type TokenPair struct {
 	AccessToken  string
 	RefreshToken string
+	ExpiresIn    time.Duration // access token lifetime
+	Scope        string        // granted oauth scopes, space separated
+	IDToken      string        // OpenID Connect, only with the openid scope
+}
+
+// JSONWebKey is a public verification key as described in RFC 7517.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
 }
 
+// TokenClaims are the decoded claims of a verified access token.
+type TokenClaims struct {
+	ID      string // jti
+	UserID  string
+	AppID   int32
+	IsAdmin bool
+	// the token is issued to an app acting on its own behalf, UserID is its client id.
+	IsServiceAccount bool
+	Scope            string // granted oauth scopes, space separated
+	IssuedAt         time.Time
+	ExpiresAt        time.Time
+}
+
+// token types of introspection responses.
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// TokenIntrospection is the state of a token, RFC 7662 section 2.2. Only
+// Active is set for inactive tokens.
+type TokenIntrospection struct {
+	Active           bool
+	TokenType        string
+	UserID           string // client id for service account tokens
+	AppID            int32
+	ClientID         string
+	Scope            string
+	IsServiceAccount bool
+	ID               string    // jti, access tokens only
+	IssuedAt         time.Time // access tokens only
+	ExpiresAt        time.Time
+}
@@ -0,0 +1,236 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	appsService "github.com/aspirin100/gRPC-SSO/internal/service/apps"
+	authService "github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	ssov1 "github.com/aspirin100/gRPC-SSO/protos/gen/go/sso"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	emptyValue    = 0
+	appNameMaxLen = 64
+)
+
+type Apps interface {
+	CreateApp(ctx context.Context,
+		admin appsService.Admin, app *entity.App) (*entity.App, string, error)
+	UpdateApp(ctx context.Context,
+		admin appsService.Admin, app *entity.App, rotateSecret bool) (*entity.App, string, error)
+	ListApps(ctx context.Context, admin appsService.Admin) ([]entity.App, error)
+	DeleteApp(ctx context.Context, admin appsService.Admin, appID int32) error
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedAppAdminServer
+	apps Apps
+}
+
+func RegisterAppAdminServer(gRPC *grpc.Server, apps Apps) {
+	ssov1.RegisterAppAdminServer(gRPC, &serverAPI{apps: apps})
+}
+
+func (s *serverAPI) CreateApp(ctx context.Context, req *ssov1.CreateAppRequest) (
+	*ssov1.CreateAppResponse, error) {
+	admin, err := validateAdmin(req.GetAdminToken(), req.GetAdminAppID())
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateApp(req.GetApp())
+	if err != nil {
+		return nil, err
+	}
+
+	app, secret, err := s.apps.CreateApp(ctx, admin, fromProto(req.GetApp()))
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	return &ssov1.CreateAppResponse{
+		App:          toProto(app),
+		ClientSecret: secret,
+	}, nil
+}
+
+func (s *serverAPI) UpdateApp(ctx context.Context, req *ssov1.UpdateAppRequest) (
+	*ssov1.UpdateAppResponse, error) {
+	admin, err := validateAdmin(req.GetAdminToken(), req.GetAdminAppID())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetApp().GetId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app id is required")
+	}
+
+	err = validateApp(req.GetApp())
+	if err != nil {
+		return nil, err
+	}
+
+	app, secret, err := s.apps.UpdateApp(ctx, admin,
+		fromProto(req.GetApp()), req.GetRotateSecret())
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	return &ssov1.UpdateAppResponse{
+		App:          toProto(app),
+		ClientSecret: secret,
+	}, nil
+}
+
+func (s *serverAPI) ListApps(ctx context.Context, req *ssov1.ListAppsRequest) (
+	*ssov1.ListAppsResponse, error) {
+	admin, err := validateAdmin(req.GetAdminToken(), req.GetAdminAppID())
+	if err != nil {
+		return nil, err
+	}
+
+	apps, err := s.apps.ListApps(ctx, admin)
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	resp := &ssov1.ListAppsResponse{
+		Apps: make([]*ssov1.App, 0, len(apps)),
+	}
+
+	for i := range apps {
+		resp.Apps = append(resp.Apps, toProto(&apps[i]))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) DeleteApp(ctx context.Context, req *ssov1.DeleteAppRequest) (
+	*ssov1.DeleteAppResponse, error) {
+	admin, err := validateAdmin(req.GetAdminToken(), req.GetAdminAppID())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app id is required")
+	}
+
+	err = s.apps.DeleteApp(ctx, admin, req.GetId())
+	if err != nil {
+		return nil, appError(err)
+	}
+
+	return &ssov1.DeleteAppResponse{}, nil
+}
+
+func validateAdmin(adminToken string, adminAppID int32) (appsService.Admin, error) {
+	if adminToken == "" {
+		return appsService.Admin{}, status.Error(codes.InvalidArgument, "admin token is required")
+	}
+
+	if adminAppID == emptyValue {
+		return appsService.Admin{}, status.Error(codes.InvalidArgument, "adminAppID is required")
+	}
+
+	return appsService.Admin{
+		Token: adminToken,
+		AppID: adminAppID,
+	}, nil
+}
+
+func validateApp(app *ssov1.App) error {
+	if app == nil {
+		return status.Error(codes.InvalidArgument, "app is required")
+	}
+
+	if app.GetName() == "" || len(app.GetName()) > appNameMaxLen {
+		return status.Errorf(codes.InvalidArgument, "app name must be 1 to %d characters long", appNameMaxLen)
+	}
+
+	for _, redirectURI := range app.GetRedirectURIs() {
+		if !isRedirectURI(redirectURI) {
+			return status.Errorf(codes.InvalidArgument, "invalid redirect uri %q", redirectURI)
+		}
+	}
+
+	for _, grantType := range app.GetAllowedGrantTypes() {
+		if !slices.Contains(entity.GrantTypes, grantType) {
+			return status.Errorf(codes.InvalidArgument, "unknown grant type %q", grantType)
+		}
+	}
+
+	if app.GetAccessTTL() < 0 || app.GetRefreshTTL() < 0 || app.GetIdleTimeout() < 0 {
+		return status.Error(codes.InvalidArgument, "ttls must not be negative")
+	}
+
+	return nil
+}
+
+// isRedirectURI accepts absolute uris without a fragment (RFC 6749 section 3.1.2).
+func isRedirectURI(redirectURI string) bool {
+	parsed, err := url.Parse(redirectURI)
+
+	return err == nil && parsed.IsAbs() && parsed.Host != "" && parsed.Fragment == ""
+}
+
+// appError maps errors of app admin rpcs to grpc statuses.
+func appError(err error) error {
+	switch {
+	case errors.Is(err, appsService.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	case errors.Is(err, appsService.ErrAppExists):
+		return status.Error(codes.AlreadyExists, "app already exists")
+	case errors.Is(err, appsService.ErrAccessTTLTooLong):
+		return status.Error(codes.InvalidArgument, "accessTTL must not exceed the signing key retention")
+	case errors.Is(err, appsService.ErrAudienceIsAppID):
+		return status.Error(codes.InvalidArgument, "audience must not be numeric")
+	case errors.Is(err, authService.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "admin rights required")
+	case errors.Is(err, authService.ErrAccessTokenExpired):
+		return status.Error(codes.Unauthenticated, "access token expired")
+	case errors.Is(err, authService.ErrInvalidAccessToken),
+		errors.Is(err, authService.ErrAccessTokenRevoked):
+		return status.Error(codes.Unauthenticated, "invalid access token")
+	case errors.Is(err, authService.ErrAppMismatch):
+		return status.Error(codes.PermissionDenied, "access token is issued for another app")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func fromProto(app *ssov1.App) *entity.App {
+	return &entity.App{
+		ID:                app.GetId(),
+		Name:              app.GetName(),
+		RedirectURIs:      app.GetRedirectURIs(),
+		AccessTTL:         time.Duration(app.GetAccessTTL()) * time.Second,
+		RefreshTTL:        time.Duration(app.GetRefreshTTL()) * time.Second,
+		IdleTimeout:       time.Duration(app.GetIdleTimeout()) * time.Second,
+		Audience:          app.GetAudience(),
+		AllowedGrantTypes: app.GetAllowedGrantTypes(),
+	}
+}
+
+func toProto(app *entity.App) *ssov1.App {
+	return &ssov1.App{
+		Id:                app.ID,
+		Name:              app.Name,
+		ClientID:          app.ClientID,
+		RedirectURIs:      app.RedirectURIs,
+		AccessTTL:         int64(app.AccessTTL / time.Second),
+		RefreshTTL:        int64(app.RefreshTTL / time.Second),
+		IdleTimeout:       int64(app.IdleTimeout / time.Second),
+		Audience:          app.Audience,
+		AllowedGrantTypes: app.AllowedGrantTypes,
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/mail"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aspirin100/gRPC-SSO/internal/entity"
 	authService "github.com/aspirin100/gRPC-SSO/internal/service/auth"
@@ -12,6 +16,7 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -28,15 +33,44 @@ type Auth interface {
 	IsAdmin(ctx context.Context, userID string) (*bool, error)
 	RefreshTokenPair(ctx context.Context,
 		userID, refreshToken string, appID int32) (*entity.TokenPair, error)
+	JWKS(ctx context.Context) (*entity.JSONWebKeySet, error)
+	ValidateToken(ctx context.Context,
+		accessToken string, appID int32) (*entity.TokenClaims, error)
+	Logout(ctx context.Context, refreshToken string) error
+	LogoutAll(ctx context.Context,
+		accessToken string, appID int32, currentAppOnly bool) (int64, error)
+	RevokeAccessToken(ctx context.Context,
+		adminToken string, appID int32, accessToken string) error
+	RevokeUserTokens(ctx context.Context,
+		adminToken string, appID int32, userID string, issuedBefore time.Time) (int64, error)
+	UnlockAccount(ctx context.Context,
+		adminToken string, appID int32, email, clientIP string) error
+	ClientCredentials(ctx context.Context, clientID, clientSecret string) (*entity.TokenPair, error)
+	StartDeviceAuthorization(ctx context.Context,
+		clientID, clientSecret, scope string) (*authService.DeviceCodes, error)
+	PollDeviceAuthorization(ctx context.Context,
+		clientID, clientSecret, deviceCode string) (*entity.TokenPair, error)
+	IntrospectToken(ctx context.Context,
+		clientID, clientSecret, token string) (*entity.TokenIntrospection, error)
+	RevokeToken(ctx context.Context, clientID, clientSecret, token string) error
 }
 
 type serverAPI struct {
 	ssov1.UnimplementedAuthServer
 	auth Auth
+	// metadata key the calling backend puts the end user's address in,
+	// empty if no caller is trusted to.
+	clientIPKey string
 }
 
-func RegisterAuthServer(gRPC *grpc.Server, auth Auth) {
-	ssov1.RegisterAuthServer(gRPC, &serverAPI{auth: auth})
+// RegisterAuthServer registers the auth service. Logins are throttled per
+// client address only if clientIPKey is set, the peer address is the
+// integrating backend, shared by all of its users.
+func RegisterAuthServer(gRPC *grpc.Server, auth Auth, clientIPKey string) {
+	ssov1.RegisterAuthServer(gRPC, &serverAPI{
+		auth:        auth,
+		clientIPKey: strings.ToLower(clientIPKey),
+	})
 }
 
 func (s *serverAPI) Login(ctx context.Context, req *ssov1.LoginRequest) ( //nolint:dupl
@@ -46,14 +80,22 @@ func (s *serverAPI) Login(ctx context.Context, req *ssov1.LoginRequest) ( //noli
 		return nil, fmt.Errorf("login validation error: %w", err)
 	}
 
+	if ip := s.clientIP(ctx); ip != "" {
+		ctx = authService.WithClientIP(ctx, ip)
+	}
+
 	tokens, err := s.auth.Login(ctx, req.GetEmail(),
 		req.GetPassword(), req.GetAppID())
 	if err != nil {
 		switch {
+		case errors.Is(err, authService.ErrLoginThrottled):
+			return nil, throttledError(ctx, err)
 		case errors.Is(err, authService.ErrInvalidCredentials):
 			return nil, status.Error(codes.InvalidArgument, "wrong email or password")
-		case errors.Is(err, authService.ErrInvalidPassword):
-			return nil, status.Error(codes.InvalidArgument, "wrong password")
+		case errors.Is(err, authService.ErrAppNotFound):
+			return nil, status.Error(codes.InvalidArgument, "app not found")
+		case errors.Is(err, authService.ErrGrantTypeNotAllowed):
+			return nil, status.Error(codes.PermissionDenied, "login method is not allowed for the app")
 		default:
 			return nil, status.Error(codes.Internal, "internal error")
 		}
@@ -103,6 +145,16 @@ func (s *serverAPI) RefreshTokenPair(ctx context.Context, req *ssov1.RefreshRequ
 			return nil, status.Error(codes.NotFound, "refresh token not found")
 		case errors.Is(err, authService.ErrInvalidRefreshToken):
 			return nil, status.Error(codes.PermissionDenied, "invalid refresh token")
+		case errors.Is(err, authService.ErrMalformedRefreshToken):
+			return nil, status.Error(codes.InvalidArgument, "malformed refresh token")
+		case errors.Is(err, authService.ErrRefreshTokenReused):
+			return nil, status.Error(codes.PermissionDenied, "refresh token reuse detected, session revoked")
+		case errors.Is(err, authService.ErrAppNotFound):
+			return nil, status.Error(codes.InvalidArgument, "app not found")
+		case errors.Is(err, authService.ErrGrantTypeNotAllowed):
+			return nil, status.Error(codes.PermissionDenied, "token refresh is not allowed for the app")
+		case errors.Is(err, authService.ErrAppMismatch):
+			return nil, status.Error(codes.PermissionDenied, "refresh token is issued for another app")
 		default:
 			return nil, status.Error(codes.Internal, "internal error")
 		}
@@ -135,6 +187,304 @@ func (s *serverAPI) IsAdmin(ctx context.Context, req *ssov1.IsAdminRequest) (
 	}, nil
 }
 
+func (s *serverAPI) GetJWKS(ctx context.Context, _ *ssov1.GetJWKSRequest) (
+	*ssov1.GetJWKSResponse, error) {
+	jwks, err := s.auth.JWKS(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	keys := make([]*ssov1.JSONWebKey, 0, len(jwks.Keys))
+
+	for _, key := range jwks.Keys {
+		keys = append(keys, &ssov1.JSONWebKey{
+			Kty: key.Kty,
+			Kid: key.Kid,
+			Use: key.Use,
+			Alg: key.Alg,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Crv,
+			X:   key.X,
+			Y:   key.Y,
+		})
+	}
+
+	return &ssov1.GetJWKSResponse{
+		Keys: keys,
+	}, nil
+}
+
+func (s *serverAPI) ValidateToken(ctx context.Context, req *ssov1.ValidateTokenRequest) (
+	*ssov1.ValidateTokenResponse, error) {
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "access token is required")
+	}
+
+	if req.GetAppID() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appID is required")
+	}
+
+	claims, err := s.auth.ValidateToken(ctx, req.GetAccessToken(), req.GetAppID())
+	if err != nil {
+		return nil, accessTokenError(err)
+	}
+
+	return &ssov1.ValidateTokenResponse{
+		UserID:    claims.UserID,
+		AppID:     claims.AppID,
+		IsAdmin:   claims.IsAdmin,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+
+		IsServiceAccount: claims.IsServiceAccount,
+	}, nil
+}
+
+func (s *serverAPI) Logout(ctx context.Context, req *ssov1.LogoutRequest) (
+	*ssov1.LogoutResponse, error) {
+	if req.GetRefreshToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "refresh token is required")
+	}
+
+	err := s.auth.Logout(ctx, req.GetRefreshToken())
+	if err != nil {
+		switch {
+		case errors.Is(err, authService.ErrMalformedRefreshToken):
+			return nil, status.Error(codes.InvalidArgument, "malformed refresh token")
+		case errors.Is(err, authService.ErrRefreshTokenNotFound):
+			return nil, status.Error(codes.NotFound, "refresh token not found")
+		default:
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+	}
+
+	return &ssov1.LogoutResponse{}, nil
+}
+
+func (s *serverAPI) LogoutAll(ctx context.Context, req *ssov1.LogoutAllRequest) (
+	*ssov1.LogoutAllResponse, error) {
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "access token is required")
+	}
+
+	if req.GetAppID() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "appID is required")
+	}
+
+	revoked, err := s.auth.LogoutAll(ctx, req.GetAccessToken(),
+		req.GetAppID(), req.GetCurrentAppOnly())
+	if err != nil {
+		return nil, accessTokenError(err)
+	}
+
+	return &ssov1.LogoutAllResponse{
+		RevokedSessions: revoked,
+	}, nil
+}
+
+func (s *serverAPI) RevokeAccessToken(ctx context.Context, req *ssov1.RevokeAccessTokenRequest) (
+	*ssov1.RevokeAccessTokenResponse, error) {
+	err := validateAdminRequest(req.GetAdminToken(), req.GetAppID())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "access token is required")
+	}
+
+	err = s.auth.RevokeAccessToken(ctx, req.GetAdminToken(), req.GetAppID(), req.GetAccessToken())
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return &ssov1.RevokeAccessTokenResponse{}, nil
+}
+
+func (s *serverAPI) RevokeUserTokens(ctx context.Context, req *ssov1.RevokeUserTokensRequest) (
+	*ssov1.RevokeUserTokensResponse, error) {
+	err := validateAdminRequest(req.GetAdminToken(), req.GetAppID())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetUserID() == "" {
+		return nil, status.Error(codes.InvalidArgument, "userID is required")
+	}
+
+	var issuedBefore time.Time
+	if req.GetIssuedBefore() != emptyValue {
+		issuedBefore = time.Unix(req.GetIssuedBefore(), 0)
+	}
+
+	revoked, err := s.auth.RevokeUserTokens(ctx, req.GetAdminToken(), req.GetAppID(),
+		req.GetUserID(), issuedBefore)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return &ssov1.RevokeUserTokensResponse{
+		RevokedSessions: revoked,
+	}, nil
+}
+
+func (s *serverAPI) UnlockAccount(ctx context.Context, req *ssov1.UnlockAccountRequest) (
+	*ssov1.UnlockAccountResponse, error) {
+	err := validateAdminRequest(req.GetAdminToken(), req.GetAppID())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetEmail() == "" && req.GetClientIP() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email or clientIP is required")
+	}
+
+	err = s.auth.UnlockAccount(ctx, req.GetAdminToken(), req.GetAppID(),
+		req.GetEmail(), req.GetClientIP())
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return &ssov1.UnlockAccountResponse{}, nil
+}
+
+func (s *serverAPI) ClientCredentials(ctx context.Context, req *ssov1.ClientCredentialsRequest) (
+	*ssov1.ClientCredentialsResponse, error) {
+	if req.GetClientID() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+
+	if req.GetClientSecret() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client secret is required")
+	}
+
+	tokens, err := s.auth.ClientCredentials(ctx, req.GetClientID(), req.GetClientSecret())
+	if err != nil {
+		switch {
+		case errors.Is(err, authService.ErrInvalidClient):
+			return nil, status.Error(codes.Unauthenticated, "unknown client or wrong client secret")
+		case errors.Is(err, authService.ErrGrantTypeNotAllowed):
+			return nil, status.Error(codes.PermissionDenied, "client credentials are not allowed for the app")
+		default:
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+	}
+
+	return &ssov1.ClientCredentialsResponse{
+		AccessToken: tokens.AccessToken,
+		ExpiresIn:   int64(tokens.ExpiresIn.Seconds()),
+	}, nil
+}
+
+func (s *serverAPI) StartDeviceAuthorization(ctx context.Context,
+	req *ssov1.StartDeviceAuthorizationRequest) (*ssov1.StartDeviceAuthorizationResponse, error) {
+	if req.GetClientID() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+
+	deviceCodes, err := s.auth.StartDeviceAuthorization(ctx,
+		req.GetClientID(), req.GetClientSecret(), req.GetScope())
+	if err != nil {
+		return nil, deviceFlowError(err)
+	}
+
+	return &ssov1.StartDeviceAuthorizationResponse{
+		DeviceCode:              deviceCodes.DeviceCode,
+		UserCode:                deviceCodes.UserCode,
+		VerificationURI:         deviceCodes.VerificationURI,
+		VerificationURIComplete: deviceCodes.VerificationURIComplete,
+		ExpiresIn:               int64(deviceCodes.ExpiresIn.Seconds()),
+		Interval:                int64(deviceCodes.Interval.Seconds()),
+	}, nil
+}
+
+func (s *serverAPI) PollDeviceAuthorization(ctx context.Context,
+	req *ssov1.PollDeviceAuthorizationRequest) (*ssov1.NewTokenPairResponse, error) {
+	if req.GetClientID() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+
+	if req.GetDeviceCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "device code is required")
+	}
+
+	tokens, err := s.auth.PollDeviceAuthorization(ctx,
+		req.GetClientID(), req.GetClientSecret(), req.GetDeviceCode())
+	if err != nil {
+		return nil, deviceFlowError(err)
+	}
+
+	return &ssov1.NewTokenPairResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+func (s *serverAPI) IntrospectToken(ctx context.Context,
+	req *ssov1.IntrospectTokenRequest) (*ssov1.IntrospectTokenResponse, error) {
+	if req.GetClientID() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	introspection, err := s.auth.IntrospectToken(ctx,
+		req.GetClientID(), req.GetClientSecret(), req.GetToken())
+	if err != nil {
+		if errors.Is(err, authService.ErrInvalidClient) {
+			return nil, status.Error(codes.Unauthenticated, "unknown client or wrong client secret")
+		}
+
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	if !introspection.Active {
+		return &ssov1.IntrospectTokenResponse{}, nil
+	}
+
+	resp := &ssov1.IntrospectTokenResponse{
+		Active:           true,
+		TokenType:        introspection.TokenType,
+		UserID:           introspection.UserID,
+		AppID:            introspection.AppID,
+		ClientID:         introspection.ClientID,
+		Scope:            introspection.Scope,
+		IsServiceAccount: introspection.IsServiceAccount,
+		Jti:              introspection.ID,
+		ExpiresAt:        introspection.ExpiresAt.Unix(),
+	}
+
+	if !introspection.IssuedAt.IsZero() {
+		resp.IssuedAt = introspection.IssuedAt.Unix()
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeToken(ctx context.Context,
+	req *ssov1.RevokeTokenRequest) (*ssov1.RevokeTokenResponse, error) {
+	if req.GetClientID() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client id is required")
+	}
+
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	err := s.auth.RevokeToken(ctx, req.GetClientID(), req.GetClientSecret(), req.GetToken())
+	if err != nil {
+		if errors.Is(err, authService.ErrInvalidClient) {
+			return nil, status.Error(codes.Unauthenticated, "unknown client or wrong client secret")
+		}
+
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &ssov1.RevokeTokenResponse{}, nil
+}
+
 func validateLogin(req *ssov1.LoginRequest) error {
 	err := validateEmailPass(req.GetEmail(), req.GetPassword())
 	if err != nil {
@@ -178,3 +528,103 @@ func validateRefreshRequest(req *ssov1.RefreshRequest) error {
 
 	return nil
 }
+
+func validateAdminRequest(adminToken string, appID int32) error {
+	if adminToken == "" {
+		return status.Error(codes.InvalidArgument, "admin token is required")
+	}
+
+	if appID == emptyValue {
+		return status.Error(codes.InvalidArgument, "appID is required")
+	}
+
+	return nil
+}
+
+// adminError maps errors of admin rpcs to grpc statuses.
+func adminError(err error) error {
+	switch {
+	case errors.Is(err, authService.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "admin rights required")
+	case errors.Is(err, authService.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, authService.ErrInvalidTargetToken):
+		return status.Error(codes.InvalidArgument, "invalid access token to revoke")
+	default:
+		return accessTokenError(err)
+	}
+}
+
+// throttledError returns ResourceExhausted with the seconds to wait before the
+// next login in the retry-after trailer.
+func throttledError(ctx context.Context, err error) error {
+	var throttled *authService.LoginThrottledError
+	if errors.As(err, &throttled) {
+		// the status is returned even if the trailer could not be set.
+		_ = grpc.SetTrailer(ctx, metadata.Pairs("retry-after",
+			strconv.FormatInt(throttled.RetryAfterSeconds(), 10)))
+	}
+
+	return status.Error(codes.ResourceExhausted, "too many failed logins, try again later")
+}
+
+// clientIP returns the end user's address from the trusted metadata key, or
+// "" if the key is not configured or carries no valid address.
+func (s *serverAPI) clientIP(ctx context.Context) string {
+	if s.clientIPKey == "" {
+		return ""
+	}
+
+	values := metadata.ValueFromIncomingContext(ctx, s.clientIPKey)
+	if len(values) == 0 {
+		return ""
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(values[0]))
+	if ip == nil {
+		return ""
+	}
+
+	return ip.String()
+}
+
+// deviceFlowError maps device flow errors to grpc statuses, polling errors
+// carry the RFC 8628 error code as the message.
+func deviceFlowError(err error) error {
+	switch {
+	case errors.Is(err, authService.ErrDeviceFlowDisabled):
+		return status.Error(codes.Unimplemented, "device flow is disabled")
+	case errors.Is(err, authService.ErrInvalidClient):
+		return status.Error(codes.Unauthenticated, "unknown client or wrong client secret")
+	case errors.Is(err, authService.ErrGrantTypeNotAllowed):
+		return status.Error(codes.PermissionDenied, "device flow is not allowed for the app")
+	case errors.Is(err, authService.ErrAuthorizationPending):
+		return status.Error(codes.FailedPrecondition, "authorization_pending")
+	case errors.Is(err, authService.ErrSlowDown):
+		return status.Error(codes.ResourceExhausted, "slow_down")
+	case errors.Is(err, authService.ErrExpiredToken):
+		return status.Error(codes.DeadlineExceeded, "expired_token")
+	case errors.Is(err, authService.ErrAccessDenied):
+		return status.Error(codes.PermissionDenied, "access_denied")
+	case errors.Is(err, authService.ErrInvalidGrant):
+		return status.Error(codes.InvalidArgument, "invalid device code")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// accessTokenError maps access token verification errors to grpc statuses.
+func accessTokenError(err error) error {
+	switch {
+	case errors.Is(err, authService.ErrAccessTokenExpired):
+		return status.Error(codes.Unauthenticated, "access token expired")
+	case errors.Is(err, authService.ErrInvalidAccessToken):
+		return status.Error(codes.Unauthenticated, "invalid access token")
+	case errors.Is(err, authService.ErrAccessTokenRevoked):
+		return status.Error(codes.Unauthenticated, "access token revoked")
+	case errors.Is(err, authService.ErrAppMismatch):
+		return status.Error(codes.PermissionDenied, "access token is issued for another app")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
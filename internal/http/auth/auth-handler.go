@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	authService "github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+// service layer interface.
+type Auth interface {
+	JWKS(ctx context.Context) (*entity.JSONWebKeySet, error)
+	AuthorizeClient(ctx context.Context, clientID, redirectURI string) (*entity.App, error)
+	Authorize(ctx context.Context,
+		req authService.AuthorizationRequest, email, password string) (string, error)
+	ExchangeAuthorizationCode(ctx context.Context,
+		req authService.CodeExchange) (*entity.TokenPair, error)
+	RefreshClientTokens(ctx context.Context,
+		clientID, clientSecret, refreshToken string) (*entity.TokenPair, error)
+	ClientCredentials(ctx context.Context,
+		clientID, clientSecret string) (*entity.TokenPair, error)
+	StartDeviceAuthorization(ctx context.Context,
+		clientID, clientSecret, scope string) (*authService.DeviceCodes, error)
+	DeviceAuthorizationApp(ctx context.Context, userCode string) (*entity.App, error)
+	DecideDeviceAuthorization(ctx context.Context,
+		userCode, email, password string, approved bool) error
+	PollDeviceAuthorization(ctx context.Context,
+		clientID, clientSecret, deviceCode string) (*entity.TokenPair, error)
+	IntrospectToken(ctx context.Context,
+		clientID, clientSecret, token string) (*entity.TokenIntrospection, error)
+	RevokeToken(ctx context.Context, clientID, clientSecret, token string) error
+	OpenIDConfiguration(ctx context.Context) (*entity.OpenIDConfiguration, error)
+	UserInfo(ctx context.Context, accessToken string) (*entity.UserInfo, error)
+}
+
+const (
+	jwksPath                = "/.well-known/jwks.json"
+	openIDConfigurationPath = "/.well-known/openid-configuration"
+	authorizePath           = "/authorize"
+	tokenPath               = "/token"
+	userInfoPath            = "/userinfo"
+	deviceAuthorizationPath = "/device_authorization"
+	introspectPath          = "/introspect"
+	revokePath              = "/revoke"
+
+	// DevicePath is the device flow verification page.
+	DevicePath = "/device"
+)
+
+type handlerAPI struct {
+	logg     *slog.Logger
+	auth     Auth
+	clientIP ClientIPConfig
+}
+
+// RegisterAuthHandlers registers the auth handlers. Logins are throttled per
+// peer address, or behind trusted reverse proxies per address they report,
+// see ClientIPConfig.
+func RegisterAuthHandlers(mux *http.ServeMux, logg *slog.Logger, auth Auth, clientIP ClientIPConfig) {
+	handler := &handlerAPI{
+		logg:     logg,
+		auth:     auth,
+		clientIP: clientIP,
+	}
+
+	mux.HandleFunc("GET "+jwksPath, handler.JWKS)
+	mux.HandleFunc("GET "+authorizePath, handler.AuthorizeForm)
+	mux.HandleFunc("POST "+authorizePath, handler.Authorize)
+	mux.HandleFunc("POST "+tokenPath, handler.Token)
+	mux.HandleFunc("POST "+introspectPath, handler.Introspect)
+	mux.HandleFunc("POST "+revokePath, handler.Revoke)
+	mux.HandleFunc("POST "+deviceAuthorizationPath, handler.DeviceAuthorization)
+	mux.HandleFunc("GET "+DevicePath, handler.DeviceForm)
+	mux.HandleFunc("POST "+DevicePath, handler.DecideDevice)
+	mux.HandleFunc("GET "+openIDConfigurationPath, handler.OpenIDConfiguration)
+	mux.HandleFunc("GET "+userInfoPath, handler.UserInfo)
+	mux.HandleFunc("POST "+userInfoPath, handler.UserInfo)
+}
+
+func (h *handlerAPI) JWKS(w http.ResponseWriter, r *http.Request) {
+	jwks, err := h.auth.JWKS(r.Context())
+	if err != nil {
+		h.logg.Error("failed to get jwks", sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+
+		return
+	}
+
+	// verification keys change rarely, let clients cache them for a while.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.writeJSON(w, http.StatusOK, jwks)
+}
+
+func (h *handlerAPI) writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		h.logg.Warn("failed to write response", sl.Err(err))
+	}
+}
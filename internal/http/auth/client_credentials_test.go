@@ -0,0 +1,38 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+func TestClientCredentialsGrant(t *testing.T) {
+	srv, client := newTestProvider(t, jwt.SigningMethodES256)
+	ctx := context.Background()
+
+	cfg := &clientcredentials.Config{
+		ClientID:     client.ClientID,
+		ClientSecret: clientSecret,
+		TokenURL:     srv.URL + "/token",
+	}
+
+	token, err := cfg.Token(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, token.AccessToken)
+	require.Empty(t, token.RefreshToken)
+	require.False(t, token.Expiry.IsZero())
+
+	cfg.ClientSecret = "wrong"
+
+	_, err = cfg.Token(ctx)
+
+	var retrieveErr *oauth2.RetrieveError
+
+	require.True(t, errors.As(err, &retrieveErr))
+	require.Equal(t, "invalid_client", retrieveErr.ErrorCode)
+}
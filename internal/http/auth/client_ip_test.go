@@ -0,0 +1,138 @@
+package auth_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	httpAuth "github.com/aspirin100/gRPC-SSO/internal/http/auth"
+	"github.com/aspirin100/gRPC-SSO/internal/passwords"
+	"github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+const proxyAddr = "10.0.0.1:41000"
+
+// TestLoginThrottledPerForwardedAddress locks out one address behind a
+// trusted proxy without locking out the others behind it.
+func TestLoginThrottledPerForwardedAddress(t *testing.T) {
+	handler, client := newThrottledHandler(t, httpAuth.ClientIPConfig{
+		Header:         "X-Forwarded-For",
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	})
+
+	// the proxy appends the address it got the request from to the one the
+	// client claims.
+	attacker := postLogin(t, handler, client, proxyAddr, "192.0.2.9, 198.51.100.1", "wrong-password")
+	require.Equal(t, http.StatusUnauthorized, attacker.Code)
+
+	attacker = postLogin(t, handler, client, proxyAddr, "198.51.100.1", testPassword)
+	require.Equal(t, http.StatusTooManyRequests, attacker.Code)
+	require.NotEmpty(t, attacker.Header().Get("Retry-After"))
+
+	user := postLogin(t, handler, client, proxyAddr, "198.51.100.2", testPassword)
+	require.Equal(t, http.StatusSeeOther, user.Code)
+}
+
+// TestLoginForwardedAddressUntrusted ignores the header of peers that are not
+// trusted proxies, a client cannot dodge the throttle by making up addresses.
+func TestLoginForwardedAddressUntrusted(t *testing.T) {
+	handler, client := newThrottledHandler(t, httpAuth.ClientIPConfig{
+		Header:         "X-Forwarded-For",
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	})
+
+	resp := postLogin(t, handler, client, "203.0.113.1:41000", "198.51.100.1", "wrong-password")
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = postLogin(t, handler, client, "203.0.113.1:41000", "198.51.100.2", testPassword)
+	require.Equal(t, http.StatusTooManyRequests, resp.Code)
+}
+
+// newThrottledHandler serves the http handlers with logins locked out for an
+// hour after one failure of an address.
+func newThrottledHandler(t *testing.T, clientIP httpAuth.ClientIPConfig) (http.Handler, *entity.App) {
+	t.Helper()
+
+	ctx := context.Background()
+	storagePath := filepath.Join(t.TempDir(), "sso.db")
+
+	require.NoError(t, storage.MigrateUp(storage.DriverSQLite, storagePath))
+
+	logg := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	strg, err := storage.New(logg, storage.DriverSQLite, storagePath, []byte("test_hash_key"))
+	require.NoError(t, err)
+
+	key, err := tokens.NewSecretKey("test_secret_key")
+	require.NoError(t, err)
+
+	hasher := passwords.NewArgon2id(passwords.DefaultArgon2idParams, 0)
+
+	authService := auth.New(logg, strg, tokens.NewKeyRing(key, time.Minute), hasher, auth.TokenConfig{
+		AccessTTL:  time.Minute,
+		RefreshTTL: time.Hour,
+		LoginThrottle: auth.LoginThrottleConfig{
+			Enabled:     true,
+			IPThreshold: 1,
+			Lockout:     time.Hour,
+		},
+	})
+
+	mux := http.NewServeMux()
+	httpAuth.RegisterAuthHandlers(mux, logg, authService, clientIP)
+
+	_, err = authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	client, err := strg.SaveApp(ctx, &entity.App{
+		Name:         "relying party",
+		RedirectURIs: []string{redirectURL},
+	})
+	require.NoError(t, err)
+
+	return mux, client
+}
+
+func postLogin(t *testing.T,
+	handler http.Handler,
+	client *entity.App,
+	remoteAddr,
+	forwardedFor,
+	password string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {redirectURL},
+		"state":                 {"xyz"},
+		"code_challenge":        {oauth2.S256ChallengeFromVerifier(oauth2.GenerateVerifier())},
+		"code_challenge_method": {"S256"},
+		"email":                 {testEmail},
+		"password":              {password},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	req.RemoteAddr = remoteAddr
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	return resp
+}
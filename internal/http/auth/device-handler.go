@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	authService "github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+// deviceAuthorizationResponse is the response of the device authorization
+// endpoint, RFC 8628 section 3.2.
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`               //nolint:tagliatelle
+	UserCode                string `json:"user_code"`                 //nolint:tagliatelle
+	VerificationURI         string `json:"verification_uri"`          //nolint:tagliatelle
+	VerificationURIComplete string `json:"verification_uri_complete"` //nolint:tagliatelle
+	ExpiresIn               int64  `json:"expires_in"`                //nolint:tagliatelle
+	Interval                int64  `json:"interval"`
+}
+
+type devicePage struct {
+	Action   string
+	UserCode string
+	AppName  string // empty until the code is known
+	Error    string
+	Decided  string // approved or denied after the user decided
+}
+
+var deviceTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Connect a device</title></head>
+<body>
+{{if .Decided}}
+<h1>Device {{.Decided}}</h1>
+<p>You can return to your device.</p>
+{{else}}
+<h1>{{if .AppName}}Connect {{.AppName}}{{else}}Connect a device{{end}}</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<label>Code shown on the device <input name="user_code" value="{{.UserCode}}" required autocomplete="off"></label>
+<label>Email <input type="email" name="email" required></label>
+<label>Password <input type="password" name="password" required></label>
+<button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// DeviceAuthorization starts the device flow of a client.
+func (h *handlerAPI) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	err := r.ParseForm()
+	if err != nil {
+		h.writeOAuthError(w, http.StatusBadRequest, errInvalidRequest, "invalid form")
+
+		return
+	}
+
+	clientID, clientSecret, basicAuth := clientCredentials(r)
+	if clientID == "" {
+		h.writeOAuthError(w, http.StatusUnauthorized, errInvalidClient, "client_id is required")
+
+		return
+	}
+
+	codes, err := h.auth.StartDeviceAuthorization(r.Context(),
+		clientID, clientSecret, r.PostForm.Get("scope"))
+	if err != nil {
+		if errors.Is(err, authService.ErrDeviceFlowDisabled) {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		h.writeTokenError(w, err, basicAuth)
+
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, deviceAuthorizationResponse{
+		DeviceCode:              codes.DeviceCode,
+		UserCode:                codes.UserCode,
+		VerificationURI:         codes.VerificationURI,
+		VerificationURIComplete: codes.VerificationURIComplete,
+		ExpiresIn:               int64(codes.ExpiresIn.Seconds()),
+		Interval:                int64(codes.Interval.Seconds()),
+	})
+}
+
+// DeviceForm shows the verification page, prefilled from
+// verification_uri_complete.
+func (h *handlerAPI) DeviceForm(w http.ResponseWriter, r *http.Request) {
+	page := devicePage{
+		UserCode: r.URL.Query().Get("user_code"),
+	}
+
+	if page.UserCode != "" {
+		app, err := h.auth.DeviceAuthorizationApp(r.Context(), page.UserCode)
+
+		switch {
+		case err == nil:
+			page.AppName = app.Name
+		case errors.Is(err, authService.ErrInvalidUserCode):
+			page.Error = "unknown or expired code"
+		default:
+			h.logg.Error("failed to find device authorization", sl.Err(err))
+		}
+	}
+
+	h.renderDevice(w, http.StatusOK, page)
+}
+
+// DecideDevice logs the user in and approves or denies the device.
+func (h *handlerAPI) DecideDevice(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+
+		return
+	}
+
+	page := devicePage{
+		UserCode: r.PostForm.Get("user_code"),
+	}
+	approved := r.PostForm.Get("action") == "approve"
+
+	err = h.auth.DecideDeviceAuthorization(h.clientIPContext(r), page.UserCode,
+		r.PostForm.Get("email"), r.PostForm.Get("password"), approved)
+	if err != nil {
+		switch {
+		case errors.Is(err, authService.ErrLoginThrottled):
+			setRetryAfter(w, err)
+			page.Error = "too many failed attempts, try again later"
+			h.renderDevice(w, http.StatusTooManyRequests, page)
+		case errors.Is(err, authService.ErrInvalidCredentials):
+			page.Error = "wrong email or password"
+			h.renderDevice(w, http.StatusUnauthorized, page)
+		case errors.Is(err, authService.ErrInvalidUserCode):
+			page.Error = "unknown or expired code"
+			h.renderDevice(w, http.StatusBadRequest, page)
+		default:
+			h.logg.Error("failed to decide device authorization", sl.Err(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	page.Decided = "denied"
+	if approved {
+		page.Decided = "approved"
+	}
+
+	h.renderDevice(w, http.StatusOK, page)
+}
+
+func (h *handlerAPI) renderDevice(w http.ResponseWriter, code int, page devicePage) {
+	page.Action = DevicePath
+
+	h.renderPage(w, code, deviceTemplate, page)
+}
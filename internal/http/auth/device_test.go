@@ -0,0 +1,57 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestDeviceFlow(t *testing.T) {
+	srv, client := newTestProvider(t, jwt.SigningMethodES256)
+	ctx := context.Background()
+
+	cfg := &oauth2.Config{
+		ClientID:     client.ClientID,
+		ClientSecret: clientSecret,
+		Endpoint: oauth2.Endpoint{
+			DeviceAuthURL: srv.URL + "/device_authorization",
+			TokenURL:      srv.URL + "/token",
+			AuthStyle:     oauth2.AuthStyleInParams,
+		},
+	}
+
+	// the library sends only the client id here, confidential clients
+	// authenticate on the device authorization request too.
+	deviceAuth, err := cfg.DeviceAuth(ctx, oauth2.SetAuthURLParam("client_secret", clientSecret))
+	require.NoError(t, err)
+	require.Equal(t, srv.URL+"/device", deviceAuth.VerificationURI)
+
+	// the user opens the verification page and approves the device.
+	resp, err := srv.Client().Get(deviceAuth.VerificationURIComplete)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = srv.Client().PostForm(srv.URL+"/device", url.Values{
+		"user_code": {deviceAuth.UserCode},
+		"email":     {testEmail},
+		"password":  {testPassword},
+		"action":    {"approve"},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// poll sooner than the server asks, the first poll is never too early.
+	deviceAuth.Interval = 1
+
+	token, err := cfg.DeviceAccessToken(ctx, deviceAuth)
+	require.NoError(t, err)
+	require.NotEmpty(t, token.AccessToken)
+	require.NotEmpty(t, token.RefreshToken)
+}
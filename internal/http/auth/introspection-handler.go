@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	authService "github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+// introspectionResponse is the response of the introspection endpoint,
+// RFC 7662 section 2.2. Inactive tokens carry only active.
+type introspectionResponse struct {
+	Active         bool   `json:"active"`
+	Scope          string `json:"scope,omitempty"`
+	ClientID       string `json:"client_id,omitempty"`  //nolint:tagliatelle
+	TokenType      string `json:"token_type,omitempty"` //nolint:tagliatelle
+	TokenUse       string `json:"token_use,omitempty"`  //nolint:tagliatelle
+	ExpiresAt      int64  `json:"exp,omitempty"`
+	IssuedAt       int64  `json:"iat,omitempty"`
+	Subject        string `json:"sub,omitempty"`
+	JTI            string `json:"jti,omitempty"`
+	ServiceAccount bool   `json:"service_account,omitempty"` //nolint:tagliatelle
+}
+
+// Introspect tells a confidential client whether its token is active.
+func (h *handlerAPI) Introspect(w http.ResponseWriter, r *http.Request) {
+	// token state must not be cached, RFC 7662 section 4.
+	w.Header().Set("Cache-Control", "no-store")
+
+	clientID, clientSecret, basicAuth, token, ok := h.readTokenRequest(w, r)
+	if !ok {
+		return
+	}
+
+	introspection, err := h.auth.IntrospectToken(r.Context(), clientID, clientSecret, token)
+	if err != nil {
+		h.writeTokenError(w, err, basicAuth)
+
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, newIntrospectionResponse(introspection))
+}
+
+// Revoke revokes an access or refresh token of the calling client. Unknown
+// tokens are ignored, RFC 7009 section 2.2.
+func (h *handlerAPI) Revoke(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, basicAuth, token, ok := h.readTokenRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.auth.RevokeToken(r.Context(), clientID, clientSecret, token)
+	if err != nil {
+		if errors.Is(err, authService.ErrInvalidClient) {
+			h.writeTokenError(w, err, basicAuth)
+
+			return
+		}
+
+		h.logg.Error("failed to revoke token", sl.Err(err))
+		h.writeOAuthError(w, http.StatusServiceUnavailable, errServerError, "")
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// readTokenRequest reads the client credentials and the token parameter of an
+// introspection or revocation request. token_type_hint is ignored, tokens are
+// told apart by their format.
+func (h *handlerAPI) readTokenRequest(w http.ResponseWriter,
+	r *http.Request) (clientID, clientSecret string, basicAuth bool, token string, ok bool) {
+	err := r.ParseForm()
+	if err != nil {
+		h.writeOAuthError(w, http.StatusBadRequest, errInvalidRequest, "invalid form")
+
+		return "", "", false, "", false
+	}
+
+	clientID, clientSecret, basicAuth = clientCredentials(r)
+	if clientID == "" {
+		h.writeOAuthError(w, http.StatusUnauthorized, errInvalidClient, "client_id is required")
+
+		return "", "", false, "", false
+	}
+
+	token = r.PostForm.Get("token")
+	if token == "" {
+		h.writeOAuthError(w, http.StatusBadRequest, errInvalidRequest, "token is required")
+
+		return "", "", false, "", false
+	}
+
+	return clientID, clientSecret, basicAuth, token, true
+}
+
+func newIntrospectionResponse(introspection *entity.TokenIntrospection) introspectionResponse {
+	if !introspection.Active {
+		return introspectionResponse{}
+	}
+
+	resp := introspectionResponse{
+		Active:         true,
+		Scope:          introspection.Scope,
+		ClientID:       introspection.ClientID,
+		TokenUse:       introspection.TokenType,
+		ExpiresAt:      introspection.ExpiresAt.Unix(),
+		Subject:        introspection.UserID,
+		JTI:            introspection.ID,
+		ServiceAccount: introspection.IsServiceAccount,
+	}
+
+	if introspection.TokenType == entity.TokenTypeAccess {
+		resp.TokenType = "Bearer"
+		resp.IssuedAt = introspection.IssuedAt.Unix()
+	}
+
+	return resp
+}
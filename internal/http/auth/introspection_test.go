@@ -0,0 +1,72 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+func TestIntrospectAndRevoke(t *testing.T) {
+	srv, client := newTestProvider(t, jwt.SigningMethodES256)
+
+	cfg := &clientcredentials.Config{
+		ClientID:     client.ClientID,
+		ClientSecret: clientSecret,
+		TokenURL:     srv.URL + "/token",
+	}
+
+	token, err := cfg.Token(context.Background())
+	require.NoError(t, err)
+
+	post := func(path, secret string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path,
+			strings.NewReader(url.Values{"token": {token.AccessToken}}.Encode()))
+		require.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(client.ClientID, secret)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			resp.Body.Close()
+		})
+
+		return resp
+	}
+
+	introspect := func() map[string]any {
+		resp := post("/introspect", clientSecret)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+		var body map[string]any
+
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+		return body
+	}
+
+	body := introspect()
+	require.Equal(t, true, body["active"])
+	require.Equal(t, "Bearer", body["token_type"])
+	require.Equal(t, client.ClientID, body["sub"])
+	require.Equal(t, true, body["service_account"])
+
+	resp := post("/introspect", "wrong")
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.NotEmpty(t, resp.Header.Get("WWW-Authenticate"))
+
+	resp = post("/revoke", clientSecret)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.Equal(t, map[string]any{"active": false}, introspect())
+}
@@ -0,0 +1,476 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	authService "github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+// oauth error codes, RFC 6749 sections 4.1.2.1 and 5.2, RFC 8628 section 3.5.
+const (
+	errInvalidRequest          = "invalid_request"
+	errInvalidClient           = "invalid_client"
+	errInvalidGrant            = "invalid_grant"
+	errUnauthorizedClient      = "unauthorized_client"
+	errUnsupportedGrantType    = "unsupported_grant_type"
+	errUnsupportedResponseType = "unsupported_response_type"
+	errServerError             = "server_error"
+	errAuthorizationPending    = "authorization_pending"
+	errSlowDown                = "slow_down"
+	errExpiredToken            = "expired_token"
+	errAccessDenied            = "access_denied"
+)
+
+// oauthError is the error response body of the token endpoint.
+type oauthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"` //nolint:tagliatelle
+}
+
+// tokenResponse is the successful response of the token endpoint, RFC 6749 section 5.1.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`            //nolint:tagliatelle
+	TokenType    string `json:"token_type"`              //nolint:tagliatelle
+	ExpiresIn    int64  `json:"expires_in"`              //nolint:tagliatelle
+	RefreshToken string `json:"refresh_token,omitempty"` //nolint:tagliatelle
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"` //nolint:tagliatelle
+}
+
+// authorizeParams are the parameters of an authorization request, kept in
+// hidden fields of the login page between its GET and POST.
+type authorizeParams struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Scope               string
+	Nonce               string
+}
+
+type loginPage struct {
+	Action  string
+	AppName string
+	Params  authorizeParams
+	Error   string
+}
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.AppName}}</title></head>
+<body>
+<h1>Sign in to {{.AppName}}</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="response_type" value="{{.Params.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Params.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Params.RedirectURI}}">
+<input type="hidden" name="state" value="{{.Params.State}}">
+<input type="hidden" name="code_challenge" value="{{.Params.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Params.CodeChallengeMethod}}">
+<input type="hidden" name="scope" value="{{.Params.Scope}}">
+<input type="hidden" name="nonce" value="{{.Params.Nonce}}">
+<label>Email <input type="email" name="email" required autofocus></label>
+<label>Password <input type="password" name="password" required></label>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// AuthorizeForm shows the login page of an authorization request.
+func (h *handlerAPI) AuthorizeForm(w http.ResponseWriter, r *http.Request) {
+	params := readAuthorizeParams(r.URL.Query())
+
+	app, ok := h.checkAuthorizeRequest(w, r, params)
+	if !ok {
+		return
+	}
+
+	h.renderLogin(w, http.StatusOK, loginPage{
+		AppName: app.Name,
+		Params:  params,
+	})
+}
+
+// Authorize logs the user in and redirects back to the client with an
+// authorization code.
+func (h *handlerAPI) Authorize(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+
+		return
+	}
+
+	params := readAuthorizeParams(r.PostForm)
+
+	app, ok := h.checkAuthorizeRequest(w, r, params)
+	if !ok {
+		return
+	}
+
+	code, err := h.auth.Authorize(h.clientIPContext(r), authService.AuthorizationRequest{
+		ClientID:      params.ClientID,
+		RedirectURI:   params.RedirectURI,
+		CodeChallenge: params.CodeChallenge,
+		Scope:         params.Scope,
+		Nonce:         params.Nonce,
+	}, r.PostForm.Get("email"), r.PostForm.Get("password"))
+	if err != nil {
+		switch {
+		case errors.Is(err, authService.ErrLoginThrottled):
+			setRetryAfter(w, err)
+			h.renderLogin(w, http.StatusTooManyRequests, loginPage{
+				AppName: app.Name,
+				Params:  params,
+				Error:   "too many failed attempts, try again later",
+			})
+		case errors.Is(err, authService.ErrInvalidCredentials):
+			h.renderLogin(w, http.StatusUnauthorized, loginPage{
+				AppName: app.Name,
+				Params:  params,
+				Error:   "wrong email or password",
+			})
+		case errors.Is(err, authService.ErrGrantTypeNotAllowed):
+			redirectError(w, r, params, errUnauthorizedClient, "authorization code flow is not allowed for the client")
+		case errors.Is(err, authService.ErrInvalidCodeChallenge):
+			redirectError(w, r, params, errInvalidRequest, "PKCE S256 code challenge is required")
+		default:
+			h.logg.Error("authorization failed", sl.Err(err))
+			redirectError(w, r, params, errServerError, "")
+		}
+
+		return
+	}
+
+	redirect(w, r, params.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {params.State},
+	})
+}
+
+// Token issues tokens for the authorization_code, refresh_token and
+// client_credentials grants.
+func (h *handlerAPI) Token(w http.ResponseWriter, r *http.Request) {
+	// token responses must never be cached, RFC 6749 section 5.1.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	err := r.ParseForm()
+	if err != nil {
+		h.writeOAuthError(w, http.StatusBadRequest, errInvalidRequest, "invalid form")
+
+		return
+	}
+
+	clientID, clientSecret, basicAuth := clientCredentials(r)
+	if clientID == "" {
+		h.writeOAuthError(w, http.StatusUnauthorized, errInvalidClient, "client_id is required")
+
+		return
+	}
+
+	var pair *entity.TokenPair
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case entity.GrantTypeAuthorizationCode:
+		pair, err = h.auth.ExchangeAuthorizationCode(r.Context(), authService.CodeExchange{
+			Code:         r.PostForm.Get("code"),
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURI:  r.PostForm.Get("redirect_uri"),
+			CodeVerifier: r.PostForm.Get("code_verifier"),
+		})
+	case entity.GrantTypeRefreshToken:
+		pair, err = h.auth.RefreshClientTokens(r.Context(),
+			clientID, clientSecret, r.PostForm.Get("refresh_token"))
+	case entity.GrantTypeClientCredentials:
+		pair, err = h.auth.ClientCredentials(r.Context(), clientID, clientSecret)
+	case entity.GrantTypeDeviceCode:
+		pair, err = h.auth.PollDeviceAuthorization(r.Context(),
+			clientID, clientSecret, r.PostForm.Get("device_code"))
+	case "":
+		h.writeOAuthError(w, http.StatusBadRequest, errInvalidRequest, "grant_type is required")
+
+		return
+	default:
+		h.writeOAuthError(w, http.StatusBadRequest, errUnsupportedGrantType, "")
+
+		return
+	}
+
+	if err != nil {
+		h.writeTokenError(w, err, basicAuth)
+
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(pair.ExpiresIn.Seconds()),
+		RefreshToken: pair.RefreshToken,
+		Scope:        pair.Scope,
+		IDToken:      pair.IDToken,
+	})
+}
+
+// checkAuthorizeRequest validates an authorization request. Errors about the
+// client or redirect uri are shown to the user, the rest is redirected back to
+// the client, RFC 6749 section 4.1.2.1.
+func (h *handlerAPI) checkAuthorizeRequest(w http.ResponseWriter,
+	r *http.Request,
+	params authorizeParams) (*entity.App, bool) {
+	app, err := h.auth.AuthorizeClient(r.Context(), params.ClientID, params.RedirectURI)
+	if err != nil {
+		switch {
+		case errors.Is(err, authService.ErrInvalidClient),
+			errors.Is(err, authService.ErrInvalidRedirectURI):
+			http.Error(w, "unknown client or redirect uri", http.StatusBadRequest)
+		default:
+			h.logg.Error("failed to check client", sl.Err(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+
+		return nil, false
+	}
+
+	if params.ResponseType != "code" {
+		redirectError(w, r, params, errUnsupportedResponseType, "only response_type=code is supported")
+
+		return nil, false
+	}
+
+	if params.CodeChallengeMethod != tokens.PKCEMethodS256 || !tokens.IsCodeChallenge(params.CodeChallenge) {
+		redirectError(w, r, params, errInvalidRequest, "PKCE S256 code challenge is required")
+
+		return nil, false
+	}
+
+	return app, true
+}
+
+func (h *handlerAPI) renderLogin(w http.ResponseWriter, code int, page loginPage) {
+	page.Action = authorizePath
+
+	h.renderPage(w, code, loginTemplate, page)
+}
+
+func (h *handlerAPI) renderPage(w http.ResponseWriter,
+	code int,
+	tmpl *template.Template,
+	data any) {
+	// credentials are typed here, the page must not be framed by other sites.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; form-action 'self'; frame-ancestors 'none'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+
+	err := tmpl.Execute(w, data)
+	if err != nil {
+		h.logg.Warn("failed to render page", slog.String("page", tmpl.Name()), sl.Err(err))
+	}
+}
+
+func (h *handlerAPI) writeTokenError(w http.ResponseWriter, err error, basicAuth bool) {
+	switch {
+	case errors.Is(err, authService.ErrInvalidClient):
+		if basicAuth {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+
+		h.writeOAuthError(w, http.StatusUnauthorized, errInvalidClient, "")
+	case errors.Is(err, authService.ErrGrantTypeNotAllowed):
+		h.writeOAuthError(w, http.StatusBadRequest, errUnauthorizedClient, "")
+	case errors.Is(err, authService.ErrAuthorizationPending):
+		h.writeOAuthError(w, http.StatusBadRequest, errAuthorizationPending, "")
+	case errors.Is(err, authService.ErrSlowDown):
+		h.writeOAuthError(w, http.StatusBadRequest, errSlowDown, "")
+	case errors.Is(err, authService.ErrExpiredToken):
+		h.writeOAuthError(w, http.StatusBadRequest, errExpiredToken, "")
+	case errors.Is(err, authService.ErrAccessDenied):
+		h.writeOAuthError(w, http.StatusBadRequest, errAccessDenied, "")
+	case errors.Is(err, authService.ErrInvalidGrant),
+		errors.Is(err, authService.ErrMalformedRefreshToken),
+		errors.Is(err, authService.ErrRefreshTokenNotFound),
+		errors.Is(err, authService.ErrInvalidRefreshToken),
+		errors.Is(err, authService.ErrRefreshTokenReused),
+		errors.Is(err, authService.ErrAppMismatch):
+		h.writeOAuthError(w, http.StatusBadRequest, errInvalidGrant, "")
+	default:
+		h.logg.Error("token request failed", sl.Err(err))
+		h.writeOAuthError(w, http.StatusInternalServerError, errServerError, "")
+	}
+}
+
+func (h *handlerAPI) writeOAuthError(w http.ResponseWriter, code int, oauthErr, description string) {
+	h.writeJSON(w, code, oauthError{
+		Error:       oauthErr,
+		Description: description,
+	})
+}
+
+func readAuthorizeParams(values url.Values) authorizeParams {
+	return authorizeParams{
+		ResponseType:        values.Get("response_type"),
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Scope:               values.Get("scope"),
+		Nonce:               values.Get("nonce"),
+	}
+}
+
+// clientCredentials reads client_secret_basic or client_secret_post credentials,
+// RFC 6749 section 2.3.1.
+func clientCredentials(r *http.Request) (clientID, clientSecret string, basicAuth bool) {
+	clientID, clientSecret, basicAuth = r.BasicAuth()
+	if !basicAuth {
+		return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), false
+	}
+
+	// basic auth credentials are form-urlencoded before encoding.
+	if decoded, err := url.QueryUnescape(clientID); err == nil {
+		clientID = decoded
+	}
+
+	if decoded, err := url.QueryUnescape(clientSecret); err == nil {
+		clientSecret = decoded
+	}
+
+	return clientID, clientSecret, true
+}
+
+// ClientIPConfig tells where the address of the end user is found. Behind a
+// reverse proxy every request comes from the proxy, so the address is read
+// from Header of requests sent by one of TrustedProxies. Without Header the
+// peer address is used.
+type ClientIPConfig struct {
+	Header         string
+	TrustedProxies []netip.Prefix
+}
+
+// clientIPContext returns the request context carrying the address of the
+// client, failed logins are throttled per address.
+func (h *handlerAPI) clientIPContext(r *http.Request) context.Context {
+	if ip := h.clientIP.of(r); ip != "" {
+		return authService.WithClientIP(r.Context(), ip)
+	}
+
+	return r.Context()
+}
+
+// of returns the address of the end user of r. The header is read from the
+// right, as each proxy appends the address it got the request from; the first
+// address not of a trusted proxy is the client. Returns "" if a trusted proxy
+// sent no valid address, such logins are throttled per account only.
+func (c ClientIPConfig) of(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if c.Header == "" || err != nil || !c.trusted(peer.Unmap()) {
+		return host
+	}
+
+	entries := strings.Split(strings.Join(r.Header.Values(c.Header), ","), ",")
+
+	var client netip.Addr
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(entries[i]))
+		if err != nil {
+			break
+		}
+
+		client = addr.Unmap()
+		if !c.trusted(client) {
+			break
+		}
+	}
+
+	if !client.IsValid() {
+		return ""
+	}
+
+	return client.String()
+}
+
+func (c ClientIPConfig) trusted(addr netip.Addr) bool {
+	for _, proxy := range c.TrustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setRetryAfter sets the seconds to wait before the next login attempt.
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var throttled *authService.LoginThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.FormatInt(throttled.RetryAfterSeconds(), 10))
+	}
+}
+
+func redirectError(w http.ResponseWriter,
+	r *http.Request,
+	params authorizeParams,
+	oauthErr, description string) {
+	query := url.Values{
+		"error": {oauthErr},
+		"state": {params.State},
+	}
+
+	if description != "" {
+		query.Set("error_description", description)
+	}
+
+	redirect(w, r, params.RedirectURI, query)
+}
+
+// redirect sends the user agent back to the registered redirect uri, keeping
+// its own query parameters.
+func redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect uri", http.StatusBadRequest)
+
+		return
+	}
+
+	query := target.Query()
+
+	for key, values := range params {
+		if len(values) == 1 && values[0] == "" {
+			continue
+		}
+
+		query[key] = values
+	}
+
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusSeeOther)
+}
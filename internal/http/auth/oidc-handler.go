@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	authService "github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+// OpenIDConfiguration serves the OpenID Connect discovery document.
+func (h *handlerAPI) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	config, err := h.auth.OpenIDConfiguration(r.Context())
+	if err != nil {
+		if errors.Is(err, authService.ErrOpenIDDisabled) {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		h.logg.Error("failed to get openid configuration", sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+
+		return
+	}
+
+	// endpoints are served by this server at the issuer url.
+	base := strings.TrimSuffix(config.Issuer, "/")
+
+	config.AuthorizationEndpoint = base + authorizePath
+	config.TokenEndpoint = base + tokenPath
+	config.UserinfoEndpoint = base + userInfoPath
+	config.JWKSURI = base + jwksPath
+	config.IntrospectionEndpoint = base + introspectPath
+	config.RevocationEndpoint = base + revokePath
+
+	if slices.Contains(config.GrantTypesSupported, entity.GrantTypeDeviceCode) {
+		config.DeviceAuthorizationEndpoint = base + deviceAuthorizationPath
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.writeJSON(w, http.StatusOK, config)
+}
+
+// UserInfo returns claims about the owner of a bearer access token.
+func (h *handlerAPI) UserInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		// no error code without credentials, RFC 6750 section 3.1.
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	info, err := h.auth.UserInfo(r.Context(), accessToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, authService.ErrInsufficientScope):
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, authService.ErrInvalidAccessToken),
+			errors.Is(err, authService.ErrAccessTokenExpired),
+			errors.Is(err, authService.ErrAccessTokenRevoked):
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			h.logg.Error("failed to get user info", sl.Err(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeJSON(w, http.StatusOK, info)
+}
+
+// bearerToken reads an access token from the Authorization header,
+// RFC 6750 section 2.1.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
@@ -0,0 +1,275 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	httpAuth "github.com/aspirin100/gRPC-SSO/internal/http/auth"
+	"github.com/aspirin100/gRPC-SSO/internal/passwords"
+	"github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens/tokenstest"
+)
+
+const (
+	testEmail    = "oidc@test.com"
+	testPassword = "password"
+	clientSecret = "client_secret"
+	redirectURL  = "https://rp.test/callback"
+)
+
+// TestOpenIDConnectFlow runs a relying party library through discovery, the
+// authorization code flow, ID token verification, userinfo and refresh.
+func TestOpenIDConnectFlow(t *testing.T) {
+	srv, client := newTestProvider(t, jwt.SigningMethodES256)
+	ctx := context.Background()
+
+	provider, err := oidc.NewProvider(ctx, srv.URL)
+	require.NoError(t, err)
+
+	cfg := &oauth2.Config{
+		ClientID:     client.ClientID,
+		ClientSecret: clientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}
+	idTokenVerifier := provider.Verifier(&oidc.Config{ClientID: client.ClientID})
+
+	codeVerifier := oauth2.GenerateVerifier()
+	code := authorize(t, srv, cfg.AuthCodeURL("xyz",
+		oauth2.S256ChallengeOption(codeVerifier), oidc.Nonce("n-0S6_WzA2Mj")))
+
+	token, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	require.NoError(t, err)
+	require.Equal(t, "openid email profile", token.Extra("scope"))
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	require.True(t, ok)
+
+	idToken, err := idTokenVerifier.Verify(ctx, rawIDToken)
+	require.NoError(t, err)
+	require.Equal(t, "n-0S6_WzA2Mj", idToken.Nonce)
+
+	var claims struct {
+		Email             string `json:"email"`
+		PreferredUsername string `json:"preferred_username"` //nolint:tagliatelle
+	}
+
+	require.NoError(t, idToken.Claims(&claims))
+	require.Equal(t, testEmail, claims.Email)
+	require.Equal(t, testEmail, claims.PreferredUsername)
+
+	userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+	require.NoError(t, err)
+	require.Equal(t, idToken.Subject, userInfo.Subject)
+	require.Equal(t, testEmail, userInfo.Email)
+
+	// an expired token makes the token source refresh it.
+	token.Expiry = time.Now().Add(-time.Second)
+
+	refreshed, err := cfg.TokenSource(ctx, token).Token()
+	require.NoError(t, err)
+	require.NotEqual(t, token.RefreshToken, refreshed.RefreshToken)
+
+	rawIDToken, ok = refreshed.Extra("id_token").(string)
+	require.True(t, ok)
+
+	idToken, err = idTokenVerifier.Verify(ctx, rawIDToken)
+	require.NoError(t, err)
+	require.Empty(t, idToken.Nonce)
+
+	// the code is single use.
+	_, err = cfg.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+
+	var retrieveErr *oauth2.RetrieveError
+
+	require.True(t, errors.As(err, &retrieveErr))
+	require.Equal(t, "invalid_grant", retrieveErr.ErrorCode)
+}
+
+func TestUserInfoScope(t *testing.T) {
+	srv, client := newTestProvider(t, jwt.SigningMethodES256)
+	ctx := context.Background()
+
+	cfg := &oauth2.Config{
+		ClientID:     client.ClientID,
+		ClientSecret: clientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   srv.URL + "/authorize",
+			TokenURL:  srv.URL + "/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+		RedirectURL: redirectURL,
+	}
+
+	// a plain oauth login, without the openid scope.
+	codeVerifier := oauth2.GenerateVerifier()
+	code := authorize(t, srv, cfg.AuthCodeURL("xyz", oauth2.S256ChallengeOption(codeVerifier)))
+
+	token, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	require.NoError(t, err)
+	require.Nil(t, token.Extra("id_token"))
+
+	cases := []struct {
+		testName       string
+		authorization  string
+		expectedStatus int
+		expectedHeader string
+	}{
+		{
+			testName:       "no token case",
+			expectedStatus: http.StatusUnauthorized,
+			expectedHeader: "Bearer",
+		},
+		{
+			testName:       "invalid token case",
+			authorization:  "Bearer invalid",
+			expectedStatus: http.StatusUnauthorized,
+			expectedHeader: `Bearer error="invalid_token"`,
+		},
+		{
+			testName:       "no openid scope case",
+			authorization:  "Bearer " + token.AccessToken,
+			expectedStatus: http.StatusForbidden,
+			expectedHeader: `Bearer error="insufficient_scope", scope="openid"`,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/userinfo", nil)
+			require.NoError(t, err)
+
+			if tcase.authorization != "" {
+				req.Header.Set("Authorization", tcase.authorization)
+			}
+
+			resp, err := srv.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			require.Equal(t, tcase.expectedStatus, resp.StatusCode)
+			require.Equal(t, tcase.expectedHeader, resp.Header.Get("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestOpenIDConfigurationSymmetricKey(t *testing.T) {
+	srv, _ := newTestProvider(t, jwt.SigningMethodHS256)
+
+	// ID tokens signed with a shared secret can't be verified by relying parties.
+	resp, err := srv.Client().Get(srv.URL + "/.well-known/openid-configuration")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// authorize logs the test user in through the login page and returns the
+// authorization code.
+func authorize(t *testing.T, srv *httptest.Server, authURL string) string {
+	t.Helper()
+
+	httpClient := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := httpClient.Get(authURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "DENY", resp.Header.Get("X-Frame-Options"))
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+
+	form := parsed.Query()
+	form.Set("email", testEmail)
+	form.Set("password", testPassword)
+
+	resp, err = httpClient.PostForm(srv.URL+"/authorize", form)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+
+	location, err := resp.Location()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(location.String(), redirectURL+"?"))
+	require.Equal(t, form.Get("state"), location.Query().Get("state"))
+	require.NotEmpty(t, location.Query().Get("code"))
+
+	return location.Query().Get("code")
+}
+
+// newTestProvider serves the http handlers over an empty migrated database
+// with a registered user and client. The server url is the issuer.
+func newTestProvider(t *testing.T, method jwt.SigningMethod) (*httptest.Server, *entity.App) {
+	t.Helper()
+
+	ctx := context.Background()
+	storagePath := filepath.Join(t.TempDir(), "sso.db")
+
+	require.NoError(t, storage.MigrateUp(storage.DriverSQLite, storagePath))
+
+	logg := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	strg, err := storage.New(logg, storage.DriverSQLite, storagePath, []byte("test_hash_key"))
+	require.NoError(t, err)
+
+	key, err := tokens.NewSecretKey("test_secret_key")
+	if method != jwt.SigningMethodHS256 {
+		key, err = tokenstest.GenerateSigningKey(method)
+	}
+
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	hasher := passwords.NewArgon2id(passwords.DefaultArgon2idParams, 0)
+
+	authService := auth.New(logg, strg, tokens.NewKeyRing(key, time.Minute), hasher, auth.TokenConfig{
+		AccessTTL:       time.Minute,
+		RefreshTTL:      time.Hour,
+		Issuer:          srv.URL,
+		VerificationURI: srv.URL + httpAuth.DevicePath,
+	})
+
+	httpAuth.RegisterAuthHandlers(mux, logg, authService, httpAuth.ClientIPConfig{})
+
+	_, err = authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	secretHash, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	client, err := strg.SaveApp(ctx, &entity.App{
+		Name:             "relying party",
+		ClientSecretHash: secretHash,
+		RedirectURIs:     []string{redirectURL},
+	})
+	require.NoError(t, err)
+
+	return srv, client
+}
@@ -0,0 +1,221 @@
+package passwords
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrMismatch         = errors.New("password does not match")
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrMalformedHash    = errors.New("malformed password hash")
+)
+
+// PasswordHasher hashes passwords into PHC strings, which carry the algorithm
+// and its parameters, so hashes made with other parameters still verify.
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	// Verify returns ErrMismatch for a wrong password. needsRehash reports a
+	// hash made with another algorithm or parameters than Hash uses now.
+	Verify(passHash []byte, password string) (needsRehash bool, err error)
+}
+
+// Argon2idParams of hashes, memory is in KiB.
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLen     uint32
+	KeyLen      uint32
+}
+
+// DefaultArgon2idParams is the second recommended option of RFC 9106, for
+// memory constrained environments.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLen:     16,
+	KeyLen:      32,
+}
+
+const argon2idID = "argon2id"
+
+// Argon2id hashes passwords with Argon2id. It verifies Argon2id hashes of any
+// parameters and bcrypt hashes stored before it, both need rehashing then.
+type Argon2id struct {
+	params Argon2idParams
+	// every hash holds params.Memory KiB, at most cap(slots) run at once so
+	// a burst of logins can not exhaust memory. Others wait for a slot.
+	slots chan struct{}
+	// compared with wrong passwords of Argon2id hashes, see Verify.
+	dummyBcryptHash func() ([]byte, error)
+}
+
+// NewArgon2id returns a hasher running at most maxConcurrent hashes at once,
+// the number of CPUs if maxConcurrent is not positive.
+func NewArgon2id(params Argon2idParams, maxConcurrent int) *Argon2id {
+	if maxConcurrent <= 0 {
+		maxConcurrent = runtime.NumCPU()
+	}
+
+	return &Argon2id{
+		params: params,
+		slots:  make(chan struct{}, maxConcurrent),
+		dummyBcryptHash: sync.OnceValues(func() ([]byte, error) {
+			return bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+		}),
+	}
+}
+
+// acquire waits for a hashing slot and returns its release.
+func (h *Argon2id) acquire() func() {
+	h.slots <- struct{}{}
+
+	return func() { <-h.slots }
+}
+
+// Hash returns the PHC string of password,
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+func (h *Argon2id) Hash(password string) ([]byte, error) {
+	const op = "passwords.Argon2id.Hash"
+
+	salt := make([]byte, h.params.SaltLen)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	release := h.acquire()
+	key := argon2.IDKey([]byte(password), salt,
+		h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLen)
+	release()
+
+	return []byte(fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idID, argon2.Version,
+		h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))), nil
+}
+
+// Verify checks password against a hash of either algorithm. A wrong password
+// costs an Argon2id and a bcrypt run whatever the hash, so the response time
+// does not tell accounts with legacy hashes from others or from unknown ones,
+// whose callers verify a dummy Argon2id hash.
+func (h *Argon2id) Verify(passHash []byte, password string) (bool, error) {
+	switch {
+	case bytes.HasPrefix(passHash, []byte("$"+argon2idID+"$")):
+		needsRehash, err := h.verifyArgon2id(passHash, password)
+		if errors.Is(err, ErrMismatch) {
+			h.compareDummyBcrypt(password)
+		}
+
+		return needsRehash, err
+	case isBcrypt(passHash):
+		release := h.acquire()
+		err := bcrypt.CompareHashAndPassword(passHash, []byte(password))
+		release()
+
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			h.dummyArgon2id(password)
+
+			return false, ErrMismatch
+		}
+
+		if err != nil {
+			return false, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+		}
+
+		return true, nil
+	default:
+		return false, ErrUnknownAlgorithm
+	}
+}
+
+func (h *Argon2id) verifyArgon2id(passHash []byte, password string) (bool, error) {
+	var (
+		version int
+		params  Argon2idParams
+	)
+
+	// salt and key are unpadded base64, "$" never occurs in them.
+	parts := bytes.Split(passHash, []byte("$"))
+	if len(parts) != 6 { //nolint:mnd
+		return false, ErrMalformedHash
+	}
+
+	_, err := fmt.Sscanf(string(parts[2]), "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return false, ErrMalformedHash
+	}
+
+	_, err = fmt.Sscanf(string(parts[3]), "m=%d,t=%d,p=%d",
+		&params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations == 0 || params.Parallelism == 0 {
+		return false, ErrMalformedHash
+	}
+
+	saltBytes, err := base64.RawStdEncoding.DecodeString(string(parts[4]))
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+
+	keyBytes, err := base64.RawStdEncoding.DecodeString(string(parts[5]))
+	if err != nil || len(keyBytes) == 0 {
+		return false, ErrMalformedHash
+	}
+
+	params.SaltLen = uint32(len(saltBytes)) //nolint:gosec
+	params.KeyLen = uint32(len(keyBytes))   //nolint:gosec
+
+	release := h.acquire()
+	computed := argon2.IDKey([]byte(password), saltBytes,
+		params.Iterations, params.Memory, params.Parallelism, params.KeyLen)
+	release()
+
+	if subtle.ConstantTimeCompare(computed, keyBytes) != 1 {
+		return false, ErrMismatch
+	}
+
+	return params != h.params, nil
+}
+
+// compareDummyBcrypt spends the time of a bcrypt comparison.
+func (h *Argon2id) compareDummyBcrypt(password string) {
+	dummyHash, err := h.dummyBcryptHash()
+	if err != nil {
+		return
+	}
+
+	release := h.acquire()
+	defer release()
+
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// dummyArgon2id spends the time of an Argon2id hash with the current params.
+func (h *Argon2id) dummyArgon2id(password string) {
+	salt := make([]byte, h.params.SaltLen)
+
+	release := h.acquire()
+	defer release()
+
+	argon2.IDKey([]byte(password), salt,
+		h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLen)
+}
+
+// isBcrypt reports the $2a$, $2b$ and $2y$ prefixes of bcrypt hashes.
+func isBcrypt(passHash []byte) bool {
+	return len(passHash) > 4 && passHash[0] == '$' && passHash[1] == '2' &&
+		passHash[3] == '$' && bytes.IndexByte([]byte("aby"), passHash[2]) >= 0
+}
@@ -0,0 +1,147 @@
+package passwords_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/aspirin100/gRPC-SSO/internal/passwords"
+)
+
+// cheap parameters, hashing with the defaults takes long in tests.
+var testParams = passwords.Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLen:     16,
+	KeyLen:      32,
+}
+
+func TestArgon2id(t *testing.T) {
+	hasher := passwords.NewArgon2id(testParams, 0)
+
+	passHash, err := hasher.Hash("password")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(passHash), "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	needsRehash, err := hasher.Verify(passHash, "password")
+	require.NoError(t, err)
+	require.False(t, needsRehash)
+
+	_, err = hasher.Verify(passHash, "wrong-password")
+	require.ErrorIs(t, err, passwords.ErrMismatch)
+
+	// salted, the same password hashes differently.
+	other, err := hasher.Hash("password")
+	require.NoError(t, err)
+	require.NotEqual(t, passHash, other)
+}
+
+func TestArgon2idConcurrency(t *testing.T) {
+	// hashes beyond the limit wait for a slot instead of failing.
+	hasher := passwords.NewArgon2id(testParams, 1)
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, 8)
+
+	for range cap(errs) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			passHash, err := hasher.Hash("password")
+			if err != nil {
+				errs <- err
+
+				return
+			}
+
+			_, err = hasher.Verify(passHash, "password")
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	hasher := passwords.NewArgon2id(testParams, 0)
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	stronger := testParams
+	stronger.Iterations = 2
+
+	strongerHash, err := passwords.NewArgon2id(stronger, 0).Hash("password")
+	require.NoError(t, err)
+
+	cases := []struct {
+		testName            string
+		passHash            []byte
+		password            string
+		expectedNeedsRehash bool
+		expectedErr         error
+	}{
+		{
+			testName:            "bcrypt case",
+			passHash:            bcryptHash,
+			password:            "password",
+			expectedNeedsRehash: true,
+		},
+		{
+			testName:    "bcrypt mismatch case",
+			passHash:    bcryptHash,
+			password:    "wrong-password",
+			expectedErr: passwords.ErrMismatch,
+		},
+		{
+			testName:            "other parameters case",
+			passHash:            strongerHash,
+			password:            "password",
+			expectedNeedsRehash: true,
+		},
+		{
+			testName:    "unknown algorithm case",
+			passHash:    []byte("$scrypt$ln=16,r=8,p=1$c2FsdA$aGFzaA"),
+			password:    "password",
+			expectedErr: passwords.ErrUnknownAlgorithm,
+		},
+		{
+			testName:    "malformed parameters case",
+			passHash:    []byte("$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$aGFzaA"),
+			password:    "password",
+			expectedErr: passwords.ErrMalformedHash,
+		},
+		{
+			testName:    "unsupported version case",
+			passHash:    []byte("$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$aGFzaA"),
+			password:    "password",
+			expectedErr: passwords.ErrMalformedHash,
+		},
+		{
+			testName:    "missing key case",
+			passHash:    []byte("$argon2id$v=19$m=1024,t=1,p=1$c2FsdA"),
+			password:    "password",
+			expectedErr: passwords.ErrMalformedHash,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			needsRehash, err := hasher.Verify(tcase.passHash, tcase.password)
+			require.ErrorIs(t, err, tcase.expectedErr)
+			require.Equal(t, tcase.expectedNeedsRehash, needsRehash)
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+var (
+	ErrAppNotFound = errors.New("app not found")
+	ErrAppExists   = errors.New("app already exists")
+	// tokens would outlive the signing key that verifies them.
+	ErrAccessTTLTooLong = errors.New("access ttl exceeds signing key retention")
+	// tokens would carry another app's id as audience.
+	ErrAudienceIsAppID = errors.New("audience must not be numeric, app ids are")
+)
+
+// Apps registers and manages apps, the oauth clients of the service.
+// Every method is admin only.
+type Apps struct {
+	logg       *slog.Logger
+	appManager AppManager
+	authorizer AdminAuthorizer
+	// longest access token ttl of an app, the signing key retention.
+	maxAccessTTL time.Duration
+}
+
+// storage interfaces.
+type AppManager interface {
+	SaveApp(ctx context.Context, app *entity.App) (*entity.App, error)
+	GetApp(ctx context.Context, appID int32) (*entity.App, error)
+	UpdateApp(ctx context.Context, app *entity.App) error
+	ListApps(ctx context.Context) ([]entity.App, error)
+	DeleteApp(ctx context.Context, appID int32) error
+}
+
+// AdminAuthorizer checks the access token of an admin rpc caller.
+type AdminAuthorizer interface {
+	AuthorizeAdmin(ctx context.Context,
+		adminToken string, appID int32) (*entity.TokenClaims, error)
+}
+
+// Admin is the access token of an admin and the app it is issued for.
+type Admin struct {
+	Token string
+	AppID int32
+}
+
+func New(logg *slog.Logger,
+	appManager AppManager,
+	authorizer AdminAuthorizer,
+	maxAccessTTL time.Duration) *Apps {
+	return &Apps{
+		logg:         logg,
+		appManager:   appManager,
+		authorizer:   authorizer,
+		maxAccessTTL: maxAccessTTL,
+	}
+}
+
+// CreateApp registers an app and generates its client id and secret.
+// The secret is only returned here, just its hash is stored.
+func (a *Apps) CreateApp(ctx context.Context,
+	admin Admin,
+	app *entity.App) (*entity.App, string, error) {
+	const op = "service/apps.CreateApp"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	claims, err := a.authorizer.AuthorizeAdmin(ctx, admin.Token, admin.AppID)
+	if err != nil {
+		return nil, "", err //nolint:wrapcheck
+	}
+
+	err = a.checkTokenPolicy(app)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, secretHash, err := NewClientSecret()
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	app.ClientSecretHash = secretHash
+
+	saved, err := a.appManager.SaveApp(ctx, app)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppExists) {
+			logg.Info("app already exists", sl.Err(err))
+
+			return nil, "", ErrAppExists //nolint:wrapcheck
+		}
+
+		if errors.Is(err, storage.ErrAppIDTaken) {
+			logg.Error("app id sequence is behind apps inserted with explicit ids", sl.Err(err))
+		}
+
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	logg.Info("app created",
+		slog.String("adminID", claims.UserID),
+		slog.Int("appID", int(saved.ID)),
+		slog.String("clientID", saved.ClientID))
+
+	return saved, secret, nil
+}
+
+// UpdateApp replaces the name, redirect uris and token policy of an app. With
+// rotateSecret a new client secret replaces the old one and is returned.
+func (a *Apps) UpdateApp(ctx context.Context,
+	admin Admin,
+	app *entity.App,
+	rotateSecret bool) (*entity.App, string, error) {
+	const op = "service/apps.UpdateApp"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	claims, err := a.authorizer.AuthorizeAdmin(ctx, admin.Token, admin.AppID)
+	if err != nil {
+		return nil, "", err //nolint:wrapcheck
+	}
+
+	err = a.checkTokenPolicy(app)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var secret string
+
+	// a nil hash keeps the stored one
+	app.ClientSecretHash = nil
+
+	if rotateSecret {
+		secret, app.ClientSecretHash, err = NewClientSecret()
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = a.appManager.UpdateApp(ctx, app)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrAppNotFound):
+			return nil, "", ErrAppNotFound //nolint:wrapcheck
+		case errors.Is(err, storage.ErrAppExists):
+			return nil, "", ErrAppExists //nolint:wrapcheck
+		default:
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	updated, err := a.appManager.GetApp(ctx, app.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	logg.Info("app updated",
+		slog.String("adminID", claims.UserID),
+		slog.Int("appID", int(app.ID)),
+		slog.Bool("secretRotated", rotateSecret))
+
+	return updated, secret, nil
+}
+
+// ListApps returns every registered app.
+func (a *Apps) ListApps(ctx context.Context, admin Admin) ([]entity.App, error) {
+	const op = "service/apps.ListApps"
+
+	_, err := a.authorizer.AuthorizeAdmin(ctx, admin.Token, admin.AppID)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	apps, err := a.appManager.ListApps(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apps, nil
+}
+
+// DeleteApp removes an app, its refresh sessions end with it.
+func (a *Apps) DeleteApp(ctx context.Context, admin Admin, appID int32) error {
+	const op = "service/apps.DeleteApp"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	claims, err := a.authorizer.AuthorizeAdmin(ctx, admin.Token, admin.AppID)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	err = a.appManager.DeleteApp(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return ErrAppNotFound //nolint:wrapcheck
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logg.Info("app deleted",
+		slog.String("adminID", claims.UserID),
+		slog.Int("appID", int(appID)))
+
+	return nil
+}
+
+func (a *Apps) checkTokenPolicy(app *entity.App) error {
+	if a.maxAccessTTL > 0 && app.AccessTTL > a.maxAccessTTL {
+		return fmt.Errorf("%w: %s > %s", ErrAccessTTLTooLong, app.AccessTTL, a.maxAccessTTL)
+	}
+
+	// the aud claim of every access token starts with the decimal app id.
+	if isNumeric(app.Audience) {
+		return fmt.Errorf("%w: %q", ErrAudienceIsAppID, app.Audience)
+	}
+
+	return nil
+}
+
+// isNumeric reports a signed or unsigned decimal number of any length.
+func isNumeric(value string) bool {
+	digits := strings.TrimLeft(value, "+-")
+
+	return digits != "" && strings.Trim(digits, "0123456789") == ""
+}
+
+// NewClientSecret generates an app client secret and its bcrypt hash.
+func NewClientSecret() (string, []byte, error) {
+	secret, err := tokens.NewClientSecret()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create client secret: %w", err)
+	}
+
+	secretHash, err := bcrypt.GenerateFromPassword([]byte(*secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", nil, fmt.Errorf("client secret hashing error: %w", err)
+	}
+
+	return *secret, secretHash, nil
+}
@@ -5,30 +5,56 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
 
 	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/passwords"
 	"github.com/aspirin100/gRPC-SSO/internal/storage"
 	"github.com/aspirin100/gRPC-SSO/internal/tokens"
 	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
 )
 
 var (
-	ErrInvalidCredentials   = errors.New("invalid credentials")
-	ErrInvalidPassword      = errors.New("wrong password")
-	ErrUserExists           = errors.New("user already exists")
-	ErrRefreshTokenNotFound = errors.New("refresh token not found")
-	ErrInvalidRefreshToken  = errors.New("invalid refresh token")
+	ErrInvalidCredentials    = errors.New("invalid credentials")
+	ErrUserExists            = errors.New("user already exists")
+	ErrRefreshTokenNotFound  = errors.New("refresh token not found")
+	ErrInvalidRefreshToken   = errors.New("invalid refresh token")
+	ErrMalformedRefreshToken = errors.New("malformed refresh token")
+	ErrRefreshTokenReused    = errors.New("refresh token reuse detected")
+	ErrInvalidAccessToken    = errors.New("invalid access token")
+	ErrAccessTokenExpired    = errors.New("access token expired")
+	ErrAppMismatch           = errors.New("token is issued for another app")
+	ErrAccessTokenRevoked    = errors.New("access token revoked")
+	ErrPermissionDenied      = errors.New("admin rights required")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrInvalidTargetToken    = errors.New("token to revoke is invalid")
+	ErrAppNotFound           = errors.New("app not found")
+	ErrGrantTypeNotAllowed   = errors.New("grant type is not allowed for the app")
 )
 
 type Auth struct {
 	logg        *slog.Logger
 	authManager AuthManager
-	secretKey   string
-	accessTTL   time.Duration
-	refreshTTL  time.Duration
+	keyRing     *tokens.KeyRing
+	hasher      passwords.PasswordHasher
+	tokenCfg    TokenConfig
+	// compared with passwords of unknown users, made on first use.
+	dummyPassHash func() ([]byte, error)
+}
+
+// TokenConfig holds parameters of issued tokens. TTLs are defaults for apps
+// without their own token policy.
+type TokenConfig struct {
+	AccessTTL    time.Duration
+	RefreshTTL   time.Duration
+	Issuer       string // iss claim of access tokens
+	LegacyClaims bool   // also emit pre RFC 7519 appID, userID and expiresAt claims
+	// page users approve device codes at, the device flow is disabled if empty.
+	VerificationURI string
+	LoginThrottle   LoginThrottleConfig
 }
 
 type AuthManager interface {
@@ -36,6 +62,10 @@ type AuthManager interface {
 	UserProvider
 	AppProvider
 	RefreshSessionManager
+	AccessTokenRevoker
+	AuthorizationCodeManager
+	DeviceAuthorizationManager
+	LoginFailureCounter
 }
 
 // storage interfaces.
@@ -43,34 +73,65 @@ type UserSaver interface {
 	SaveUser(ctx context.Context,
 		email string,
 		passHash []byte) (userID string, err error)
+	UpdatePasswordHash(ctx context.Context, userID string, passHash []byte) error
 }
 
 type UserProvider interface {
 	IsAdmin(ctx context.Context, userID string) (*bool, error)
 	GetUser(ctx context.Context, email string) (*entity.User, error)
+	GetUserByID(ctx context.Context, userID string) (*entity.User, error)
 }
 
 type AppProvider interface {
 	GetApp(ctx context.Context, appID int32) (*entity.App, error)
+	GetAppByClientID(ctx context.Context, clientID string) (*entity.App, error)
 }
 
 type RefreshSessionManager interface {
-	NewRefreshSession(ctx context.Context,
-		refreshToken, userID string, refreshTTL time.Duration) error
-	ValidateRefreshToken(ctx context.Context, userID, refreshToken string) error
+	NewRefreshSession(ctx context.Context, session *entity.RefreshSession) error
+	RotateRefreshSession(ctx context.Context,
+		refreshToken, userID string,
+		next *entity.RefreshSession) (*entity.RefreshSession, error)
+	GetRefreshSession(ctx context.Context, refreshToken string) (*entity.RefreshSession, error)
+	RevokeRefreshFamily(ctx context.Context, familyID string) error
+	RevokeRefreshFamilyByToken(ctx context.Context, refreshToken string) error
+	RevokeUserRefreshSessions(ctx context.Context, userID string, appID int32) (int64, error)
+}
+
+type AccessTokenRevoker interface {
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	SetTokensValidAfter(ctx context.Context, userID string, validAfter time.Time) error
+	TokensValidAfter(ctx context.Context, userID string) (time.Time, error)
+}
+
+type AuthorizationCodeManager interface {
+	SaveAuthorizationCode(ctx context.Context, code *entity.AuthorizationCode) error
+	ConsumeAuthorizationCode(ctx context.Context, code string) (*entity.AuthorizationCode, error)
+}
+
+type DeviceAuthorizationManager interface {
+	SaveDeviceAuthorization(ctx context.Context, auth *entity.DeviceAuthorization) error
+	GetDeviceAuthorization(ctx context.Context, userCode string) (*entity.DeviceAuthorization, error)
+	DecideDeviceAuthorization(ctx context.Context, userCode, userID string, approved bool) error
+	PollDeviceAuthorization(ctx context.Context,
+		deviceCode string, appID int32) (*entity.DeviceAuthorization, error)
 }
 
 func New(logg *slog.Logger,
 	authManager AuthManager,
-	accessTTL,
-	refreshTTL time.Duration,
-	secretKey string) *Auth {
+	keyRing *tokens.KeyRing,
+	hasher passwords.PasswordHasher,
+	tokenCfg TokenConfig) *Auth {
 	return &Auth{
 		logg:        logg,
 		authManager: authManager,
-		accessTTL:   accessTTL,
-		refreshTTL:  refreshTTL,
-		secretKey:   secretKey,
+		keyRing:     keyRing,
+		hasher:      hasher,
+		tokenCfg:    tokenCfg,
+		dummyPassHash: sync.OnceValues(func() ([]byte, error) {
+			return hasher.Hash("dummy password")
+		}),
 	}
 }
 
@@ -82,7 +143,7 @@ func (a *Auth) RegisterUser(ctx context.Context,
 
 	logg := a.logg.With(slog.String("op", op))
 
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	passHash, err := a.hasher.Hash(password)
 	if err != nil {
 		return nil, fmt.Errorf("password hashing error: %w", err)
 	}
@@ -110,36 +171,127 @@ func (a *Auth) Login(ctx context.Context,
 
 	logg := a.logg.With(slog.String("op", op))
 
-	user, err := a.authManager.GetUser(ctx, email)
+	user, err := a.authenticate(ctx, email, password)
 	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			logg.Info("user not found", sl.Err(err))
-		}
+		return nil, err
+	}
 
-		return nil, ErrInvalidCredentials //nolint:wrapcheck
+	app, err := a.app(ctx, appID, entity.GrantTypePassword)
+	if err != nil {
+		return nil, err
 	}
 
-	err = bcrypt.CompareHashAndPassword(user.PassHash, []byte(password))
+	logg.Info("user successfully logged")
+
+	// every login starts a new token family
+	pair, err := a.startSession(ctx, user.UserID, app, uuid.NewString(), "")
 	if err != nil {
-		logg.Info("invalid credentials", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
-		return nil, ErrInvalidPassword //nolint:wrapcheck
+	return pair, nil
+}
+
+// authenticate checks the password of a user. Failed attempts are throttled,
+// see LoginThrottleConfig.
+func (a *Auth) authenticate(ctx context.Context,
+	email,
+	password string) (*entity.User, error) {
+	const op = "service/auth.authenticate"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	attempts, err := a.reserveLoginAttempt(ctx, email)
+	if err != nil {
+		return nil, err
 	}
 
-	app, err := a.authManager.GetApp(ctx, appID)
+	user, err := a.authManager.GetUser(ctx, email)
 	if err != nil {
-		if errors.Is(err, storage.ErrAppNotFound) {
-			logg.Warn("app not found", sl.Err(err))
+		if !errors.Is(err, storage.ErrUserNotFound) {
+			a.releaseLoginAttempt(ctx, attempts)
 
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 
-		return nil, fmt.Errorf("failed to get app: %w", err)
+		logg.Info("user not found", sl.Err(err))
+
+		// unknown emails take as long as wrong passwords, so response time
+		// does not tell whether an account exists.
+		dummyPassHash, err := a.dummyPassHash()
+		if err != nil {
+			a.releaseLoginAttempt(ctx, attempts)
+
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		_, _ = a.hasher.Verify(dummyPassHash, password)
+
+		return nil, a.loginFailed(attempts)
 	}
 
-	logg.Info("user successfully logged")
+	needsRehash, err := a.hasher.Verify(user.PassHash, password)
+	if err != nil {
+		if errors.Is(err, passwords.ErrMismatch) {
+			logg.Info("invalid credentials", sl.Err(err))
+		} else {
+			logg.Error("failed to verify password hash", sl.Err(err))
+		}
+
+		return nil, a.loginFailed(attempts)
+	}
+
+	a.recordLoginSuccess(ctx, attempts)
+
+	if needsRehash {
+		a.rehashPassword(ctx, user, password)
+	}
+
+	return user, nil
+}
+
+// rehashPassword upgrades the stored hash of the user to the current algorithm
+// and parameters. Failing to do so does not fail the login, the next one retries.
+func (a *Auth) rehashPassword(ctx context.Context, user *entity.User, password string) {
+	const op = "service/auth.rehashPassword"
+
+	logg := a.logg.With(slog.String("op", op), slog.String("userID", user.UserID))
+
+	passHash, err := a.hasher.Hash(password)
+	if err != nil {
+		logg.Error("failed to rehash password", sl.Err(err))
+
+		return
+	}
 
-	accessToken, err := tokens.NewAccessToken(user.UserID, app.ID, a.accessTTL, a.secretKey)
+	err = a.authManager.UpdatePasswordHash(ctx, user.UserID, passHash)
+	if err != nil {
+		logg.Error("failed to save rehashed password", sl.Err(err))
+
+		return
+	}
+
+	user.PassHash = passHash
+
+	logg.Info("password rehashed")
+}
+
+// loginFailed records a failed login and returns ErrInvalidCredentials, the
+// same for unknown emails and wrong passwords.
+func (a *Auth) loginFailed(attempts []loginAttempt) error {
+	a.recordLoginFailure(attempts)
+
+	return ErrInvalidCredentials //nolint:wrapcheck
+}
+
+// startSession issues the first token pair of a login session in the familyID
+// refresh token family with the granted oauth scope.
+func (a *Auth) startSession(ctx context.Context,
+	userID string,
+	app *entity.App,
+	familyID,
+	scope string) (*entity.TokenPair, error) {
+	accessToken, err := a.newAccessToken(userID, app, scope)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create access token: %w", err)
 	}
@@ -149,16 +301,34 @@ func (a *Auth) Login(ctx context.Context,
 		return nil, fmt.Errorf("failed to create refresh token: %w", err)
 	}
 
+	now := time.Now()
+
+	session := &entity.RefreshSession{
+		RefreshToken: *refreshToken,
+		UserID:       userID,
+		AppID:        app.ID,
+		FamilyID:     familyID,
+		Scope:        scope,
+		ExpiresAt:    now.Add(a.refreshTTL(app)),
+	}
+
+	// with an idle timeout the refresh TTL bounds the whole login session
+	if app.IdleTimeout > 0 {
+		session.SessionExpiresAt = session.ExpiresAt
+		session.ExpiresAt = now.Add(min(app.IdleTimeout, a.refreshTTL(app)))
+	}
+
 	// inserts new refresh token into database (refresh_session table)
-	err = a.authManager.NewRefreshSession(ctx, user.UserID,
-		*refreshToken, a.refreshTTL)
+	err = a.authManager.NewRefreshSession(ctx, session)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("failed to create refresh session: %w", err)
 	}
 
 	return &entity.TokenPair{
 		AccessToken:  *accessToken,
 		RefreshToken: *refreshToken,
+		ExpiresIn:    a.accessTTL(app),
+		Scope:        scope,
 	}, nil
 }
 
@@ -178,13 +348,65 @@ func (a *Auth) RefreshTokenPair(
 	ctx context.Context,
 	userID, refreshToken string,
 	appID int32) (*entity.TokenPair, error) {
+	return a.refreshTokenPair(ctx, userID, refreshToken, appID, "")
+}
+
+// refreshTokenPair rotates a refresh token, the new access token carries the
+// scope granted to the session.
+func (a *Auth) refreshTokenPair(
+	ctx context.Context,
+	userID, refreshToken string,
+	appID int32,
+	scope string) (*entity.TokenPair, error) {
 	const op = "service/auth.RefreshTokenPair"
 
 	logg := a.logg.With(slog.String("op", op))
 
-	err := a.authManager.ValidateRefreshToken(ctx, userID, refreshToken)
+	// rejects forged or mistyped tokens without a storage lookup
+	err := tokens.CheckRefreshTokenFormat(refreshToken)
+	if err != nil {
+		logg.Info("malformed refresh token", sl.Err(err))
+
+		return nil, ErrMalformedRefreshToken //nolint:wrapcheck
+	}
+
+	app, err := a.app(ctx, appID, entity.GrantTypeRefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// both tokens are created up front, so nothing can fail
+	// after the presented token is consumed
+	accessToken, err := a.newAccessToken(userID, app, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access token: %w", err)
+	}
+
+	newRefreshToken, err := tokens.NewRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	// an idle timeout slides with every refresh, storage caps it
+	// at the end of the login session
+	refreshTTL := a.refreshTTL(app)
+	if app.IdleTimeout > 0 {
+		refreshTTL = app.IdleTimeout
+	}
+
+	// marks the presented token used and inserts its successor
+	// into database (refresh_session table) atomically
+	session, err := a.authManager.RotateRefreshSession(ctx, refreshToken, userID,
+		&entity.RefreshSession{
+			RefreshToken: *newRefreshToken,
+			UserID:       userID,
+			AppID:        app.ID,
+			ExpiresAt:    time.Now().Add(refreshTTL),
+		})
 	if err != nil {
 		switch {
+		case errors.Is(err, storage.ErrRefreshTokenReused):
+			return nil, a.handleRefreshTokenReuse(ctx, session)
 		case errors.Is(err, storage.ErrRefreshTokenNotFound):
 			logg.Info("refresh token not found", sl.Err(err))
 
@@ -193,32 +415,387 @@ func (a *Auth) RefreshTokenPair(
 			logg.Info("refresh token is invalid", sl.Err(err))
 
 			return nil, ErrInvalidRefreshToken //nolint:wrapcheck
+		case errors.Is(err, storage.ErrRefreshAppMismatch):
+			logg.Warn("refresh token presented to another app",
+				slog.Int("appID", int(appID)),
+				slog.Int("sessionAppID", int(session.AppID)))
+
+			return nil, ErrAppMismatch //nolint:wrapcheck
 		default:
-			logg.Warn("validate refresh token error", sl.Err(err))
+			logg.Warn("rotate refresh token error", sl.Err(err))
 
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 	}
 
-	accessToken, err := tokens.NewAccessToken(userID, appID, a.accessTTL, a.secretKey)
+	return &entity.TokenPair{
+		AccessToken:  *accessToken,
+		RefreshToken: *newRefreshToken,
+		ExpiresIn:    a.accessTTL(app),
+		Scope:        scope,
+	}, nil
+}
+
+// handleRefreshTokenReuse revokes the family of a refresh token presented
+// twice: either the legitimate client or an attacker holds a stolen copy, and
+// there is no way to tell which, so every descendant is invalidated.
+func (a *Auth) handleRefreshTokenReuse(ctx context.Context,
+	session *entity.RefreshSession) error {
+	const op = "service/auth.handleRefreshTokenReuse"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	logg.Warn("security event: refresh token reuse detected, revoking token family",
+		slog.String("event", "refresh_token_reuse"),
+		slog.String("userID", session.UserID),
+		slog.String("familyID", session.FamilyID))
+
+	err := a.authManager.RevokeRefreshFamily(ctx, session.FamilyID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create access token: %w", err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	newRefreshToken, err := tokens.NewRefreshToken()
+	return ErrRefreshTokenReused //nolint:wrapcheck
+}
+
+// JWKS returns the public keys resource services use to verify access tokens.
+func (a *Auth) JWKS(_ context.Context) (*entity.JSONWebKeySet, error) {
+	return a.keyRing.JWKS(), nil
+}
+
+// ValidateToken verifies an access token issued for appID and returns its claims.
+func (a *Auth) ValidateToken(ctx context.Context,
+	accessToken string,
+	appID int32) (*entity.TokenClaims, error) {
+	const op = "service/auth.ValidateToken"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	claims, err := tokens.VerifyAccessToken(accessToken, a.keyRing,
+		a.tokenCfg.Issuer, appID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create refresh token: %w", err)
+		switch {
+		case errors.Is(err, tokens.ErrTokenExpired):
+			return nil, ErrAccessTokenExpired //nolint:wrapcheck
+		case errors.Is(err, tokens.ErrTokenAppMismatch):
+			logg.Info("access token app mismatch", sl.Err(err))
+
+			return nil, ErrAppMismatch //nolint:wrapcheck
+		default:
+			logg.Info("invalid access token", sl.Err(err))
+
+			return nil, ErrInvalidAccessToken //nolint:wrapcheck
+		}
 	}
 
-	// inserts new refresh token into database (refresh_session table)
-	err = a.authManager.NewRefreshSession(ctx,
-		*newRefreshToken, userID, a.refreshTTL)
+	revoked, err := a.authManager.IsAccessTokenRevoked(ctx, claims.ID)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &entity.TokenPair{
-		AccessToken:  *accessToken,
-		RefreshToken: *newRefreshToken,
-	}, nil
+	if revoked {
+		logg.Info("revoked access token", slog.String("jti", claims.ID))
+
+		return nil, ErrAccessTokenRevoked //nolint:wrapcheck
+	}
+
+	if claims.IsServiceAccount {
+		return a.validateServiceAccount(ctx, claims)
+	}
+
+	_, err = a.authManager.GetApp(ctx, claims.AppID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			logg.Info("access token of deleted app", slog.Int("appID", int(claims.AppID)))
+
+			return nil, ErrInvalidAccessToken //nolint:wrapcheck
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	isAdmin, err := a.authManager.IsAdmin(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			logg.Warn("access token of unknown user", sl.Err(err))
+
+			return nil, ErrInvalidAccessToken //nolint:wrapcheck
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	validAfter, err := a.authManager.TokensValidAfter(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// iat has a second precision, so tokens issued within the watermark second are rejected too.
+	if !claims.IssuedAt.After(validAfter) {
+		logg.Info("access token issued before user watermark", slog.String("jti", claims.ID))
+
+		return nil, ErrAccessTokenRevoked //nolint:wrapcheck
+	}
+
+	claims.IsAdmin = *isAdmin
+
+	return claims, nil
+}
+
+// validateServiceAccount checks that the client a service account token is
+// issued to is still registered, so deleting an app ends its tokens.
+func (a *Auth) validateServiceAccount(ctx context.Context,
+	claims *entity.TokenClaims) (*entity.TokenClaims, error) {
+	const op = "service/auth.validateServiceAccount"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	app, err := a.authManager.GetAppByClientID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			logg.Info("service account token of deleted app", slog.String("clientID", claims.UserID))
+
+			return nil, ErrInvalidAccessToken //nolint:wrapcheck
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if app.ID != claims.AppID {
+		logg.Warn("service account token of another app", slog.String("clientID", claims.UserID))
+
+		return nil, ErrInvalidAccessToken //nolint:wrapcheck
+	}
+
+	return claims, nil
+}
+
+// RevokeAccessToken denylists a single access token of any app until it expires.
+// The caller must present an admin access token issued for appID.
+func (a *Auth) RevokeAccessToken(ctx context.Context,
+	adminToken string,
+	appID int32,
+	accessToken string) error {
+	const op = "service/auth.RevokeAccessToken"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	admin, err := a.AuthorizeAdmin(ctx, adminToken, appID)
+	if err != nil {
+		return err
+	}
+
+	claims, err := tokens.InspectAccessToken(accessToken, a.keyRing, a.tokenCfg.Issuer)
+	if err != nil {
+		logg.Info("invalid access token to revoke", sl.Err(err))
+
+		return ErrInvalidTargetToken //nolint:wrapcheck
+	}
+
+	// expired tokens are rejected anyway.
+	if !claims.ExpiresAt.After(time.Now()) {
+		return nil
+	}
+
+	err = a.authManager.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logg.Info("access token revoked",
+		slog.String("adminID", admin.UserID),
+		slog.String("jti", claims.ID),
+		slog.String("userID", claims.UserID))
+
+	return nil
+}
+
+// RevokeUserTokens rejects every access token of the user issued before
+// issuedBefore (now if zero) and revokes the user's refresh sessions, so new
+// tokens require a new login. The caller must present an admin access token
+// issued for appID. Returns the number of revoked refresh sessions.
+func (a *Auth) RevokeUserTokens(ctx context.Context,
+	adminToken string,
+	appID int32,
+	userID string,
+	issuedBefore time.Time) (int64, error) {
+	const op = "service/auth.RevokeUserTokens"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	admin, err := a.AuthorizeAdmin(ctx, adminToken, appID)
+	if err != nil {
+		return 0, err
+	}
+
+	if issuedBefore.IsZero() {
+		issuedBefore = time.Now()
+	}
+
+	err = a.authManager.SetTokensValidAfter(ctx, userID, issuedBefore)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return 0, ErrUserNotFound //nolint:wrapcheck
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	revoked, err := a.authManager.RevokeUserRefreshSessions(ctx, userID, 0)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logg.Info("user tokens revoked",
+		slog.String("adminID", admin.UserID),
+		slog.String("userID", userID),
+		slog.Time("issuedBefore", issuedBefore),
+		slog.Int64("refreshSessions", revoked))
+
+	return revoked, nil
+}
+
+// AuthorizeAdmin validates the access token of an admin rpc caller.
+func (a *Auth) AuthorizeAdmin(ctx context.Context,
+	adminToken string,
+	appID int32) (*entity.TokenClaims, error) {
+	claims, err := a.ValidateToken(ctx, adminToken, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.IsAdmin {
+		a.logg.Warn("admin rpc called by non admin user",
+			slog.String("userID", claims.UserID))
+
+		return nil, ErrPermissionDenied //nolint:wrapcheck
+	}
+
+	return claims, nil
+}
+
+// Logout ends the session of a refresh token: the token and every token
+// rotated from the same login are revoked.
+func (a *Auth) Logout(ctx context.Context, refreshToken string) error {
+	const op = "service/auth.Logout"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	err := tokens.CheckRefreshTokenFormat(refreshToken)
+	if err != nil {
+		logg.Info("malformed refresh token", sl.Err(err))
+
+		return ErrMalformedRefreshToken //nolint:wrapcheck
+	}
+
+	err = a.authManager.RevokeRefreshFamilyByToken(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			logg.Info("refresh token not found", sl.Err(err))
+
+			return ErrRefreshTokenNotFound //nolint:wrapcheck
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// LogoutAll revokes every refresh session of the access token owner, or only
+// sessions of the token's app if currentAppOnly is set. Returns the number of
+// revoked sessions.
+func (a *Auth) LogoutAll(ctx context.Context,
+	accessToken string,
+	appID int32,
+	currentAppOnly bool) (int64, error) {
+	const op = "service/auth.LogoutAll"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	claims, err := a.ValidateToken(ctx, accessToken, appID)
+	if err != nil {
+		return 0, err
+	}
+
+	scope := int32(0) // every app
+	if currentAppOnly {
+		scope = claims.AppID
+	}
+
+	revoked, err := a.authManager.RevokeUserRefreshSessions(ctx, claims.UserID, scope)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logg.Info("user sessions revoked",
+		slog.String("userID", claims.UserID),
+		slog.Int64("count", revoked))
+
+	return revoked, nil
+}
+
+// app returns the app tokens are issued for, if it allows grantType.
+func (a *Auth) app(ctx context.Context,
+	appID int32,
+	grantType string) (*entity.App, error) {
+	const op = "service/auth.app"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	app, err := a.authManager.GetApp(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			logg.Warn("app not found", sl.Err(err))
+
+			return nil, ErrAppNotFound //nolint:wrapcheck
+		}
+
+		return nil, fmt.Errorf("failed to get app: %w", err)
+	}
+
+	if !app.AllowsGrantType(grantType) {
+		logg.Warn("grant type is not allowed",
+			slog.Int("appID", int(appID)),
+			slog.String("grantType", grantType))
+
+		return nil, ErrGrantTypeNotAllowed //nolint:wrapcheck
+	}
+
+	return app, nil
+}
+
+func (a *Auth) newAccessToken(userID string, app *entity.App, scope string) (*string, error) {
+	return tokens.NewAccessToken(tokens.AccessTokenParams{ //nolint:wrapcheck
+		UserID:       userID,
+		AppID:        app.ID,
+		Issuer:       a.tokenCfg.Issuer,
+		TTL:          a.accessTTL(app),
+		Audience:     app.Audience,
+		Scope:        scope,
+		LegacyClaims: a.tokenCfg.LegacyClaims,
+	}, a.keyRing.SigningKey())
+}
+
+// accessTTL of tokens of the app. Tokens never outlive the signing key
+// retention, apps stored with a longer ttl are capped.
+func (a *Auth) accessTTL(app *entity.App) time.Duration {
+	ttl := a.tokenCfg.AccessTTL
+	if app.AccessTTL > 0 {
+		ttl = app.AccessTTL
+	}
+
+	if retention := a.keyRing.Retention(); retention > 0 {
+		ttl = min(ttl, retention)
+	}
+
+	return ttl
+}
+
+func (a *Auth) refreshTTL(app *entity.App) time.Duration {
+	if app.RefreshTTL > 0 {
+		return app.RefreshTTL
+	}
+
+	return a.tokenCfg.RefreshTTL
 }
@@ -0,0 +1,99 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/service/auth"
+)
+
+func TestClientCredentials(t *testing.T) {
+	authService, strg := newTestAuth(t)
+	ctx := context.Background()
+
+	secretHash, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	client, err := strg.SaveApp(ctx, &entity.App{
+		Name:             "backend job",
+		ClientSecretHash: secretHash,
+	})
+	require.NoError(t, err)
+
+	userOnly, err := strg.SaveApp(ctx, &entity.App{
+		Name:              "user facing",
+		ClientSecretHash:  secretHash,
+		AllowedGrantTypes: []string{entity.GrantTypeAuthorizationCode, entity.GrantTypeRefreshToken},
+	})
+	require.NoError(t, err)
+
+	cases := []struct {
+		testName      string
+		clientID      string
+		clientSecret  string
+		expectedError error
+	}{
+		{
+			testName:     "ok case",
+			clientID:     client.ClientID,
+			clientSecret: clientSecret,
+		},
+		{
+			testName:      "public client case",
+			clientID:      client.ClientID,
+			expectedError: auth.ErrInvalidClient,
+		},
+		{
+			testName:      "wrong secret case",
+			clientID:      client.ClientID,
+			clientSecret:  "wrong",
+			expectedError: auth.ErrInvalidClient,
+		},
+		{
+			testName:      "unknown client case",
+			clientID:      "unknown",
+			clientSecret:  clientSecret,
+			expectedError: auth.ErrInvalidClient,
+		},
+		{
+			testName:      "grant type not allowed case",
+			clientID:      userOnly.ClientID,
+			clientSecret:  clientSecret,
+			expectedError: auth.ErrGrantTypeNotAllowed,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			pair, err := authService.ClientCredentials(ctx, tcase.clientID, tcase.clientSecret)
+			require.ErrorIs(t, err, tcase.expectedError)
+
+			if tcase.expectedError != nil {
+				return
+			}
+
+			require.Empty(t, pair.RefreshToken)
+
+			claims, err := authService.ValidateToken(ctx, pair.AccessToken, client.ID)
+			require.NoError(t, err)
+			require.True(t, claims.IsServiceAccount)
+			require.False(t, claims.IsAdmin)
+			require.Equal(t, client.ClientID, claims.UserID)
+		})
+	}
+
+	t.Run("deleted app case", func(t *testing.T) {
+		pair, err := authService.ClientCredentials(ctx, client.ClientID, clientSecret)
+		require.NoError(t, err)
+
+		err = strg.DeleteApp(ctx, client.ID)
+		require.NoError(t, err)
+
+		_, err = authService.ValidateToken(ctx, pair.AccessToken, client.ID)
+		require.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+	})
+}
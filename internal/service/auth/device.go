@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+var (
+	ErrDeviceFlowDisabled   = errors.New("device flow requires a verification uri")
+	ErrInvalidUserCode      = errors.New("user code is unknown, expired or already used")
+	ErrAuthorizationPending = errors.New("the user has not approved the device yet")
+	ErrSlowDown             = errors.New("device polls too often")
+	ErrExpiredToken         = errors.New("device code is expired")
+	ErrAccessDenied         = errors.New("the user denied the device")
+)
+
+const (
+	// DeviceCodeTTL is how long a user has to approve a device.
+	DeviceCodeTTL = 10 * time.Minute
+	// DevicePollInterval is the minimal time between polls of a device.
+	DevicePollInterval = 5 * time.Second
+
+	userCodeAttempts = 3
+)
+
+// DeviceCodes answer a device authorization request, RFC 8628 section 3.2.
+type DeviceCodes struct {
+	DeviceCode              string
+	UserCode                string // formatted for display
+	VerificationURI         string
+	VerificationURIComplete string // with the user code, for QR codes
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+}
+
+// StartDeviceAuthorization starts the device flow of a client: the device
+// shows the user code and polls PollDeviceAuthorization while the user
+// approves it at the verification uri.
+func (a *Auth) StartDeviceAuthorization(ctx context.Context,
+	clientID,
+	clientSecret,
+	scope string) (*DeviceCodes, error) {
+	const op = "service/auth.StartDeviceAuthorization"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	if a.tokenCfg.VerificationURI == "" {
+		return nil, ErrDeviceFlowDisabled //nolint:wrapcheck
+	}
+
+	app, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !app.AllowsGrantType(entity.GrantTypeDeviceCode) {
+		return nil, ErrGrantTypeNotAllowed //nolint:wrapcheck
+	}
+
+	deviceCode, err := tokens.NewDeviceCode()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	auth := &entity.DeviceAuthorization{
+		DeviceCode: *deviceCode,
+		AppID:      app.ID,
+		Scope:      a.grantedScope(scope),
+		Interval:   DevicePollInterval,
+		ExpiresAt:  time.Now().Add(DeviceCodeTTL),
+	}
+
+	// user codes are short, a collision gets a new one.
+	for attempt := 1; ; attempt++ {
+		auth.UserCode, err = tokens.NewUserCode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		err = a.authManager.SaveDeviceAuthorization(ctx, auth)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, storage.ErrUserCodeExists) || attempt == userCodeAttempts {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	logg.Info("device authorization started",
+		slog.Int("appID", int(app.ID)))
+
+	userCode := tokens.FormatUserCode(auth.UserCode)
+
+	return &DeviceCodes{
+		DeviceCode:              *deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         a.tokenCfg.VerificationURI,
+		VerificationURIComplete: a.tokenCfg.VerificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               DeviceCodeTTL,
+		Interval:                DevicePollInterval,
+	}, nil
+}
+
+// DeviceAuthorizationApp returns the app asking for a pending user code, so
+// the user knows what they approve.
+func (a *Auth) DeviceAuthorizationApp(ctx context.Context, userCode string) (*entity.App, error) {
+	const op = "service/auth.DeviceAuthorizationApp"
+
+	normalized, ok := tokens.NormalizeUserCode(userCode)
+	if !ok {
+		return nil, ErrInvalidUserCode //nolint:wrapcheck
+	}
+
+	auth, err := a.authManager.GetDeviceAuthorization(ctx, normalized)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return nil, ErrInvalidUserCode //nolint:wrapcheck
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.authManager.GetApp(ctx, auth.AppID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, nil
+}
+
+// DecideDeviceAuthorization logs the user in and approves or denies the
+// device showing userCode.
+func (a *Auth) DecideDeviceAuthorization(ctx context.Context,
+	userCode,
+	email,
+	password string,
+	approved bool) error {
+	const op = "service/auth.DecideDeviceAuthorization"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	normalized, ok := tokens.NormalizeUserCode(userCode)
+	if !ok {
+		return ErrInvalidUserCode //nolint:wrapcheck
+	}
+
+	user, err := a.authenticate(ctx, email, password)
+	if err != nil {
+		return err
+	}
+
+	err = a.authManager.DecideDeviceAuthorization(ctx, normalized, user.UserID, approved)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return ErrInvalidUserCode //nolint:wrapcheck
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logg.Info("device authorization decided",
+		slog.String("userID", user.UserID),
+		slog.Bool("approved", approved))
+
+	return nil
+}
+
+// PollDeviceAuthorization exchanges an approved device code for a token pair,
+// RFC 8628 section 3.4. Until the user decides it returns
+// ErrAuthorizationPending, or ErrSlowDown if the device polls too often.
+func (a *Auth) PollDeviceAuthorization(ctx context.Context,
+	clientID,
+	clientSecret,
+	deviceCode string) (*entity.TokenPair, error) {
+	const op = "service/auth.PollDeviceAuthorization"
+
+	app, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !app.AllowsGrantType(entity.GrantTypeDeviceCode) {
+		return nil, ErrGrantTypeNotAllowed //nolint:wrapcheck
+	}
+
+	if !tokens.IsDeviceCode(deviceCode) {
+		return nil, ErrInvalidGrant //nolint:wrapcheck
+	}
+
+	auth, err := a.authManager.PollDeviceAuthorization(ctx, deviceCode, app.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrDeviceSlowDown):
+			return nil, ErrSlowDown //nolint:wrapcheck
+		case errors.Is(err, storage.ErrDeviceCodeExpired):
+			return nil, ErrExpiredToken //nolint:wrapcheck
+		case errors.Is(err, storage.ErrDeviceCodeNotFound):
+			return nil, ErrInvalidGrant //nolint:wrapcheck
+		default:
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	switch auth.Status {
+	case entity.DeviceStatusPending:
+		return nil, ErrAuthorizationPending //nolint:wrapcheck
+	case entity.DeviceStatusDenied:
+		return nil, ErrAccessDenied //nolint:wrapcheck
+	}
+
+	// every approved device starts a new token family
+	pair, err := a.startSession(ctx, auth.UserID, app, uuid.NewString(), auth.Scope)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.addIDToken(ctx, pair, app, auth.UserID, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return pair, nil
+}
@@ -0,0 +1,84 @@
+package auth_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/service/auth"
+)
+
+func TestDeviceAuthorization(t *testing.T) {
+	authService, strg := newTestAuth(t)
+	ctx := context.Background()
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	client, err := strg.SaveApp(ctx, &entity.App{Name: "cli"})
+	require.NoError(t, err)
+
+	start := func(t *testing.T) *auth.DeviceCodes {
+		t.Helper()
+
+		codes, err := authService.StartDeviceAuthorization(ctx, client.ClientID, "", "")
+		require.NoError(t, err)
+
+		return codes
+	}
+
+	t.Run("approved case", func(t *testing.T) {
+		codes := start(t)
+		require.Equal(t, "https://sso.test/device", codes.VerificationURI)
+		require.Equal(t, codes.VerificationURI+"?user_code="+url.QueryEscape(codes.UserCode),
+			codes.VerificationURIComplete)
+
+		app, err := authService.DeviceAuthorizationApp(ctx, codes.UserCode)
+		require.NoError(t, err)
+		require.Equal(t, client.ID, app.ID)
+
+		err = authService.DecideDeviceAuthorization(ctx, codes.UserCode, testEmail, "wrong", true)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+		err = authService.DecideDeviceAuthorization(ctx, codes.UserCode, testEmail, testPassword, true)
+		require.NoError(t, err)
+
+		pair, err := authService.PollDeviceAuthorization(ctx, client.ClientID, "", codes.DeviceCode)
+		require.NoError(t, err)
+
+		claims, err := authService.ValidateToken(ctx, pair.AccessToken, client.ID)
+		require.NoError(t, err)
+		require.False(t, claims.IsServiceAccount)
+
+		_, err = authService.PollDeviceAuthorization(ctx, client.ClientID, "", codes.DeviceCode)
+		require.ErrorIs(t, err, auth.ErrInvalidGrant)
+	})
+
+	t.Run("pending case", func(t *testing.T) {
+		codes := start(t)
+
+		_, err := authService.PollDeviceAuthorization(ctx, client.ClientID, "", codes.DeviceCode)
+		require.ErrorIs(t, err, auth.ErrAuthorizationPending)
+
+		_, err = authService.PollDeviceAuthorization(ctx, client.ClientID, "", codes.DeviceCode)
+		require.ErrorIs(t, err, auth.ErrSlowDown)
+	})
+
+	t.Run("denied case", func(t *testing.T) {
+		codes := start(t)
+
+		err := authService.DecideDeviceAuthorization(ctx, codes.UserCode, testEmail, testPassword, false)
+		require.NoError(t, err)
+
+		_, err = authService.PollDeviceAuthorization(ctx, client.ClientID, "", codes.DeviceCode)
+		require.ErrorIs(t, err, auth.ErrAccessDenied)
+	})
+
+	t.Run("unknown user code case", func(t *testing.T) {
+		err := authService.DecideDeviceAuthorization(ctx, "BCDF-GHJK", testEmail, testPassword, true)
+		require.ErrorIs(t, err, auth.ErrInvalidUserCode)
+	})
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+// IntrospectToken tells a confidential client whether an access or refresh
+// token issued for its app is active, RFC 7662. Tokens of other apps are
+// reported inactive. Token types are told apart by their format.
+func (a *Auth) IntrospectToken(ctx context.Context,
+	clientID,
+	clientSecret,
+	token string) (*entity.TokenIntrospection, error) {
+	const op = "service/auth.IntrospectToken"
+
+	// token state is only disclosed to clients proving who they are.
+	app, err := a.authenticateConfidentialClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	var introspection *entity.TokenIntrospection
+
+	if tokens.CheckRefreshTokenFormat(token) == nil {
+		introspection, err = a.introspectRefreshToken(ctx, app, token)
+	} else {
+		introspection, err = a.introspectAccessToken(ctx, app, token)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return introspection, nil
+}
+
+// RevokeToken lets a client revoke its own access or refresh token, RFC 7009.
+// A refresh token ends its whole login session. Unknown tokens and tokens of
+// other apps are ignored, so the caller learns nothing about them.
+func (a *Auth) RevokeToken(ctx context.Context,
+	clientID,
+	clientSecret,
+	token string) error {
+	const op = "service/auth.RevokeToken"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	app, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	if tokens.CheckRefreshTokenFormat(token) == nil {
+		session, err := a.authManager.GetRefreshSession(ctx, token)
+		if err != nil {
+			if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+				return nil
+			}
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if !sessionOfApp(session, app) {
+			logg.Warn("refresh token of another app presented for revocation",
+				slog.Int("appID", int(app.ID)))
+
+			return nil
+		}
+
+		err = a.authManager.RevokeRefreshFamily(ctx, session.FamilyID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	}
+
+	claims, err := tokens.InspectAccessToken(token, a.keyRing, a.tokenCfg.Issuer)
+	if err != nil {
+		logg.Info("invalid access token presented for revocation", sl.Err(err))
+
+		return nil
+	}
+
+	// expired tokens are rejected anyway.
+	if claims.AppID != app.ID || !claims.ExpiresAt.After(time.Now()) {
+		return nil
+	}
+
+	err = a.authManager.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *Auth) introspectRefreshToken(ctx context.Context,
+	app *entity.App,
+	token string) (*entity.TokenIntrospection, error) {
+	session, err := a.authManager.GetRefreshSession(ctx, token)
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			return &entity.TokenIntrospection{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to get refresh session: %w", err)
+	}
+
+	if !sessionOfApp(session, app) || session.IsUsed || session.IsRevoked ||
+		!session.ExpiresAt.After(time.Now()) {
+		return &entity.TokenIntrospection{}, nil
+	}
+
+	return &entity.TokenIntrospection{
+		Active:    true,
+		TokenType: entity.TokenTypeRefresh,
+		UserID:    session.UserID,
+		AppID:     app.ID,
+		ClientID:  app.ClientID,
+		Scope:     session.Scope,
+		ExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+func (a *Auth) introspectAccessToken(ctx context.Context,
+	app *entity.App,
+	token string) (*entity.TokenIntrospection, error) {
+	claims, err := a.ValidateToken(ctx, token, app.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidAccessToken),
+			errors.Is(err, ErrAccessTokenExpired),
+			errors.Is(err, ErrAccessTokenRevoked),
+			errors.Is(err, ErrAppMismatch):
+			return &entity.TokenIntrospection{}, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &entity.TokenIntrospection{
+		Active:           true,
+		TokenType:        entity.TokenTypeAccess,
+		UserID:           claims.UserID,
+		AppID:            claims.AppID,
+		ClientID:         app.ClientID,
+		Scope:            claims.Scope,
+		IsServiceAccount: claims.IsServiceAccount,
+		ID:               claims.ID,
+		IssuedAt:         claims.IssuedAt,
+		ExpiresAt:        claims.ExpiresAt,
+	}, nil
+}
+
+// sessionOfApp reports whether a refresh session belongs to app. Sessions
+// stored before apps were recorded belong to none.
+func sessionOfApp(session *entity.RefreshSession, app *entity.App) bool {
+	return session.AppID == app.ID
+}
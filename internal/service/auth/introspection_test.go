@@ -0,0 +1,152 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/service/auth"
+)
+
+func TestIntrospectAndRevokeToken(t *testing.T) {
+	authService, strg := newTestAuth(t)
+	ctx := context.Background()
+
+	secretHash, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	client, err := strg.SaveApp(ctx, &entity.App{
+		Name:             "resource server",
+		ClientSecretHash: secretHash,
+	})
+	require.NoError(t, err)
+
+	other, err := strg.SaveApp(ctx, &entity.App{
+		Name:             "another app",
+		ClientSecretHash: secretHash,
+	})
+	require.NoError(t, err)
+
+	userID, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	pair, err := authService.Login(ctx, testEmail, testPassword, client.ID)
+	require.NoError(t, err)
+
+	cases := []struct {
+		testName      string
+		clientID      string
+		clientSecret  string
+		token         string
+		expectedType  string // empty for inactive tokens
+		expectedError error
+	}{
+		{
+			testName:     "access token case",
+			clientID:     client.ClientID,
+			clientSecret: clientSecret,
+			token:        pair.AccessToken,
+			expectedType: entity.TokenTypeAccess,
+		},
+		{
+			testName:     "refresh token case",
+			clientID:     client.ClientID,
+			clientSecret: clientSecret,
+			token:        pair.RefreshToken,
+			expectedType: entity.TokenTypeRefresh,
+		},
+		{
+			testName:     "access token of another app case",
+			clientID:     other.ClientID,
+			clientSecret: clientSecret,
+			token:        pair.AccessToken,
+		},
+		{
+			testName:     "refresh token of another app case",
+			clientID:     other.ClientID,
+			clientSecret: clientSecret,
+			token:        pair.RefreshToken,
+		},
+		{
+			testName:     "garbage token case",
+			clientID:     client.ClientID,
+			clientSecret: clientSecret,
+			token:        "garbage",
+		},
+		{
+			testName:      "public client case",
+			clientID:      client.ClientID,
+			token:         pair.AccessToken,
+			expectedError: auth.ErrInvalidClient,
+		},
+		{
+			testName:      "wrong secret case",
+			clientID:      client.ClientID,
+			clientSecret:  "wrong",
+			token:         pair.AccessToken,
+			expectedError: auth.ErrInvalidClient,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			introspection, err := authService.IntrospectToken(ctx,
+				tcase.clientID, tcase.clientSecret, tcase.token)
+			require.ErrorIs(t, err, tcase.expectedError)
+
+			if tcase.expectedError != nil {
+				return
+			}
+
+			if tcase.expectedType == "" {
+				require.Equal(t, &entity.TokenIntrospection{}, introspection)
+
+				return
+			}
+
+			require.True(t, introspection.Active)
+			require.Equal(t, tcase.expectedType, introspection.TokenType)
+			require.Equal(t, *userID, introspection.UserID)
+			require.Equal(t, client.ID, introspection.AppID)
+			require.Equal(t, client.ClientID, introspection.ClientID)
+		})
+	}
+
+	t.Run("revoke case", func(t *testing.T) {
+		// tokens of other apps are ignored.
+		err := authService.RevokeToken(ctx, other.ClientID, clientSecret, pair.AccessToken)
+		require.NoError(t, err)
+
+		err = authService.RevokeToken(ctx, other.ClientID, clientSecret, pair.RefreshToken)
+		require.NoError(t, err)
+
+		_, err = authService.ValidateToken(ctx, pair.AccessToken, client.ID)
+		require.NoError(t, err)
+
+		err = authService.RevokeToken(ctx, client.ClientID, clientSecret, pair.AccessToken)
+		require.NoError(t, err)
+
+		_, err = authService.ValidateToken(ctx, pair.AccessToken, client.ID)
+		require.ErrorIs(t, err, auth.ErrAccessTokenRevoked)
+
+		err = authService.RevokeToken(ctx, client.ClientID, clientSecret, pair.RefreshToken)
+		require.NoError(t, err)
+
+		introspection, err := authService.IntrospectToken(ctx, client.ClientID, clientSecret, pair.RefreshToken)
+		require.NoError(t, err)
+		require.False(t, introspection.Active)
+
+		_, err = authService.RefreshTokenPair(ctx, *userID, pair.RefreshToken, client.ID)
+		require.Error(t, err)
+
+		// revoking twice is fine.
+		err = authService.RevokeToken(ctx, client.ClientID, clientSecret, pair.RefreshToken)
+		require.NoError(t, err)
+
+		err = authService.RevokeToken(ctx, client.ClientID, "wrong", pair.RefreshToken)
+		require.ErrorIs(t, err, auth.ErrInvalidClient)
+	})
+}
@@ -0,0 +1,133 @@
+package auth_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/aspirin100/gRPC-SSO/internal/service/auth"
+)
+
+func TestLoginErrorsAreUniform(t *testing.T) {
+	authService, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	_, unknownErr := authService.Login(ctx, "unknown@test.com", testPassword, appID)
+	require.ErrorIs(t, unknownErr, auth.ErrInvalidCredentials)
+
+	_, wrongErr := authService.Login(ctx, testEmail, "wrong-password", appID)
+	require.ErrorIs(t, wrongErr, auth.ErrInvalidCredentials)
+
+	require.Equal(t, unknownErr.Error(), wrongErr.Error())
+}
+
+// TestLoginTiming checks that a login with an unknown email takes as long as
+// one with a wrong password, of an Argon2id or a legacy bcrypt hash, so
+// response time does not reveal accounts.
+func TestLoginTiming(t *testing.T) {
+	if testing.Short() {
+		t.Skip("hashes passwords dozens of times")
+	}
+
+	authService, _, db := newThrottledTestAuth(t, auth.LoginThrottleConfig{})
+	ctx := context.Background()
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	// only wrong passwords are tried, a login would rehash it.
+	const legacyEmail = "legacy@test.com"
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.DefaultCost)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`insert into users(id, email, passHash) values(?, ?, ?)`,
+		uuid.NewString(), legacyEmail, bcryptHash)
+	require.NoError(t, err)
+
+	const samples = 15
+
+	measure := func(email string) time.Duration {
+		start := time.Now()
+
+		_, err := authService.Login(ctx, email, "wrong-password", appID)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+		return time.Since(start)
+	}
+
+	// warm up the dummy hashes, they are computed on first use.
+	measure("unknown@test.com")
+
+	unknown := make([]time.Duration, 0, samples)
+	known := make([]time.Duration, 0, samples)
+	legacy := make([]time.Duration, 0, samples)
+
+	// interleaved, so load changes affect all alike.
+	for range samples {
+		unknown = append(unknown, measure("unknown@test.com"))
+		known = append(known, measure(testEmail))
+		legacy = append(legacy, measure(legacyEmail))
+	}
+
+	unknownMedian, knownMedian, legacyMedian := median(unknown), median(known), median(legacy)
+
+	// skipping the hash comparison makes unknown emails orders of magnitude
+	// faster, and a single bcrypt or Argon2id run differs by a multiple.
+	// Noise stays well within the tolerance.
+	require.InEpsilon(t, knownMedian.Seconds(), unknownMedian.Seconds(), 0.3,
+		"unknown email median %s, wrong password median %s", unknownMedian, knownMedian)
+	require.InEpsilon(t, legacyMedian.Seconds(), unknownMedian.Seconds(), 0.3,
+		"unknown email median %s, wrong legacy password median %s", unknownMedian, legacyMedian)
+}
+
+func median(samples []time.Duration) time.Duration {
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+
+	return sorted[len(sorted)/2]
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	authService, strg, db := newThrottledTestAuth(t, auth.LoginThrottleConfig{})
+	ctx := context.Background()
+
+	// stored before hashes carried their algorithm and parameters.
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.DefaultCost)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`insert into users(id, email, passHash) values(?, ?, ?)`,
+		uuid.NewString(), testEmail, bcryptHash)
+	require.NoError(t, err)
+
+	_, err = authService.Login(ctx, testEmail, "wrong-password", appID)
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+	user, err := strg.GetUser(ctx, testEmail)
+	require.NoError(t, err)
+	require.Equal(t, bcryptHash, user.PassHash)
+
+	_, err = authService.Login(ctx, testEmail, testPassword, appID)
+	require.NoError(t, err)
+
+	user, err = strg.GetUser(ctx, testEmail)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(user.PassHash), "$argon2id$"))
+
+	// the rehashed password still logs in, and is not rehashed again.
+	_, err = authService.Login(ctx, testEmail, testPassword, appID)
+	require.NoError(t, err)
+
+	rehashed, err := strg.GetUser(ctx, testEmail)
+	require.NoError(t, err)
+	require.Equal(t, user.PassHash, rehashed.PassHash)
+}
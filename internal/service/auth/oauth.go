@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+var (
+	ErrInvalidClient        = errors.New("unknown client or wrong client secret")
+	ErrInvalidRedirectURI   = errors.New("redirect uri is not registered for the client")
+	ErrInvalidCodeChallenge = errors.New("PKCE S256 code challenge is required")
+	ErrInvalidGrant         = errors.New("authorization code is invalid, expired or issued to another client")
+)
+
+// AuthorizationCodeTTL is how long an authorization code can be exchanged,
+// RFC 6749 section 4.1.2 recommends at most 10 minutes.
+const AuthorizationCodeTTL = time.Minute
+
+// AuthorizationRequest is an oauth authorization code request of a client.
+type AuthorizationRequest struct {
+	ClientID      string
+	RedirectURI   string
+	CodeChallenge string // PKCE S256
+	Scope         string // requested scopes, space separated
+	Nonce         string // OpenID Connect nonce, optional
+}
+
+// CodeExchange is a token request with the authorization_code grant.
+type CodeExchange struct {
+	Code         string
+	ClientID     string
+	ClientSecret string // required for confidential clients, ignored for public ones
+	RedirectURI  string
+	CodeVerifier string // PKCE
+}
+
+// AuthorizeClient checks the client and redirect uri of an authorization
+// request before the user is asked to log in. Errors of this check must not be
+// redirected to the client.
+func (a *Auth) AuthorizeClient(ctx context.Context,
+	clientID,
+	redirectURI string) (*entity.App, error) {
+	const op = "service/auth.AuthorizeClient"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	app, err := a.authManager.GetAppByClientID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			logg.Info("unknown client", slog.String("clientID", clientID))
+
+			return nil, ErrInvalidClient //nolint:wrapcheck
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// exact match only, RFC 6749 section 3.1.2.3
+	if !slices.Contains(app.RedirectURIs, redirectURI) {
+		logg.Warn("unregistered redirect uri",
+			slog.String("clientID", clientID),
+			slog.String("redirectURI", redirectURI))
+
+		return nil, ErrInvalidRedirectURI //nolint:wrapcheck
+	}
+
+	return app, nil
+}
+
+// Authorize logs the user in on behalf of the client and issues a single use
+// authorization code bound to the client, redirect uri and PKCE challenge.
+func (a *Auth) Authorize(ctx context.Context,
+	req AuthorizationRequest,
+	email,
+	password string) (string, error) {
+	const op = "service/auth.Authorize"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	app, err := a.AuthorizeClient(ctx, req.ClientID, req.RedirectURI)
+	if err != nil {
+		return "", err
+	}
+
+	if !app.AllowsGrantType(entity.GrantTypeAuthorizationCode) {
+		return "", ErrGrantTypeNotAllowed //nolint:wrapcheck
+	}
+
+	if !tokens.IsCodeChallenge(req.CodeChallenge) {
+		return "", ErrInvalidCodeChallenge //nolint:wrapcheck
+	}
+
+	user, err := a.authenticate(ctx, email, password)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := tokens.NewAuthorizationCode()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	authCode := &entity.AuthorizationCode{
+		Code:          *code,
+		UserID:        user.UserID,
+		AppID:         app.ID,
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+		FamilyID:      uuid.NewString(),
+		Scope:         a.grantedScope(req.Scope),
+		ExpiresAt:     time.Now().Add(AuthorizationCodeTTL),
+	}
+
+	if hasScope(authCode.Scope, entity.ScopeOpenID) {
+		authCode.Nonce = req.Nonce
+	}
+
+	err = a.authManager.SaveAuthorizationCode(ctx, authCode)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	logg.Info("authorization code issued",
+		slog.String("userID", user.UserID),
+		slog.Int("appID", int(app.ID)))
+
+	return *code, nil
+}
+
+// ExchangeAuthorizationCode redeems an authorization code for a token pair.
+// A code presented twice revokes the tokens of its first exchange,
+// RFC 6749 section 4.1.2.
+func (a *Auth) ExchangeAuthorizationCode(ctx context.Context,
+	req CodeExchange) (*entity.TokenPair, error) {
+	const op = "service/auth.ExchangeAuthorizationCode"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	app, err := a.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !app.AllowsGrantType(entity.GrantTypeAuthorizationCode) {
+		return nil, ErrGrantTypeNotAllowed //nolint:wrapcheck
+	}
+
+	if !tokens.IsAuthorizationCode(req.Code) {
+		return nil, ErrInvalidGrant //nolint:wrapcheck
+	}
+
+	code, err := a.authManager.ConsumeAuthorizationCode(ctx, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrAuthCodeReused):
+			logg.Warn("security event: authorization code reuse detected, revoking its tokens",
+				slog.String("event", "authorization_code_reuse"),
+				slog.String("userID", code.UserID),
+				slog.String("familyID", code.FamilyID))
+
+			err = a.authManager.RevokeRefreshFamily(ctx, code.FamilyID)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			return nil, ErrInvalidGrant //nolint:wrapcheck
+		case errors.Is(err, storage.ErrAuthCodeNotFound):
+			return nil, ErrInvalidGrant //nolint:wrapcheck
+		default:
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	// the code is spent even if the exchange is rejected, so it can't be guessed against.
+	if code.AppID != app.ID || code.RedirectURI != req.RedirectURI ||
+		!tokens.VerifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		logg.Info("authorization code exchange rejected",
+			slog.Int("appID", int(app.ID)))
+
+		return nil, ErrInvalidGrant //nolint:wrapcheck
+	}
+
+	pair, err := a.startSession(ctx, code.UserID, app, code.FamilyID, code.Scope)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.addIDToken(ctx, pair, app, code.UserID, code.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return pair, nil
+}
+
+// RefreshClientTokens rotates a refresh token presented by an oauth client,
+// the user is taken from the refresh session.
+func (a *Auth) RefreshClientTokens(ctx context.Context,
+	clientID,
+	clientSecret,
+	refreshToken string) (*entity.TokenPair, error) {
+	const op = "service/auth.RefreshClientTokens"
+
+	app, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tokens.CheckRefreshTokenFormat(refreshToken)
+	if err != nil {
+		return nil, ErrMalformedRefreshToken //nolint:wrapcheck
+	}
+
+	session, err := a.authManager.GetRefreshSession(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			return nil, ErrRefreshTokenNotFound //nolint:wrapcheck
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pair, err := a.refreshTokenPair(ctx, session.UserID, refreshToken, app.ID, session.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// refreshed ID tokens carry no nonce, OpenID Connect Core section 12.2.
+	err = a.addIDToken(ctx, pair, app, session.UserID, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return pair, nil
+}
+
+// ClientCredentials issues an access token to a confidential client acting on
+// its own behalf, RFC 6749 section 4.4. The token's sub is the client id and no
+// refresh token is issued, the client authenticates again instead.
+func (a *Auth) ClientCredentials(ctx context.Context,
+	clientID,
+	clientSecret string) (*entity.TokenPair, error) {
+	const op = "service/auth.ClientCredentials"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	// without a user only the secret proves who the client is.
+	app, err := a.authenticateConfidentialClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !app.AllowsGrantType(entity.GrantTypeClientCredentials) {
+		return nil, ErrGrantTypeNotAllowed //nolint:wrapcheck
+	}
+
+	accessToken, err := tokens.NewAccessToken(tokens.AccessTokenParams{
+		UserID:         app.ClientID,
+		AppID:          app.ID,
+		Issuer:         a.tokenCfg.Issuer,
+		TTL:            a.accessTTL(app),
+		Audience:       app.Audience,
+		ServiceAccount: true,
+		LegacyClaims:   a.tokenCfg.LegacyClaims,
+	}, a.keyRing.SigningKey())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logg.Info("service account token issued",
+		slog.String("clientID", clientID),
+		slog.Int("appID", int(app.ID)))
+
+	return &entity.TokenPair{
+		AccessToken: *accessToken,
+		ExpiresIn:   a.accessTTL(app),
+	}, nil
+}
+
+// authenticateClient finds the app of an oauth client. Confidential clients,
+// apps registered with a secret, must present it. Public clients have none
+// and rely on PKCE, a secret they send is ignored.
+func (a *Auth) authenticateClient(ctx context.Context,
+	clientID,
+	clientSecret string) (*entity.App, error) {
+	const op = "service/auth.authenticateClient"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	app, err := a.authManager.GetAppByClientID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, ErrInvalidClient //nolint:wrapcheck
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if isPublicClient(app) {
+		return app, nil
+	}
+
+	err = bcrypt.CompareHashAndPassword(app.ClientSecretHash, []byte(clientSecret))
+	if err != nil {
+		logg.Warn("wrong client secret", slog.String("clientID", clientID), sl.Err(err))
+
+		return nil, ErrInvalidClient //nolint:wrapcheck
+	}
+
+	return app, nil
+}
+
+// authenticateConfidentialClient is authenticateClient for grants where only
+// the secret proves who the client is, public clients are rejected.
+func (a *Auth) authenticateConfidentialClient(ctx context.Context,
+	clientID,
+	clientSecret string) (*entity.App, error) {
+	app, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if isPublicClient(app) {
+		return nil, ErrInvalidClient //nolint:wrapcheck
+	}
+
+	return app, nil
+}
+
+func isPublicClient(app *entity.App) bool {
+	return len(app.ClientSecretHash) == 0
+}
@@ -0,0 +1,188 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+const (
+	redirectURI  = "https://client.test/callback"
+	codeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	clientSecret = "client_secret"
+)
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	authService, strg := newTestAuth(t)
+	ctx := context.Background()
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	secretHash, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	client, err := strg.SaveApp(ctx, &entity.App{
+		Name:             "oauth client",
+		ClientSecretHash: secretHash,
+		RedirectURIs:     []string{redirectURI},
+	})
+	require.NoError(t, err)
+
+	authorize := func(t *testing.T) string {
+		t.Helper()
+
+		code, err := authService.Authorize(ctx, auth.AuthorizationRequest{
+			ClientID:      client.ClientID,
+			RedirectURI:   redirectURI,
+			CodeChallenge: tokens.PKCEChallenge(codeVerifier),
+		}, testEmail, testPassword)
+		require.NoError(t, err)
+
+		return code
+	}
+
+	exchange := func(code string) auth.CodeExchange {
+		return auth.CodeExchange{
+			Code:         code,
+			ClientID:     client.ClientID,
+			ClientSecret: clientSecret,
+			RedirectURI:  redirectURI,
+			CodeVerifier: codeVerifier,
+		}
+	}
+
+	t.Run("authorize checks case", func(t *testing.T) {
+		_, err := authService.AuthorizeClient(ctx, "unknown", redirectURI)
+		require.ErrorIs(t, err, auth.ErrInvalidClient)
+
+		_, err = authService.AuthorizeClient(ctx, client.ClientID, redirectURI+"/other")
+		require.ErrorIs(t, err, auth.ErrInvalidRedirectURI)
+
+		_, err = authService.Authorize(ctx, auth.AuthorizationRequest{
+			ClientID:    client.ClientID,
+			RedirectURI: redirectURI,
+		}, testEmail, testPassword)
+		require.ErrorIs(t, err, auth.ErrInvalidCodeChallenge)
+	})
+
+	t.Run("ok case", func(t *testing.T) {
+		req := exchange(authorize(t))
+
+		pair, err := authService.ExchangeAuthorizationCode(ctx, req)
+		require.NoError(t, err)
+		require.NotZero(t, pair.ExpiresIn)
+
+		claims, err := authService.ValidateToken(ctx, pair.AccessToken, client.ID)
+		require.NoError(t, err)
+		require.Equal(t, client.ID, claims.AppID)
+
+		refreshed, err := authService.RefreshClientTokens(ctx,
+			client.ClientID, clientSecret, pair.RefreshToken)
+		require.NoError(t, err)
+		require.NotEqual(t, pair.RefreshToken, refreshed.RefreshToken)
+	})
+
+	t.Run("wrong verifier case", func(t *testing.T) {
+		req := exchange(authorize(t))
+		req.CodeVerifier = "Wrong-verifier-of-the-same-length-0123456789"
+
+		_, err := authService.ExchangeAuthorizationCode(ctx, req)
+		require.ErrorIs(t, err, auth.ErrInvalidGrant)
+
+		// the rejected code is spent.
+		_, err = authService.ExchangeAuthorizationCode(ctx, exchange(req.Code))
+		require.ErrorIs(t, err, auth.ErrInvalidGrant)
+	})
+
+	t.Run("wrong redirect uri case", func(t *testing.T) {
+		req := exchange(authorize(t))
+		req.RedirectURI = "https://client.test/other"
+
+		_, err := authService.ExchangeAuthorizationCode(ctx, req)
+		require.ErrorIs(t, err, auth.ErrInvalidGrant)
+	})
+
+	t.Run("wrong client secret case", func(t *testing.T) {
+		req := exchange(authorize(t))
+		req.ClientSecret = "wrong"
+
+		_, err := authService.ExchangeAuthorizationCode(ctx, req)
+		require.ErrorIs(t, err, auth.ErrInvalidClient)
+	})
+
+	t.Run("missing client secret case", func(t *testing.T) {
+		req := exchange(authorize(t))
+		req.ClientSecret = ""
+
+		// a confidential client is not authenticated by its public id.
+		_, err := authService.ExchangeAuthorizationCode(ctx, req)
+		require.ErrorIs(t, err, auth.ErrInvalidClient)
+
+		pair, err := authService.ExchangeAuthorizationCode(ctx, exchange(authorize(t)))
+		require.NoError(t, err)
+
+		_, err = authService.RefreshClientTokens(ctx, client.ClientID, "", pair.RefreshToken)
+		require.ErrorIs(t, err, auth.ErrInvalidClient)
+	})
+
+	t.Run("code reuse case", func(t *testing.T) {
+		code := authorize(t)
+
+		pair, err := authService.ExchangeAuthorizationCode(ctx, exchange(code))
+		require.NoError(t, err)
+
+		_, err = authService.ExchangeAuthorizationCode(ctx, exchange(code))
+		require.ErrorIs(t, err, auth.ErrInvalidGrant)
+
+		// tokens of the first exchange are revoked.
+		_, err = authService.RefreshClientTokens(ctx, client.ClientID, clientSecret, pair.RefreshToken)
+		require.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+	})
+}
+
+func TestPublicClient(t *testing.T) {
+	authService, strg := newTestAuth(t)
+	ctx := context.Background()
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	// registered without a secret, PKCE protects its codes.
+	client, err := strg.SaveApp(ctx, &entity.App{
+		Name:         "public client",
+		RedirectURIs: []string{redirectURI},
+	})
+	require.NoError(t, err)
+
+	code, err := authService.Authorize(ctx, auth.AuthorizationRequest{
+		ClientID:      client.ClientID,
+		RedirectURI:   redirectURI,
+		CodeChallenge: tokens.PKCEChallenge(codeVerifier),
+	}, testEmail, testPassword)
+	require.NoError(t, err)
+
+	pair, err := authService.ExchangeAuthorizationCode(ctx, auth.CodeExchange{
+		Code:         code,
+		ClientID:     client.ClientID,
+		RedirectURI:  redirectURI,
+		CodeVerifier: codeVerifier,
+	})
+	require.NoError(t, err)
+
+	_, err = authService.RefreshClientTokens(ctx, client.ClientID, "", pair.RefreshToken)
+	require.NoError(t, err)
+
+	// grants authenticated by the secret alone are not for public clients.
+	_, err = authService.ClientCredentials(ctx, client.ClientID, "")
+	require.ErrorIs(t, err, auth.ErrInvalidClient)
+
+	_, err = authService.IntrospectToken(ctx, client.ClientID, "", pair.AccessToken)
+	require.ErrorIs(t, err, auth.ErrInvalidClient)
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+var (
+	ErrOpenIDDisabled    = errors.New("OpenID Connect requires an http(s) issuer and asymmetric signing keys")
+	ErrInsufficientScope = errors.New("access token is not granted the openid scope")
+)
+
+// OpenIDConfiguration describes the OpenID Connect provider. Endpoint urls are
+// left to the transport serving them.
+func (a *Auth) OpenIDConfiguration(_ context.Context) (*entity.OpenIDConfiguration, error) {
+	if !a.openIDEnabled() {
+		return nil, ErrOpenIDDisabled //nolint:wrapcheck
+	}
+
+	config := &entity.OpenIDConfiguration{
+		Issuer:                 a.tokenCfg.Issuer,
+		ScopesSupported:        entity.Scopes,
+		ResponseTypesSupported: []string{"code"},
+		GrantTypesSupported: []string{
+			entity.GrantTypeAuthorizationCode,
+			entity.GrantTypeRefreshToken,
+			entity.GrantTypeClientCredentials,
+		},
+		SubjectTypesSupported: []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{
+			a.keyRing.SigningKey().Method().Alg(),
+		},
+		TokenEndpointAuthMethodsSupported: []string{
+			"client_secret_basic",
+			"client_secret_post",
+			"none",
+		},
+		CodeChallengeMethodsSupported: []string{tokens.PKCEMethodS256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "nonce", "email", "preferred_username",
+		},
+	}
+
+	if a.tokenCfg.VerificationURI != "" {
+		config.GrantTypesSupported = append(config.GrantTypesSupported, entity.GrantTypeDeviceCode)
+	}
+
+	return config, nil
+}
+
+// UserInfo returns the claims about the owner of an access token granted the
+// openid scope, OpenID Connect Core section 5.3.
+func (a *Auth) UserInfo(ctx context.Context, accessToken string) (*entity.UserInfo, error) {
+	const op = "service/auth.UserInfo"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	// the token may be issued for any app, ValidateToken checks the rest.
+	inspected, err := tokens.InspectAccessToken(accessToken, a.keyRing, a.tokenCfg.Issuer)
+	if err != nil {
+		logg.Info("invalid access token", sl.Err(err))
+
+		return nil, ErrInvalidAccessToken //nolint:wrapcheck
+	}
+
+	claims, err := a.ValidateToken(ctx, accessToken, inspected.AppID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasScope(claims.Scope, entity.ScopeOpenID) {
+		return nil, ErrInsufficientScope //nolint:wrapcheck
+	}
+
+	user, err := a.authManager.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, ErrInvalidAccessToken //nolint:wrapcheck
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userInfo(user, claims.Scope), nil
+}
+
+// addIDToken adds an ID token to a pair issued with the openid scope.
+func (a *Auth) addIDToken(ctx context.Context,
+	pair *entity.TokenPair,
+	app *entity.App,
+	userID,
+	nonce string) error {
+	if !hasScope(pair.Scope, entity.ScopeOpenID) {
+		return nil
+	}
+
+	user, err := a.authManager.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	idToken, err := tokens.NewIDToken(tokens.IDTokenParams{
+		User:     *userInfo(user, pair.Scope),
+		ClientID: app.ClientID,
+		Issuer:   a.tokenCfg.Issuer,
+		TTL:      a.accessTTL(app),
+		Nonce:    nonce,
+	}, a.keyRing.SigningKey())
+	if err != nil {
+		return fmt.Errorf("failed to create id token: %w", err)
+	}
+
+	pair.IDToken = *idToken
+
+	return nil
+}
+
+// grantedScope keeps the known scopes of a request. The openid scope is only
+// granted if relying parties can verify ID tokens.
+func (a *Auth) grantedScope(requested string) string {
+	granted := make([]string, 0, len(entity.Scopes))
+
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(entity.Scopes, scope) || slices.Contains(granted, scope) {
+			continue
+		}
+
+		if scope == entity.ScopeOpenID && !a.openIDEnabled() {
+			continue
+		}
+
+		granted = append(granted, scope)
+	}
+
+	return strings.Join(granted, " ")
+}
+
+// openIDEnabled reports whether the issuer is a url discovery can be served
+// at and ID tokens are verifiable with the JWKS.
+func (a *Auth) openIDEnabled() bool {
+	issuer, err := url.Parse(a.tokenCfg.Issuer)
+	if err != nil || issuer.Host == "" ||
+		(issuer.Scheme != "https" && issuer.Scheme != "http") {
+		return false
+	}
+
+	return !a.keyRing.SigningKey().IsSymmetric()
+}
+
+func userInfo(user *entity.User, scope string) *entity.UserInfo {
+	info := &entity.UserInfo{
+		Subject: user.UserID,
+	}
+
+	if hasScope(scope, entity.ScopeEmail) {
+		info.Email = user.Email
+	}
+
+	// the email is the only name a user has.
+	if hasScope(scope, entity.ScopeProfile) {
+		info.PreferredUsername = user.Email
+	}
+
+	return info
+}
+
+func hasScope(scope, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
@@ -0,0 +1,214 @@
+package auth_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/passwords"
+	"github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+const (
+	testEmail    = "refresh@test.com"
+	testPassword = "password"
+	appID        = 1
+	otherAppID   = 2
+	unknownAppID = 3
+)
+
+func TestRefreshTokenPairAppBinding(t *testing.T) {
+	cases := []struct {
+		testName      string
+		sessionAppID  int32 // 0 for sessions stored before apps were recorded
+		refreshAppID  int32
+		expectedError error
+	}{
+		{
+			testName:     "same app case",
+			sessionAppID: appID,
+			refreshAppID: appID,
+		},
+		{
+			testName:      "another app case",
+			sessionAppID:  appID,
+			refreshAppID:  otherAppID,
+			expectedError: auth.ErrAppMismatch,
+		},
+		{
+			testName:      "non-existent app case",
+			sessionAppID:  appID,
+			refreshAppID:  unknownAppID,
+			expectedError: auth.ErrAppNotFound,
+		},
+		{
+			testName:      "legacy session case",
+			sessionAppID:  0,
+			refreshAppID:  appID,
+			expectedError: auth.ErrAppMismatch,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			authService, strg := newTestAuth(t)
+			ctx := context.Background()
+
+			userID, err := authService.RegisterUser(ctx, testEmail, testPassword)
+			require.NoError(t, err)
+
+			refreshToken := newSession(t, authService, strg, *userID, tcase.sessionAppID)
+
+			pair, err := authService.RefreshTokenPair(ctx, *userID, refreshToken, tcase.refreshAppID)
+			require.ErrorIs(t, err, tcase.expectedError)
+
+			if tcase.expectedError != nil {
+				// a rejected attempt does not consume the token, sessions
+				// without an app are refreshed by none.
+				_, err = authService.RefreshTokenPair(ctx, *userID, refreshToken, appID)
+				if tcase.sessionAppID == 0 {
+					require.ErrorIs(t, err, auth.ErrAppMismatch)
+				} else {
+					require.NoError(t, err)
+				}
+
+				return
+			}
+
+			claims, err := authService.ValidateToken(ctx, pair.AccessToken, tcase.refreshAppID)
+			require.NoError(t, err)
+			require.Equal(t, tcase.refreshAppID, claims.AppID)
+
+			// the successor stays bound to the app it was refreshed for.
+			_, err = authService.RefreshTokenPair(ctx, *userID, pair.RefreshToken,
+				otherAppID+appID-tcase.refreshAppID)
+			require.ErrorIs(t, err, auth.ErrAppMismatch)
+		})
+	}
+}
+
+// newSession logs the user into appID, or stores a session without an app
+// the way releases before app binding did if appID is 0.
+func newSession(t *testing.T,
+	authService *auth.Auth,
+	strg *storage.Storage,
+	userID string,
+	appID int32) string {
+	t.Helper()
+
+	if appID != 0 {
+		pair, err := authService.Login(context.Background(), testEmail, testPassword, appID)
+		require.NoError(t, err)
+
+		return pair.RefreshToken
+	}
+
+	refreshToken, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+
+	err = strg.NewRefreshSession(context.Background(), &entity.RefreshSession{
+		RefreshToken: *refreshToken,
+		UserID:       userID,
+		FamilyID:     uuid.NewString(),
+		ExpiresAt:    time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	return *refreshToken
+}
+
+// newTestAuth creates the service over an empty migrated database with two apps.
+func newTestAuth(t *testing.T) (*auth.Auth, *storage.Storage) {
+	t.Helper()
+
+	authService, strg, _ := newThrottledTestAuth(t, auth.LoginThrottleConfig{})
+
+	return authService, strg
+}
+
+// newThrottledTestAuth also returns the database, tests set up admins in it.
+func newThrottledTestAuth(t *testing.T,
+	throttle auth.LoginThrottleConfig) (*auth.Auth, *storage.Storage, *sqlx.DB) {
+	t.Helper()
+
+	storagePath := filepath.Join(t.TempDir(), "sso.db")
+
+	err := storage.MigrateUp(storage.DriverSQLite, storagePath)
+	require.NoError(t, err)
+
+	db, err := sqlx.Open("sqlite3", storagePath)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	_, err = db.Exec(`insert into apps(id, name) values(?, 'first'), (?, 'second')`, appID, otherAppID)
+	require.NoError(t, err)
+
+	logg := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	strg, err := storage.New(logg, storage.DriverSQLite, storagePath, []byte("test_hash_key"))
+	require.NoError(t, err)
+
+	key, err := tokens.NewSecretKey("test_secret_key")
+	require.NoError(t, err)
+
+	hasher := passwords.NewArgon2id(passwords.DefaultArgon2idParams, 0)
+
+	authService := auth.New(logg, strg, tokens.NewKeyRing(key, time.Minute), hasher, auth.TokenConfig{
+		AccessTTL:       time.Minute,
+		RefreshTTL:      time.Hour,
+		Issuer:          "test",
+		VerificationURI: "https://sso.test/device",
+		LoginThrottle:   throttle,
+	})
+
+	return authService, strg, db
+}
+
+func TestAccessTTLCappedAtKeyRetention(t *testing.T) {
+	authService, _, db := newThrottledTestAuth(t, auth.LoginThrottleConfig{})
+	ctx := context.Background()
+
+	// stored before longer ttls were rejected, the key ring retains keys for a minute.
+	_, err := db.Exec(`update apps set accessTTL = ? where id = ?`, time.Hour.Seconds(), appID)
+	require.NoError(t, err)
+
+	_, err = authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	pair, err := authService.Login(ctx, testEmail, testPassword, appID)
+	require.NoError(t, err)
+
+	claims, err := authService.ValidateToken(ctx, pair.AccessToken, appID)
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, claims.ExpiresAt.Sub(claims.IssuedAt))
+}
+
+func TestValidateTokenOfDeletedApp(t *testing.T) {
+	authService, strg := newTestAuth(t)
+	ctx := context.Background()
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	pair, err := authService.Login(ctx, testEmail, testPassword, appID)
+	require.NoError(t, err)
+
+	err = strg.DeleteApp(ctx, appID)
+	require.NoError(t, err)
+
+	_, err = authService.ValidateToken(ctx, pair.AccessToken, appID)
+	require.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+}
@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+var ErrLoginThrottled = errors.New("too many failed logins")
+
+// LoginThrottledError is returned while password logins of an account or a
+// client address are backed off or locked out after failed attempts.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrLoginThrottled, e.RetryAfter)
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return ErrLoginThrottled
+}
+
+// RetryAfterSeconds returns the wait rounded up to whole seconds, as the
+// retry-after headers carry it.
+func (e *LoginThrottledError) RetryAfterSeconds() int64 {
+	return int64(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// LoginThrottleConfig limits password guessing. Failed logins are counted per
+// account and per client address. Past FreeFailures of an account, or
+// IPFreeFailures of an address, every failure doubles the wait before the next
+// attempt, starting at BackoffBase; at a threshold the
+// account or address is locked out. Failures are forgotten the longer of
+// Lockout and BackoffMax after the last one, or for an account by a successful
+// login or UnlockAccount.
+type LoginThrottleConfig struct {
+	Enabled          bool
+	FreeFailures     int
+	IPFreeFailures   int           // many users may share an address
+	BackoffBase      time.Duration // 0 disables backoff
+	BackoffMax       time.Duration
+	AccountThreshold int // 0 never locks accounts out
+	IPThreshold      int // 0 never locks addresses out
+	Lockout          time.Duration
+}
+
+// storage interfaces.
+type LoginFailureCounter interface {
+	ReserveLoginAttempt(ctx context.Context,
+		key string,
+		attemptAt, resetBefore time.Time,
+		check func(*entity.LoginFailures) error) (*entity.LoginFailures, error)
+	ReleaseLoginAttempt(ctx context.Context, key string) error
+	ResetLoginFailures(ctx context.Context, key string) error
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns ctx carrying the address of the client logging in, so
+// failed logins are throttled per address as well.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func clientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+
+	return ip
+}
+
+type throttleCounter struct {
+	key          string
+	isAccount    bool
+	freeFailures int
+	threshold    int
+}
+
+// throttleCounters returns the failure counters of a login attempt.
+func (a *Auth) throttleCounters(ctx context.Context, email string) []throttleCounter {
+	cfg := a.tokenCfg.LoginThrottle
+
+	counters := []throttleCounter{{
+		key:          accountKey(email),
+		isAccount:    true,
+		freeFailures: cfg.FreeFailures,
+		threshold:    cfg.AccountThreshold,
+	}}
+
+	if ip := clientIP(ctx); ip != "" {
+		counters = append(counters, throttleCounter{
+			key:          ipKey(ip),
+			freeFailures: cfg.IPFreeFailures,
+			threshold:    cfg.IPThreshold,
+		})
+	}
+
+	return counters
+}
+
+// loginAttempt is an attempt reserved on a failure counter, with the count
+// including it.
+type loginAttempt struct {
+	counter  throttleCounter
+	failures int
+}
+
+// reserveLoginAttempt counts a login attempt of email as failed for the
+// account and the client address before its password is checked, so parallel
+// guesses cannot all pass the throttle before the first failure is counted.
+// Returns a LoginThrottledError instead if the account or the address must
+// wait before the next attempt.
+func (a *Auth) reserveLoginAttempt(ctx context.Context, email string) ([]loginAttempt, error) {
+	const op = "service/auth.reserveLoginAttempt"
+
+	if !a.tokenCfg.LoginThrottle.Enabled {
+		return nil, nil
+	}
+
+	cfg := a.tokenCfg.LoginThrottle
+	now := time.Now()
+	resetBefore := now.Add(-max(cfg.Lockout, cfg.BackoffMax))
+
+	counters := a.throttleCounters(ctx, email)
+	attempts := make([]loginAttempt, 0, len(counters))
+
+	for _, counter := range counters {
+		failures, err := a.authManager.ReserveLoginAttempt(ctx, counter.key, now, resetBefore,
+			func(failures *entity.LoginFailures) error {
+				retryAfter := a.blockedUntil(failures, counter).Sub(now)
+				if retryAfter <= 0 {
+					return nil
+				}
+
+				return &LoginThrottledError{RetryAfter: retryAfter}
+			})
+		if err != nil {
+			a.releaseLoginAttempt(ctx, attempts)
+
+			if errors.Is(err, ErrLoginThrottled) {
+				a.logg.Warn("login throttled", slog.String("op", op),
+					slog.String("clientIP", clientIP(ctx)),
+					sl.Err(err))
+
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		attempts = append(attempts, loginAttempt{
+			counter:  counter,
+			failures: failures.Failures,
+		})
+	}
+
+	return attempts, nil
+}
+
+// blockedUntil returns when the next attempt is allowed after failures of
+// counter.
+func (a *Auth) blockedUntil(failures *entity.LoginFailures, counter throttleCounter) time.Time {
+	cfg := a.tokenCfg.LoginThrottle
+
+	switch {
+	case counter.threshold > 0 && failures.Failures >= counter.threshold:
+		return failures.LastFailureAt.Add(cfg.Lockout)
+	case cfg.BackoffBase > 0 && failures.Failures > counter.freeFailures:
+		// capped before shifting, the shift would overflow.
+		backoff := cfg.BackoffMax
+		if doublings := failures.Failures - counter.freeFailures - 1; doublings < 32 {
+			backoff = min(cfg.BackoffBase<<doublings, cfg.BackoffMax)
+		}
+
+		return failures.LastFailureAt.Add(backoff)
+	default:
+		return time.Time{}
+	}
+}
+
+// recordLoginFailure keeps the reserved attempts as failures.
+func (a *Auth) recordLoginFailure(attempts []loginAttempt) {
+	const op = "service/auth.recordLoginFailure"
+
+	for _, attempt := range attempts {
+		if attempt.counter.threshold > 0 && attempt.failures == attempt.counter.threshold {
+			a.logg.Warn("login locked out", slog.String("op", op),
+				slog.String("key", attempt.counter.key),
+				slog.Duration("lockout", a.tokenCfg.LoginThrottle.Lockout))
+		}
+	}
+}
+
+// recordLoginSuccess forgets failed logins of the account after a successful
+// one. The attempt is only taken back from the client address, logging into
+// an own account must not reset guesses at others.
+func (a *Auth) recordLoginSuccess(ctx context.Context, attempts []loginAttempt) {
+	for _, attempt := range attempts {
+		var err error
+
+		if attempt.counter.isAccount {
+			err = a.authManager.ResetLoginFailures(ctx, attempt.counter.key)
+		} else {
+			err = a.authManager.ReleaseLoginAttempt(ctx, attempt.counter.key)
+		}
+
+		if err != nil {
+			a.logg.Error("failed to reset login failures", sl.Err(err))
+		}
+	}
+}
+
+// releaseLoginAttempt takes back attempts that ended before the password was
+// checked.
+func (a *Auth) releaseLoginAttempt(ctx context.Context, attempts []loginAttempt) {
+	for _, attempt := range attempts {
+		err := a.authManager.ReleaseLoginAttempt(ctx, attempt.counter.key)
+		if err != nil {
+			a.logg.Error("failed to release login attempt", sl.Err(err))
+		}
+	}
+}
+
+// UnlockAccount forgets failed logins of an account, of a client address, or
+// both, ending their backoff or lockout. The caller must present an admin
+// access token issued for appID.
+func (a *Auth) UnlockAccount(ctx context.Context,
+	adminToken string,
+	appID int32,
+	email,
+	ip string) error {
+	const op = "service/auth.UnlockAccount"
+
+	logg := a.logg.With(slog.String("op", op))
+
+	admin, err := a.AuthorizeAdmin(ctx, adminToken, appID)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, 2) //nolint:mnd
+
+	if email != "" {
+		keys = append(keys, accountKey(email))
+	}
+
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+
+	for _, key := range keys {
+		err = a.authManager.ResetLoginFailures(ctx, key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		logg.Info("login failures reset",
+			slog.String("adminID", admin.UserID),
+			slog.String("key", key))
+	}
+
+	return nil
+}
+
+// emails are matched case-insensitively, so varying the case does not get
+// another counter.
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
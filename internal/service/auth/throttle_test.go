@@ -0,0 +1,208 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/service/auth"
+)
+
+const wrongPassword = "wrong-password"
+
+func TestLoginBackoff(t *testing.T) {
+	authService, _, _ := newThrottledTestAuth(t, auth.LoginThrottleConfig{
+		Enabled:      true,
+		FreeFailures: 2,
+		BackoffBase:  time.Hour,
+		BackoffMax:   2 * time.Hour,
+	})
+	ctx := context.Background()
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	// free failures and the one starting the backoff.
+	for range 3 {
+		_, err = authService.Login(ctx, testEmail, wrongPassword, appID)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	}
+
+	_, err = authService.Login(ctx, testEmail, testPassword, appID)
+	requireThrottled(t, err, time.Hour)
+}
+
+func TestLoginAccountLockout(t *testing.T) {
+	authService, _, db := newThrottledTestAuth(t, auth.LoginThrottleConfig{
+		Enabled:          true,
+		AccountThreshold: 3,
+		Lockout:          time.Hour,
+	})
+	ctx := context.Background()
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err = authService.Login(auth.WithClientIP(ctx, "192.0.2.1"), testEmail, wrongPassword, appID)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	}
+
+	// the account is locked out from any address, whatever the case of the email.
+	_, err = authService.Login(auth.WithClientIP(ctx, "192.0.2.2"), "REFRESH@test.com", testPassword, appID)
+	requireThrottled(t, err, time.Hour)
+
+	const adminEmail = "admin@test.com"
+
+	_, err = authService.RegisterUser(ctx, adminEmail, testPassword)
+	require.NoError(t, err)
+
+	adminTokens, err := authService.Login(ctx, adminEmail, testPassword, appID)
+	require.NoError(t, err)
+
+	err = authService.UnlockAccount(ctx, adminTokens.AccessToken, appID, testEmail, "")
+	require.ErrorIs(t, err, auth.ErrPermissionDenied)
+
+	_, err = db.Exec(`update users set isAdmin = true where email = ?`, adminEmail)
+	require.NoError(t, err)
+
+	adminTokens, err = authService.Login(ctx, adminEmail, testPassword, appID)
+	require.NoError(t, err)
+
+	err = authService.UnlockAccount(ctx, adminTokens.AccessToken, appID, testEmail, "")
+	require.NoError(t, err)
+
+	_, err = authService.Login(ctx, testEmail, testPassword, appID)
+	require.NoError(t, err)
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	authService, _, _ := newThrottledTestAuth(t, auth.LoginThrottleConfig{
+		Enabled:     true,
+		IPThreshold: 2,
+		Lockout:     time.Hour,
+	})
+	ctx := context.Background()
+	attackerCtx := auth.WithClientIP(ctx, "192.0.2.1")
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	// guessing at different accounts is counted for the address.
+	for _, email := range []string{"first@test.com", "second@test.com"} {
+		_, err = authService.Login(attackerCtx, email, wrongPassword, appID)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	}
+
+	_, err = authService.Login(attackerCtx, testEmail, testPassword, appID)
+	requireThrottled(t, err, time.Hour)
+
+	_, err = authService.Login(auth.WithClientIP(ctx, "192.0.2.2"), testEmail, testPassword, appID)
+	require.NoError(t, err)
+}
+
+func TestLoginIPBackoff(t *testing.T) {
+	authService, _, _ := newThrottledTestAuth(t, auth.LoginThrottleConfig{
+		Enabled:        true,
+		FreeFailures:   1,
+		IPFreeFailures: 3,
+		BackoffBase:    time.Hour,
+		BackoffMax:     2 * time.Hour,
+	})
+	ctx := context.Background()
+	sharedCtx := auth.WithClientIP(ctx, "192.0.2.1")
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	// users behind one address get the larger budget of the address.
+	for _, email := range []string{"first@test.com", "second@test.com", "third@test.com"} {
+		_, err = authService.Login(sharedCtx, email, wrongPassword, appID)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	}
+
+	_, err = authService.Login(sharedCtx, testEmail, testPassword, appID)
+	require.NoError(t, err)
+
+	_, err = authService.Login(sharedCtx, "fourth@test.com", wrongPassword, appID)
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+	_, err = authService.Login(sharedCtx, testEmail, testPassword, appID)
+	requireThrottled(t, err, time.Hour)
+}
+
+func TestLoginSuccessResetsFailures(t *testing.T) {
+	authService, _, _ := newThrottledTestAuth(t, auth.LoginThrottleConfig{
+		Enabled:          true,
+		AccountThreshold: 3,
+		Lockout:          time.Hour,
+	})
+	ctx := context.Background()
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	for range 2 {
+		for range 2 {
+			_, err = authService.Login(ctx, testEmail, wrongPassword, appID)
+			require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+		}
+
+		_, err = authService.Login(ctx, testEmail, testPassword, appID)
+		require.NoError(t, err)
+	}
+}
+
+func TestLoginParallelGuesses(t *testing.T) {
+	authService, _, _ := newThrottledTestAuth(t, auth.LoginThrottleConfig{
+		Enabled:      true,
+		FreeFailures: 2,
+		BackoffBase:  time.Hour,
+		BackoffMax:   2 * time.Hour,
+	})
+	ctx := context.Background()
+
+	_, err := authService.RegisterUser(ctx, testEmail, testPassword)
+	require.NoError(t, err)
+
+	const guesses = 10
+
+	errs := make(chan error, guesses)
+
+	for range guesses {
+		go func() {
+			_, err := authService.Login(ctx, testEmail, wrongPassword, appID)
+			errs <- err
+		}()
+	}
+
+	checked := 0
+
+	for range guesses {
+		err = <-errs
+		if errors.Is(err, auth.ErrLoginThrottled) {
+			continue
+		}
+
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+		checked++
+	}
+
+	// guesses racing each other get no more than the free failures and the
+	// one starting the backoff.
+	require.Equal(t, 3, checked)
+}
+
+func requireThrottled(t *testing.T, err error, wait time.Duration) {
+	t.Helper()
+
+	var throttled *auth.LoginThrottledError
+
+	require.ErrorAs(t, err, &throttled)
+	require.ErrorIs(t, err, auth.ErrLoginThrottled)
+	require.InDelta(t, wait.Seconds(), throttled.RetryAfter.Seconds(), time.Minute.Seconds())
+}
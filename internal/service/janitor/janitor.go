@@ -0,0 +1,122 @@
+package janitor
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aspirin100/gRPC-SSO/pkg/logger/sl"
+)
+
+// metrics published on /debug/vars of the metrics server.
+var (
+	purgedSessions = expvar.NewInt("janitor_purged_refresh_sessions")
+	purgeRuns      = expvar.NewInt("janitor_runs")
+	purgeFailures  = expvar.NewInt("janitor_failures")
+)
+
+const defaultBatchSize = 1000
+
+// Janitor deletes refresh sessions that can no longer be refreshed. Used and
+// expired sessions are kept for the retention first, so a replayed token is
+// still recognised as reused and revokes its family.
+type Janitor struct {
+	logg   *slog.Logger
+	purger SessionPurger
+	cfg    Config
+}
+
+// storage interfaces.
+type SessionPurger interface {
+	DeleteExpiredRefreshSessions(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+type Config struct {
+	Interval  time.Duration
+	Retention time.Duration
+	BatchSize int // sessions deleted by one statement, 1000 if not set.
+}
+
+func New(logg *slog.Logger, purger SessionPurger, cfg Config) *Janitor {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+
+	return &Janitor{
+		logg:   logg,
+		purger: purger,
+		cfg:    cfg,
+	}
+}
+
+// Run purges sessions every interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context) {
+	const op = "janitor.Run"
+
+	logg := j.logg.With(slog.String("op", op))
+
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := j.Purge(ctx)
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+
+				logg.Error("refresh sessions purge failed", sl.Err(err))
+
+				continue
+			}
+
+			if purged > 0 {
+				logg.Info("refresh sessions purged", slog.Int64("count", purged))
+			}
+		}
+	}
+}
+
+// Purge deletes sessions unusable for longer than the retention in batches of
+// BatchSize, until none is left or ctx is done. Returns the number of deleted
+// sessions, including those deleted before an error.
+func (j *Janitor) Purge(ctx context.Context) (int64, error) {
+	const op = "janitor.Purge"
+
+	purgeRuns.Add(1)
+
+	before := time.Now().Add(-j.cfg.Retention)
+
+	var purged int64
+
+	for {
+		deleted, err := j.purger.DeleteExpiredRefreshSessions(ctx, before, j.cfg.BatchSize)
+		if err != nil {
+			// interrupted by shutdown is not a failure.
+			if ctx.Err() == nil {
+				purgeFailures.Add(1)
+			}
+
+			return purged, fmt.Errorf("%s: %w", op, err)
+		}
+
+		purged += deleted
+		purgedSessions.Add(deleted)
+
+		if deleted < int64(j.cfg.BatchSize) {
+			return purged, nil
+		}
+
+		err = ctx.Err()
+		if err != nil {
+			return purged, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+}
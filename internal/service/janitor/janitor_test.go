@@ -0,0 +1,89 @@
+package janitor_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/service/janitor"
+	"github.com/aspirin100/gRPC-SSO/internal/storage/memory"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+func TestPurge(t *testing.T) {
+	userID := uuid.NewString()
+
+	cases := []struct {
+		testName       string
+		retention      time.Duration
+		expectedPurged int64
+	}{
+		{
+			testName:       "retention case",
+			retention:      time.Hour,
+			expectedPurged: 3,
+		},
+		{
+			testName:       "used token case",
+			retention:      0,
+			expectedPurged: 6,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			strg := memory.New()
+			ctx := context.Background()
+
+			newSession := func(expiresAt time.Time) string {
+				refreshToken, err := tokens.NewRefreshToken()
+				require.NoError(t, err)
+
+				err = strg.NewRefreshSession(ctx, &entity.RefreshSession{
+					RefreshToken: *refreshToken,
+					UserID:       userID,
+					FamilyID:     uuid.NewString(),
+					ExpiresAt:    expiresAt,
+				})
+				require.NoError(t, err)
+
+				return *refreshToken
+			}
+
+			for range 3 {
+				newSession(time.Now().Add(-2 * time.Hour))
+			}
+
+			// used just now, kept for the retention.
+			for range 3 {
+				usedToken := newSession(time.Now().Add(time.Hour))
+
+				next, err := tokens.NewRefreshToken()
+				require.NoError(t, err)
+
+				_, err = strg.RotateRefreshSession(ctx, usedToken, userID, &entity.RefreshSession{
+					RefreshToken: *next,
+					UserID:       userID,
+					ExpiresAt:    time.Now().Add(time.Hour),
+				})
+				require.NoError(t, err)
+			}
+
+			// batches smaller than the purge are repeated.
+			j := janitor.New(slog.Default(), strg, janitor.Config{
+				Interval:  time.Hour,
+				Retention: tcase.retention,
+				BatchSize: 2,
+			})
+
+			purged, err := j.Purge(ctx)
+			require.NoError(t, err)
+			require.Equal(t, tcase.expectedPurged, purged)
+		})
+	}
+}
@@ -0,0 +1,777 @@
+// Package memory is a storage backend keeping everything in process memory,
+// for demos and tests. It behaves like the sql storage, data is lost on exit.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+type Storage struct {
+	mu sync.Mutex
+
+	users              map[string]*user // by id
+	apps               map[int32]*entity.App
+	refreshSessions    map[string]*refreshSession           // by token
+	authorizationCodes map[string]*entity.AuthorizationCode // by code
+	devices            map[string]*device                   // by device code
+	revokedTokens      map[string]time.Time                 // jti to token expiry
+	loginFailures      map[string]entity.LoginFailures
+	// ids of deleted apps are never reused, their tokens name them in aud.
+	lastAppID int32
+}
+
+// errTokenExists is returned when a random token is stored twice, where a
+// database fails on its primary key.
+var errTokenExists = errors.New("token already exists")
+
+type user struct {
+	entity.User
+	isAdmin          bool
+	tokensValidAfter time.Time
+}
+
+type refreshSession struct {
+	entity.RefreshSession
+	usedAt time.Time
+}
+
+type device struct {
+	entity.DeviceAuthorization
+	isUsed bool
+}
+
+func New() *Storage {
+	return &Storage{
+		users:              make(map[string]*user),
+		apps:               make(map[int32]*entity.App),
+		refreshSessions:    make(map[string]*refreshSession),
+		authorizationCodes: make(map[string]*entity.AuthorizationCode),
+		devices:            make(map[string]*device),
+		revokedTokens:      make(map[string]time.Time),
+		loginFailures:      make(map[string]entity.LoginFailures),
+	}
+}
+
+func (s *Storage) SaveUser(_ context.Context,
+	email string,
+	passHash []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.users {
+		if stored.Email == email {
+			return "", storage.ErrUserExists
+		}
+	}
+
+	userID := uuid.NewString()
+
+	s.users[userID] = &user{
+		User: entity.User{
+			UserID:   userID,
+			Email:    email,
+			PassHash: slices.Clone(passHash),
+		},
+	}
+
+	return userID, nil
+}
+
+func (s *Storage) GetUser(_ context.Context, email string) (*entity.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.users {
+		if stored.Email == email {
+			found := stored.User
+
+			return &found, nil
+		}
+	}
+
+	return nil, storage.ErrUserNotFound
+}
+
+// GetUserByID finds a user by id, the subject of issued tokens.
+func (s *Storage) GetUserByID(_ context.Context, userID string) (*entity.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[userID]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+
+	found := stored.User
+
+	return &found, nil
+}
+
+func (s *Storage) IsAdmin(_ context.Context, userID string) (*bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[userID]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+
+	isAdmin := stored.isAdmin
+
+	return &isAdmin, nil
+}
+
+// UpdatePasswordHash replaces the password hash of the user, rehashed with
+// current parameters.
+func (s *Storage) UpdatePasswordHash(_ context.Context, userID string, passHash []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+
+	stored.PassHash = slices.Clone(passHash)
+
+	return nil
+}
+
+func (s *Storage) GetApp(_ context.Context, appID int32) (*entity.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return nil, storage.ErrAppNotFound
+	}
+
+	return cloneApp(app), nil
+}
+
+// GetAppByClientID finds an app by its oauth client id.
+func (s *Storage) GetAppByClientID(_ context.Context, clientID string) (*entity.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, app := range s.apps {
+		if app.ClientID == clientID {
+			return cloneApp(app), nil
+		}
+	}
+
+	return nil, storage.ErrAppNotFound
+}
+
+// SaveApp registers a new app with a generated client id and returns it with
+// the assigned id, the highest one plus one.
+func (s *Storage) SaveApp(_ context.Context, app *entity.App) (*entity.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nameTaken(app.Name, 0) {
+		return nil, storage.ErrAppExists
+	}
+
+	saved := *app
+	saved.ID = 0
+	saved.ClientID = uuid.NewString()
+
+	s.lastAppID++
+	saved.ID = s.lastAppID
+
+	s.apps[saved.ID] = storedApp(&saved)
+
+	return &saved, nil
+}
+
+// UpdateApp replaces the name, redirect uris and token policy of an app.
+// The client secret hash is only replaced if set.
+func (s *Storage) UpdateApp(_ context.Context, app *entity.App) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.apps[app.ID]
+	if !ok {
+		return storage.ErrAppNotFound
+	}
+
+	if s.nameTaken(app.Name, app.ID) {
+		return storage.ErrAppExists
+	}
+
+	updated := storedApp(app)
+	updated.ClientID = stored.ClientID
+
+	if app.ClientSecretHash == nil {
+		updated.ClientSecretHash = stored.ClientSecretHash
+	}
+
+	s.apps[app.ID] = updated
+
+	return nil
+}
+
+// ListApps returns every registered app ordered by id.
+func (s *Storage) ListApps(_ context.Context) ([]entity.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	apps := make([]entity.App, 0, len(s.apps))
+
+	for _, app := range s.apps {
+		apps = append(apps, *cloneApp(app))
+	}
+
+	slices.SortFunc(apps, func(a, b entity.App) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return apps, nil
+}
+
+// DeleteApp removes an app together with its refresh sessions.
+func (s *Storage) DeleteApp(_ context.Context, appID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appID]; !ok {
+		return storage.ErrAppNotFound
+	}
+
+	delete(s.apps, appID)
+
+	for refreshToken, session := range s.refreshSessions {
+		if session.AppID == appID {
+			delete(s.refreshSessions, refreshToken)
+		}
+	}
+
+	return nil
+}
+
+// NewRefreshSession stores the first refresh token of a login.
+func (s *Storage) NewRefreshSession(_ context.Context,
+	session *entity.RefreshSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertRefreshSession(session)
+}
+
+// RotateRefreshSession marks refreshToken used and stores next as its
+// successor, see storage.Storage.RotateRefreshSession.
+func (s *Storage) RotateRefreshSession(_ context.Context,
+	refreshToken, userID string,
+	next *entity.RefreshSession) (*entity.RefreshSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.refreshSessions[refreshToken]
+	if !ok || stored.UserID != userID {
+		return nil, storage.ErrRefreshTokenNotFound
+	}
+
+	switch {
+	case stored.IsUsed:
+		return cloneRefreshSession(stored), storage.ErrRefreshTokenReused
+	case stored.IsRevoked || !live(stored.ExpiresAt):
+		return cloneRefreshSession(stored), tokens.ErrInvalidRefreshToken
+	case stored.AppID != next.AppID:
+		// a live token presented to another app
+		return cloneRefreshSession(stored), storage.ErrRefreshAppMismatch
+	}
+
+	next.ParentToken = refreshToken
+	next.FamilyID = stored.FamilyID
+	next.Scope = stored.Scope
+	next.SessionExpiresAt = stored.SessionExpiresAt
+
+	// a successor never outlives the login session.
+	if !next.SessionExpiresAt.IsZero() && next.ExpiresAt.After(next.SessionExpiresAt) {
+		next.ExpiresAt = next.SessionExpiresAt
+	}
+
+	err := s.insertRefreshSession(next)
+	if err != nil {
+		return nil, err
+	}
+
+	stored.IsUsed = true
+	stored.usedAt = truncate(time.Now())
+
+	return cloneRefreshSession(stored), nil
+}
+
+func (s *Storage) insertRefreshSession(session *entity.RefreshSession) error {
+	if _, ok := s.refreshSessions[session.RefreshToken]; ok {
+		return fmt.Errorf("failed to insert refresh session: %w", errTokenExists)
+	}
+
+	stored := &refreshSession{RefreshSession: *session}
+	stored.ExpiresAt = truncate(session.ExpiresAt)
+	stored.SessionExpiresAt = truncate(session.SessionExpiresAt)
+	stored.IsUsed = false
+	stored.IsRevoked = false
+
+	s.refreshSessions[session.RefreshToken] = stored
+
+	return nil
+}
+
+// GetRefreshSession finds the session of a refresh token, whatever its state.
+func (s *Storage) GetRefreshSession(_ context.Context,
+	refreshToken string) (*entity.RefreshSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.refreshSessions[refreshToken]
+	if !ok {
+		return nil, storage.ErrRefreshTokenNotFound
+	}
+
+	return cloneRefreshSession(session), nil
+}
+
+// RevokeRefreshFamily invalidates every token descending from one login.
+func (s *Storage) RevokeRefreshFamily(_ context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeFamily(familyID)
+
+	return nil
+}
+
+// RevokeRefreshFamilyByToken invalidates the family of a refresh token,
+// whatever the state of the token itself.
+func (s *Storage) RevokeRefreshFamilyByToken(_ context.Context, refreshToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.refreshSessions[refreshToken]
+	if !ok {
+		return storage.ErrRefreshTokenNotFound
+	}
+
+	s.revokeFamily(session.FamilyID)
+
+	return nil
+}
+
+func (s *Storage) revokeFamily(familyID string) {
+	for _, session := range s.refreshSessions {
+		if session.FamilyID == familyID {
+			session.IsRevoked = true
+		}
+	}
+}
+
+// RevokeUserRefreshSessions invalidates live refresh sessions of a user issued
+// for appID, or for every app if appID is 0. Returns the number of revoked sessions.
+func (s *Storage) RevokeUserRefreshSessions(_ context.Context,
+	userID string, appID int32) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var revoked int64
+
+	for _, session := range s.refreshSessions {
+		if session.UserID != userID || (appID != 0 && session.AppID != appID) ||
+			session.IsUsed || session.IsRevoked || !live(session.ExpiresAt) {
+			continue
+		}
+
+		session.IsRevoked = true
+		revoked++
+	}
+
+	return revoked, nil
+}
+
+// DeleteExpiredRefreshSessions deletes at most limit refresh sessions that
+// expired or were used at or before the given time. Returns the number of
+// deleted sessions.
+func (s *Storage) DeleteExpiredRefreshSessions(_ context.Context,
+	before time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+
+	for refreshToken, session := range s.refreshSessions {
+		if deleted == int64(limit) {
+			break
+		}
+
+		if session.ExpiresAt.Unix() <= before.Unix() ||
+			(session.IsUsed && session.usedAt.Unix() <= before.Unix()) {
+			delete(s.refreshSessions, refreshToken)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// RevokeAccessToken denylists an access token by its jti until the token
+// expires. Entries of already expired tokens are dropped on the way.
+func (s *Storage) RevokeAccessToken(_ context.Context,
+	jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for revokedJTI, revokedExpiresAt := range s.revokedTokens {
+		if !live(revokedExpiresAt) {
+			delete(s.revokedTokens, revokedJTI)
+		}
+	}
+
+	if _, ok := s.revokedTokens[jti]; !ok {
+		s.revokedTokens[jti] = truncate(expiresAt)
+	}
+
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether the access token with the jti is denylisted.
+func (s *Storage) IsAccessTokenRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.revokedTokens[jti]
+
+	return ok && live(expiresAt), nil
+}
+
+// SetTokensValidAfter rejects every access token of the user issued at or
+// before validAfter. The watermark never moves backwards.
+func (s *Storage) SetTokensValidAfter(_ context.Context,
+	userID string, validAfter time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+
+	if validAfter = truncate(validAfter); validAfter.After(stored.tokensValidAfter) {
+		stored.tokensValidAfter = validAfter
+	}
+
+	return nil
+}
+
+// TokensValidAfter returns the access token watermark of the user, zero time if not set.
+func (s *Storage) TokensValidAfter(_ context.Context, userID string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[userID]
+	if !ok {
+		return time.Time{}, storage.ErrUserNotFound
+	}
+
+	return stored.tokensValidAfter, nil
+}
+
+// SaveAuthorizationCode stores an authorization code.
+func (s *Storage) SaveAuthorizationCode(_ context.Context,
+	code *entity.AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.authorizationCodes[code.Code]; ok {
+		return fmt.Errorf("failed to save authorization code: %w", errTokenExists)
+	}
+
+	stored := *code
+	stored.ExpiresAt = truncate(code.ExpiresAt)
+	stored.IsUsed = false
+
+	s.authorizationCodes[code.Code] = &stored
+
+	return nil
+}
+
+// ConsumeAuthorizationCode marks a live authorization code used and returns
+// it, see storage.Storage.ConsumeAuthorizationCode.
+func (s *Storage) ConsumeAuthorizationCode(_ context.Context,
+	code string) (*entity.AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.authorizationCodes[code]
+	if !ok {
+		return nil, storage.ErrAuthCodeNotFound
+	}
+
+	authCode := *stored
+	authCode.Code = ""
+
+	switch {
+	case stored.IsUsed:
+		return &authCode, storage.ErrAuthCodeReused
+	case !live(stored.ExpiresAt):
+		return nil, storage.ErrAuthCodeNotFound
+	}
+
+	stored.IsUsed = true
+	authCode.IsUsed = true
+
+	return &authCode, nil
+}
+
+// SaveDeviceAuthorization stores a pending device authorization. A user code
+// taken by another request, live or not, returns storage.ErrUserCodeExists.
+func (s *Storage) SaveDeviceAuthorization(_ context.Context,
+	auth *entity.DeviceAuthorization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.devices {
+		if stored.UserCode == auth.UserCode {
+			return storage.ErrUserCodeExists
+		}
+	}
+
+	if _, ok := s.devices[auth.DeviceCode]; ok {
+		return fmt.Errorf("failed to save device authorization: %w", errTokenExists)
+	}
+
+	s.devices[auth.DeviceCode] = &device{
+		DeviceAuthorization: entity.DeviceAuthorization{
+			UserCode:  auth.UserCode,
+			AppID:     auth.AppID,
+			Scope:     auth.Scope,
+			Status:    entity.DeviceStatusPending,
+			Interval:  auth.Interval.Truncate(time.Second),
+			ExpiresAt: truncate(auth.ExpiresAt),
+		},
+	}
+
+	return nil
+}
+
+// GetDeviceAuthorization finds a pending, live device authorization by its user code.
+func (s *Storage) GetDeviceAuthorization(_ context.Context,
+	userCode string) (*entity.DeviceAuthorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.pendingDevice(userCode)
+	if pending == nil {
+		return nil, storage.ErrDeviceCodeNotFound
+	}
+
+	found := pending.DeviceAuthorization
+
+	return &found, nil
+}
+
+// DecideDeviceAuthorization records the user approving or denying a pending,
+// live device authorization. A request is decided only once.
+func (s *Storage) DecideDeviceAuthorization(_ context.Context,
+	userCode, userID string,
+	approved bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.pendingDevice(userCode)
+	if pending == nil {
+		return storage.ErrDeviceCodeNotFound
+	}
+
+	pending.Status = entity.DeviceStatusDenied
+	if approved {
+		pending.Status = entity.DeviceStatusApproved
+	}
+
+	pending.UserID = userID
+
+	return nil
+}
+
+func (s *Storage) pendingDevice(userCode string) *device {
+	for _, stored := range s.devices {
+		if stored.UserCode == userCode &&
+			stored.Status == entity.DeviceStatusPending && live(stored.ExpiresAt) {
+			return stored
+		}
+	}
+
+	return nil
+}
+
+// PollDeviceAuthorization records a poll of the device authorization of appID
+// and returns its state, see storage.Storage.PollDeviceAuthorization.
+func (s *Storage) PollDeviceAuthorization(_ context.Context,
+	deviceCode string,
+	appID int32) (*entity.DeviceAuthorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	stored, ok := s.devices[deviceCode]
+	if !ok || stored.AppID != appID {
+		return nil, storage.ErrDeviceCodeNotFound
+	}
+
+	switch {
+	case stored.isUsed:
+		return nil, storage.ErrDeviceCodeNotFound
+	case !live(stored.ExpiresAt):
+		return nil, storage.ErrDeviceCodeExpired
+	}
+
+	polled := stored.DeviceAuthorization
+
+	stored.LastPolledAt = truncate(now)
+
+	if !polled.LastPolledAt.IsZero() && now.Before(polled.LastPolledAt.Add(polled.Interval)) {
+		stored.Interval += storage.DeviceSlowDownStep
+
+		return nil, storage.ErrDeviceSlowDown
+	}
+
+	// the approval is consumed by the poll that receives it.
+	stored.isUsed = polled.Status == entity.DeviceStatusApproved
+
+	return &polled, nil
+}
+
+// HashLegacyRefreshTokens has nothing to convert, memory never held
+// plaintext refresh tokens of older releases.
+func (s *Storage) HashLegacyRefreshTokens(_ context.Context) (int, error) {
+	return 0, nil
+}
+
+func (s *Storage) nameTaken(name string, exceptID int32) bool {
+	for _, app := range s.apps {
+		if app.Name == name && app.ID != exceptID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// live reports whether a stored expiry is still ahead, at the second
+// precision the sql storage keeps.
+func live(expiresAt time.Time) bool {
+	return expiresAt.Unix() > time.Now().Unix()
+}
+
+// truncate drops what the sql storage does not keep of a time.
+func truncate(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+
+	return time.Unix(t.Unix(), 0)
+}
+
+// storedApp copies app the way the sql storage keeps it: durations in whole
+// seconds, empty lists as nil.
+func storedApp(app *entity.App) *entity.App {
+	stored := cloneApp(app)
+	stored.AccessTTL = app.AccessTTL.Truncate(time.Second)
+	stored.RefreshTTL = app.RefreshTTL.Truncate(time.Second)
+	stored.IdleTimeout = app.IdleTimeout.Truncate(time.Second)
+
+	if len(stored.RedirectURIs) == 0 {
+		stored.RedirectURIs = nil
+	}
+
+	if len(stored.AllowedGrantTypes) == 0 {
+		stored.AllowedGrantTypes = nil
+	}
+
+	return stored
+}
+
+func cloneApp(app *entity.App) *entity.App {
+	cloned := *app
+	cloned.ClientSecretHash = slices.Clone(app.ClientSecretHash)
+	cloned.RedirectURIs = slices.Clone(app.RedirectURIs)
+	cloned.AllowedGrantTypes = slices.Clone(app.AllowedGrantTypes)
+
+	return &cloned
+}
+
+// cloneRefreshSession copies a stored session without its tokens, which the
+// sql storage only keeps hashed.
+func cloneRefreshSession(session *refreshSession) *entity.RefreshSession {
+	cloned := session.RefreshSession
+	cloned.RefreshToken = ""
+	cloned.ParentToken = ""
+
+	return &cloned
+}
+
+// ReserveLoginAttempt counts a login attempt for key at attemptAt as failed
+// unless check rejects the failures counted so far, see
+// storage.Storage.ReserveLoginAttempt.
+func (s *Storage) ReserveLoginAttempt(_ context.Context,
+	key string,
+	attemptAt, resetBefore time.Time,
+	check func(*entity.LoginFailures) error) (*entity.LoginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures, ok := s.loginFailures[key]
+	if !ok || failures.LastFailureAt.Unix() <= resetBefore.Unix() {
+		failures = entity.LoginFailures{}
+	}
+
+	err := check(&failures)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	failures.Failures++
+	failures.LastFailureAt = truncate(attemptAt)
+
+	s.loginFailures[key] = failures
+
+	return &failures, nil
+}
+
+// ReleaseLoginAttempt takes back an attempt reserved for key that did not
+// fail. The time of the last failure is kept.
+func (s *Storage) ReleaseLoginAttempt(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures, ok := s.loginFailures[key]
+	if ok && failures.Failures > 0 {
+		failures.Failures--
+		s.loginFailures[key] = failures
+	}
+
+	return nil
+}
+
+// ResetLoginFailures forgets the failed logins counted for key.
+func (s *Storage) ResetLoginFailures(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginFailures, key)
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres" // postgres:// database urls
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"  // sqlite3:// database urls
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"github.com/aspirin100/gRPC-SSO/internal/storage/migrations"
+)
+
+var ErrSchemaMismatch = errors.New("database schema version mismatch")
+
+// NewMigrator returns a migrator of the database of driver over the
+// migrations embedded in the binary.
+func NewMigrator(driver, storagePath string) (*migrate.Migrate, error) {
+	const op = "storage.NewMigrator"
+
+	src, err := migrationsSource(driver)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	databaseURL := storagePath
+	if driver == DriverSQLite {
+		databaseURL = "sqlite3://" + storagePath
+	}
+
+	mInstance, err := migrate.NewWithSourceInstance("iofs", src, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return mInstance, nil
+}
+
+// SchemaVersion returns the version of the latest embedded migration of driver,
+// the one the service works with.
+func SchemaVersion(driver string) (uint, error) {
+	const op = "storage.SchemaVersion"
+
+	src, err := migrationsSource(driver)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		version = next
+	}
+}
+
+// MigrateUp applies every pending migration to the database of driver.
+func MigrateUp(driver, storagePath string) error {
+	const op = "storage.MigrateUp"
+
+	mInstance, err := NewMigrator(driver, storagePath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer mInstance.Close()
+
+	err = mInstance.Up()
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// CheckSchema returns ErrSchemaMismatch unless the database of driver is
+// cleanly migrated to SchemaVersion.
+func CheckSchema(driver, storagePath string) error {
+	const op = "storage.CheckSchema"
+
+	expected, err := SchemaVersion(driver)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	mInstance, err := NewMigrator(driver, storagePath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer mInstance.Close()
+
+	version, dirty, err := mInstance.Version()
+
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+		return fmt.Errorf("%w: database is not migrated, expected version %d", ErrSchemaMismatch, expected)
+	case err != nil:
+		return fmt.Errorf("%s: %w", op, err)
+	case dirty:
+		return fmt.Errorf("%w: version %d is dirty, fix the database and force a version", ErrSchemaMismatch, version)
+	case version != expected:
+		return fmt.Errorf("%w: version %d, expected %d", ErrSchemaMismatch, version, expected)
+	}
+
+	return nil
+}
+
+func migrationsSource(driver string) (source.Driver, error) {
+	var dir string
+
+	switch driver {
+	case DriverSQLite:
+		dir = "."
+	case DriverPostgres:
+		dir = "postgres"
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, driver)
+	}
+
+	return iofs.New(migrations.FS, dir) //nolint:wrapcheck
+}
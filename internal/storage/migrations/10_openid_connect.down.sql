@@ -0,0 +1,3 @@
+ALTER TABLE refresh_session DROP COLUMN scope;
+ALTER TABLE authorization_code DROP COLUMN nonce;
+ALTER TABLE authorization_code DROP COLUMN scope;
@@ -0,0 +1,7 @@
+-- granted oauth scopes (space separated) and the OpenID Connect nonce of a login.
+ALTER TABLE authorization_code
+    ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+ALTER TABLE authorization_code
+    ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_session
+    ADD COLUMN scope TEXT NOT NULL DEFAULT '';
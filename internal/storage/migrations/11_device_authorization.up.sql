@@ -0,0 +1,15 @@
+-- oauth device authorization requests, device codes stored as keyed hashes like refresh tokens.
+CREATE TABLE IF NOT EXISTS device_authorization
+(
+    deviceCodeHash BLOB PRIMARY KEY,
+    userCode       TEXT NOT NULL UNIQUE,
+    appID          INTEGER NOT NULL,
+    scope          TEXT NOT NULL DEFAULT '',
+    status         TEXT NOT NULL DEFAULT 'pending', -- pending, approved, denied
+    userID         uuid, -- user who approved or denied
+    pollInterval   INTEGER NOT NULL, -- seconds
+    lastPolledAt   INTEGER NOT NULL DEFAULT 0,
+    expiresAt      INTEGER NOT NULL,
+    isUsed         BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (userID) REFERENCES users(id)
+);
@@ -0,0 +1,8 @@
+-- failed logins of an account ('account:' || email) or a client address
+-- ('ip:' || address), counted to throttle password guessing.
+CREATE TABLE IF NOT EXISTS login_failure
+(
+    key           TEXT PRIMARY KEY,
+    failures      INTEGER NOT NULL,
+    lastFailureAt INTEGER NOT NULL
+);
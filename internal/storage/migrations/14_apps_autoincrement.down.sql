@@ -0,0 +1,24 @@
+CREATE TABLE apps_rowid
+(
+    id                INTEGER PRIMARY KEY,
+    name              TEXT NOT NULL UNIQUE,
+    accessTTL         INTEGER NOT NULL DEFAULT 0,
+    refreshTTL        INTEGER NOT NULL DEFAULT 0,
+    idleTimeout       INTEGER NOT NULL DEFAULT 0,
+    audience          TEXT NOT NULL DEFAULT '',
+    allowedGrantTypes TEXT NOT NULL DEFAULT '',
+    clientID          TEXT,
+    clientSecretHash  BLOB,
+    redirectURIs      TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO apps_rowid(id, name, accessTTL, refreshTTL, idleTimeout, audience,
+    allowedGrantTypes, clientID, clientSecretHash, redirectURIs)
+SELECT id, name, accessTTL, refreshTTL, idleTimeout, audience,
+    allowedGrantTypes, clientID, clientSecretHash, redirectURIs
+FROM apps;
+
+DROP TABLE apps;
+ALTER TABLE apps_rowid RENAME TO apps;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_apps_client_id ON apps (clientID);
@@ -0,0 +1,25 @@
+-- ids of deleted apps must never be reused: access tokens name their app in aud.
+CREATE TABLE apps_autoincrement
+(
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    name              TEXT NOT NULL UNIQUE,
+    accessTTL         INTEGER NOT NULL DEFAULT 0, -- seconds
+    refreshTTL        INTEGER NOT NULL DEFAULT 0, -- seconds
+    idleTimeout       INTEGER NOT NULL DEFAULT 0, -- seconds
+    audience          TEXT NOT NULL DEFAULT '',
+    allowedGrantTypes TEXT NOT NULL DEFAULT '', -- comma separated
+    clientID          TEXT,
+    clientSecretHash  BLOB,
+    redirectURIs      TEXT NOT NULL DEFAULT '' -- space separated
+);
+
+INSERT INTO apps_autoincrement(id, name, accessTTL, refreshTTL, idleTimeout, audience,
+    allowedGrantTypes, clientID, clientSecretHash, redirectURIs)
+SELECT id, name, accessTTL, refreshTTL, idleTimeout, audience,
+    allowedGrantTypes, clientID, clientSecretHash, redirectURIs
+FROM apps;
+
+DROP TABLE apps;
+ALTER TABLE apps_autoincrement RENAME TO apps;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_apps_client_id ON apps (clientID);
@@ -0,0 +1,4 @@
+-- hashed tokens can not be restored, those sessions are dropped.
+DELETE FROM refresh_session WHERE isHashed;
+ALTER TABLE refresh_session DROP COLUMN isHashed;
+ALTER TABLE refresh_session RENAME COLUMN tokenHash TO refreshToken;
@@ -0,0 +1,5 @@
+-- refresh tokens are stored as HMAC-SHA256 of the token. Existing plaintext
+-- rows are hashed by the service on startup, it owns the hash key.
+ALTER TABLE refresh_session RENAME COLUMN refreshToken TO tokenHash;
+ALTER TABLE refresh_session
+    ADD COLUMN isHashed BOOLEAN NOT NULL DEFAULT FALSE;
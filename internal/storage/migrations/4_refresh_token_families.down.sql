@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_refresh_session_family;
+ALTER TABLE refresh_session DROP COLUMN isRevoked;
+ALTER TABLE refresh_session DROP COLUMN parentHash;
+ALTER TABLE refresh_session DROP COLUMN familyID;
@@ -0,0 +1,12 @@
+-- every login starts a token family, refreshes chain from the parent token.
+ALTER TABLE refresh_session
+    ADD COLUMN familyID TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_session
+    ADD COLUMN parentHash BLOB;
+ALTER TABLE refresh_session
+    ADD COLUMN isRevoked BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- sessions issued before families each start their own one.
+UPDATE refresh_session SET familyID = lower(hex(randomblob(16))) WHERE familyID = '';
+
+CREATE INDEX IF NOT EXISTS idx_refresh_session_family ON refresh_session (familyID);
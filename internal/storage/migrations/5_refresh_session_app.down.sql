@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_refresh_session_user;
+ALTER TABLE refresh_session DROP COLUMN appID;
@@ -0,0 +1,5 @@
+-- sessions issued before apps were recorded keep appID 0.
+ALTER TABLE refresh_session
+    ADD COLUMN appID INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_session_user ON refresh_session (userID, appID);
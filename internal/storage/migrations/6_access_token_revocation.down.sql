@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_revoked_access_token_expires;
+DROP TABLE IF EXISTS revoked_access_token;
+ALTER TABLE users DROP COLUMN tokensValidAfter;
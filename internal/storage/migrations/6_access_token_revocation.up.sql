@@ -0,0 +1,10 @@
+-- access tokens issued at or before the watermark are rejected.
+ALTER TABLE users
+    ADD COLUMN tokensValidAfter INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS revoked_access_token
+(
+    jti       TEXT PRIMARY KEY,
+    expiresAt INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_access_token_expires ON revoked_access_token (expiresAt);
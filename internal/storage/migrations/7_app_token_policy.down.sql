@@ -0,0 +1,6 @@
+ALTER TABLE refresh_session DROP COLUMN sessionExpiresAt;
+ALTER TABLE apps DROP COLUMN allowedGrantTypes;
+ALTER TABLE apps DROP COLUMN audience;
+ALTER TABLE apps DROP COLUMN idleTimeout;
+ALTER TABLE apps DROP COLUMN refreshTTL;
+ALTER TABLE apps DROP COLUMN accessTTL;
@@ -0,0 +1,15 @@
+-- token policy of an app, zero values fall back to the service defaults.
+ALTER TABLE apps
+    ADD COLUMN accessTTL INTEGER NOT NULL DEFAULT 0; -- seconds
+ALTER TABLE apps
+    ADD COLUMN refreshTTL INTEGER NOT NULL DEFAULT 0; -- seconds
+ALTER TABLE apps
+    ADD COLUMN idleTimeout INTEGER NOT NULL DEFAULT 0; -- seconds
+ALTER TABLE apps
+    ADD COLUMN audience TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps
+    ADD COLUMN allowedGrantTypes TEXT NOT NULL DEFAULT ''; -- comma separated
+
+-- absolute end of a login session, 0 if it is only bounded by the refresh token TTL.
+ALTER TABLE refresh_session
+    ADD COLUMN sessionExpiresAt INTEGER NOT NULL DEFAULT 0;
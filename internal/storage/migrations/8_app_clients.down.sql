@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_apps_client_id;
+ALTER TABLE apps DROP COLUMN redirectURIs;
+ALTER TABLE apps DROP COLUMN clientSecretHash;
+ALTER TABLE apps DROP COLUMN clientID;
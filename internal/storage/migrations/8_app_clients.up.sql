@@ -0,0 +1,11 @@
+-- apps are oauth clients: a generated public id, a hashed secret and allowed redirect uris.
+ALTER TABLE apps
+    ADD COLUMN clientID TEXT;
+ALTER TABLE apps
+    ADD COLUMN clientSecretHash BLOB;
+ALTER TABLE apps
+    ADD COLUMN redirectURIs TEXT NOT NULL DEFAULT ''; -- space separated
+
+UPDATE apps SET clientID = lower(hex(randomblob(16))) WHERE clientID IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_apps_client_id ON apps (clientID);
@@ -0,0 +1,13 @@
+-- single use oauth authorization codes, stored as keyed hashes like refresh tokens.
+CREATE TABLE IF NOT EXISTS authorization_code
+(
+    codeHash      BLOB PRIMARY KEY,
+    userID        uuid NOT NULL,
+    appID         INTEGER NOT NULL,
+    redirectURI   TEXT NOT NULL,
+    codeChallenge TEXT NOT NULL, -- PKCE S256
+    familyID      TEXT NOT NULL, -- refresh token family the code is exchanged into
+    expiresAt     INTEGER NOT NULL,
+    isUsed        BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (userID) REFERENCES users(id)
+);
@@ -0,0 +1,9 @@
+// Package migrations embeds the sql migrations of every storage driver.
+package migrations
+
+import "embed"
+
+// FS holds the sqlite migrations at its root and the postgres ones in postgres/.
+//
+//go:embed *.sql postgres/*.sql
+var FS embed.FS
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS device_authorization;
+DROP TABLE IF EXISTS authorization_code;
+DROP TABLE IF EXISTS revoked_access_token;
+DROP TABLE IF EXISTS refresh_session;
+DROP TABLE IF EXISTS apps;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,76 @@
+-- schema of the sqlite migrations up to 11_device_authorization. Times are
+-- unix seconds and ids text, as in sqlite, which does not enforce foreign keys.
+CREATE TABLE IF NOT EXISTS users
+(
+    id               TEXT PRIMARY KEY, -- UUID
+    email            TEXT NOT NULL UNIQUE,
+    passHash         BYTEA NOT NULL,
+    isAdmin          BOOLEAN NOT NULL DEFAULT FALSE,
+    tokensValidAfter BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS apps
+(
+    id                INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name              TEXT NOT NULL UNIQUE,
+    accessTTL         BIGINT NOT NULL DEFAULT 0, -- seconds
+    refreshTTL        BIGINT NOT NULL DEFAULT 0, -- seconds
+    idleTimeout       BIGINT NOT NULL DEFAULT 0, -- seconds
+    audience          TEXT NOT NULL DEFAULT '',
+    allowedGrantTypes TEXT NOT NULL DEFAULT '', -- comma separated
+    clientID          TEXT UNIQUE,
+    clientSecretHash  BYTEA,
+    redirectURIs      TEXT NOT NULL DEFAULT '' -- space separated
+);
+
+CREATE TABLE IF NOT EXISTS refresh_session
+(
+    tokenHash        BYTEA PRIMARY KEY,
+    userID           TEXT NOT NULL,
+    appID            INTEGER NOT NULL DEFAULT 0,
+    expiresAt        BIGINT NOT NULL,
+    sessionExpiresAt BIGINT NOT NULL DEFAULT 0,
+    familyID         TEXT NOT NULL DEFAULT '',
+    parentHash       BYTEA,
+    scope            TEXT NOT NULL DEFAULT '',
+    isUsed           BOOLEAN NOT NULL DEFAULT FALSE,
+    isRevoked        BOOLEAN NOT NULL DEFAULT FALSE,
+    isHashed         BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_session_family ON refresh_session (familyID);
+CREATE INDEX IF NOT EXISTS idx_refresh_session_user ON refresh_session (userID, appID);
+
+CREATE TABLE IF NOT EXISTS revoked_access_token
+(
+    jti       TEXT PRIMARY KEY,
+    expiresAt BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_access_token_expires ON revoked_access_token (expiresAt);
+
+CREATE TABLE IF NOT EXISTS authorization_code
+(
+    codeHash      BYTEA PRIMARY KEY,
+    userID        TEXT NOT NULL,
+    appID         INTEGER NOT NULL,
+    redirectURI   TEXT NOT NULL,
+    codeChallenge TEXT NOT NULL, -- PKCE S256
+    familyID      TEXT NOT NULL, -- refresh token family the code is exchanged into
+    scope         TEXT NOT NULL DEFAULT '',
+    nonce         TEXT NOT NULL DEFAULT '',
+    expiresAt     BIGINT NOT NULL,
+    isUsed        BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS device_authorization
+(
+    deviceCodeHash BYTEA PRIMARY KEY,
+    userCode       TEXT NOT NULL UNIQUE,
+    appID          INTEGER NOT NULL,
+    scope          TEXT NOT NULL DEFAULT '',
+    status         TEXT NOT NULL DEFAULT 'pending', -- pending, approved, denied
+    userID         TEXT, -- user who approved or denied
+    pollInterval   BIGINT NOT NULL, -- seconds
+    lastPolledAt   BIGINT NOT NULL DEFAULT 0,
+    expiresAt      BIGINT NOT NULL,
+    isUsed         BOOLEAN NOT NULL DEFAULT FALSE
+);
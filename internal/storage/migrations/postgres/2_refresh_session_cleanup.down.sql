@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_refresh_session_used;
+DROP INDEX IF EXISTS idx_refresh_session_expires;
+ALTER TABLE refresh_session DROP COLUMN usedAt;
@@ -0,0 +1,10 @@
+-- used tokens are kept for a while after use to detect their reuse, then
+-- deleted together with expired ones. Tokens used before the column existed
+-- count as used now.
+ALTER TABLE refresh_session
+    ADD COLUMN usedAt BIGINT NOT NULL DEFAULT 0;
+
+UPDATE refresh_session SET usedAt = extract(epoch FROM now())::BIGINT WHERE isUsed;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_session_expires ON refresh_session (expiresAt);
+CREATE INDEX IF NOT EXISTS idx_refresh_session_used ON refresh_session (usedAt);
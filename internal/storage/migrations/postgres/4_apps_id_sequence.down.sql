@@ -0,0 +1 @@
+-- the sequence stays advanced, app ids are never reused.
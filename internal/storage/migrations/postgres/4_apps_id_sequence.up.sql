@@ -0,0 +1,3 @@
+-- apps inserted with explicit ids do not advance the identity sequence, the
+-- next generated id would collide with them.
+SELECT setval(pg_get_serial_sequence('apps', 'id'), COALESCE(max(id), 0) + 1, false) FROM apps;
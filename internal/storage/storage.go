@@ -2,10 +2,13 @@ package storage
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/aspirin100/gRPC-SSO/internal/entity"
@@ -14,6 +17,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/lib/pq"
 	"github.com/mattn/go-sqlite3"
 )
 
@@ -21,19 +26,50 @@ var (
 	ErrUserNotFound         = errors.New("user not found")
 	ErrUserExists           = errors.New("user already exists")
 	ErrAppNotFound          = errors.New("app not found")
+	ErrAppExists            = errors.New("app already exists")
+	ErrAppIDTaken           = errors.New("app id is already taken")
+	ErrAuthCodeNotFound     = errors.New("authorization code not found")
+	ErrAuthCodeReused       = errors.New("authorization code is already used")
 	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token is already used")
+	ErrRefreshAppMismatch   = errors.New("refresh token is issued for another app")
+	ErrDeviceCodeNotFound   = errors.New("device code not found")
+	ErrDeviceCodeExpired    = errors.New("device code is expired")
+	ErrDeviceSlowDown       = errors.New("device code is polled too often")
+	ErrUserCodeExists       = errors.New("user code already exists")
+	ErrUnknownDriver        = errors.New("unknown storage driver")
 )
 
+// storage drivers, each sql one with its own migrations. DriverMemory keeps
+// everything in process memory, see package memory.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+// pgUniqueViolation is the postgres error code of unique constraint violations.
+const pgUniqueViolation = "23505"
+
+// DeviceSlowDownStep is added to the poll interval of a device polling too often.
+const DeviceSlowDownStep = 5 * time.Second
+
+// Storage keeps users, apps and sessions in sqlite or postgres. Queries are
+// written with ? placeholders and rebound for the driver.
 type Storage struct {
-	db *sqlx.DB
+	db      *sqlx.DB
+	driver  string
+	hashKey []byte // HMAC key of refresh tokens at rest
 }
 
-func New(logg *slog.Logger, storagePath string) (*Storage, error) {
-	const op = "storage.sqlite.New"
+// New opens the database of driver. storagePath is the database file of
+// sqlite or the connection url of postgres.
+func New(logg *slog.Logger, driver, storagePath string, hashKey []byte) (*Storage, error) {
+	const op = "storage.New"
 
 	log := logg.With(slog.String("op", op))
 
-	db, err := sqlx.Open("sqlite3", storagePath)
+	db, err := Open(driver, storagePath)
 	if err != nil {
 		log.Error("db open error", sl.Err(err))
 
@@ -41,28 +77,99 @@ func New(logg *slog.Logger, storagePath string) (*Storage, error) {
 	}
 
 	return &Storage{
-		db: db,
+		db:      db,
+		driver:  driver,
+		hashKey: hashKey,
 	}, nil
 }
 
+// Open connects to the database of driver the way Storage does.
+func Open(driver, storagePath string) (*sqlx.DB, error) {
+	switch driver {
+	case DriverSQLite:
+		return sqlx.Open("sqlite3", withConcurrencyParams(storagePath)) //nolint:wrapcheck
+	case DriverPostgres:
+		db, err := sqlx.Open("postgres", storagePath)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		// postgres folds unquoted camelCase column names to lower case.
+		db.Mapper = reflectx.NewMapperTagFunc("db", strings.ToLower, strings.ToLower)
+
+		return db, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, driver)
+	}
+}
+
+// withConcurrencyParams makes transactions take the write lock up front and
+// wait for it instead of failing with SQLITE_BUSY under concurrent writes.
+func withConcurrencyParams(storagePath string) string {
+	separator := "?"
+	if strings.Contains(storagePath, "?") {
+		separator = "&"
+	}
+
+	return storagePath + separator + "_txlock=immediate&_busy_timeout=5000"
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation of either driver.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgUniqueViolation
+	}
+
+	return false
+}
+
+// isPrimaryKeyViolation reports whether err is a primary key violation of
+// either driver. Postgres names primary key constraints <table>_pkey.
+func isPrimaryKeyViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgUniqueViolation && strings.HasSuffix(pgErr.Constraint, "_pkey")
+	}
+
+	return false
+}
+
+// forUpdate locks the rows a query selects in a transaction until it ends.
+// sqlite transactions take the write lock up front, postgres ones lock rows.
+func (s *Storage) forUpdate(query string) string {
+	if s.driver == DriverPostgres {
+		return query + " for update"
+	}
+
+	return query
+}
+
 func (s *Storage) SaveUser(ctx context.Context,
 	email string,
 	passHash []byte) (userID string, err error) {
 	userID = uuid.NewString()
 
-	const op = "storage.sqlite3.SaveUser"
+	const op = "storage.SaveUser"
 
 	_, err = s.db.ExecContext(
 		ctx,
-		SaveUserQuery,
+		s.db.Rebind(SaveUserQuery),
 		userID,
 		email,
 		passHash)
 	if err != nil {
-		var sqliteErr sqlite3.Error
-
-		if errors.As(err, &sqliteErr) &&
-			sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		if isUniqueViolation(err) {
 			return "", ErrUserExists
 		}
 
@@ -73,11 +180,29 @@ func (s *Storage) SaveUser(ctx context.Context,
 }
 
 func (s *Storage) GetUser(ctx context.Context, email string) (*entity.User, error) {
-	const op = "storage.sqlite.GetUser"
+	const op = "storage.GetUser"
+
+	user := &entity.User{}
+
+	err := s.db.GetContext(ctx, user, s.db.Rebind(GetUserQuery), email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// GetUserByID finds a user by id, the subject of issued tokens.
+func (s *Storage) GetUserByID(ctx context.Context, userID string) (*entity.User, error) {
+	const op = "storage.GetUserByID"
 
 	user := &entity.User{}
 
-	err := s.db.GetContext(ctx, user, GetUserQuery, email)
+	err := s.db.GetContext(ctx, user, s.db.Rebind(GetUserByIDQuery), userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -90,11 +215,11 @@ func (s *Storage) GetUser(ctx context.Context, email string) (*entity.User, erro
 }
 
 func (s *Storage) IsAdmin(ctx context.Context, userID string) (*bool, error) {
-	const op = "storage.sqlite.GetUser"
+	const op = "storage.GetUser"
 
 	var isAdmin bool
 
-	err := s.db.GetContext(ctx, &isAdmin, IsAdminQuery, userID)
+	err := s.db.GetContext(ctx, &isAdmin, s.db.Rebind(IsAdminQuery), userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -106,12 +231,34 @@ func (s *Storage) IsAdmin(ctx context.Context, userID string) (*bool, error) {
 	return &isAdmin, nil
 }
 
+// UpdatePasswordHash replaces the password hash of the user, rehashed with
+// current parameters.
+func (s *Storage) UpdatePasswordHash(ctx context.Context, userID string, passHash []byte) error {
+	const op = "storage.UpdatePasswordHash"
+
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(UpdatePasswordHashQuery), passHash, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
 func (s *Storage) GetApp(ctx context.Context, appID int32) (*entity.App, error) {
-	const op = "storage.sqlite.GetUser"
+	const op = "storage.GetUser"
 
-	app := entity.App{}
+	row := appRow{}
 
-	err := s.db.GetContext(ctx, &app, GetAppQuery, appID)
+	err := s.db.GetContext(ctx, &row, s.db.Rebind(GetAppQuery), appID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrAppNotFound
@@ -120,57 +267,756 @@ func (s *Storage) GetApp(ctx context.Context, appID int32) (*entity.App, error)
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &app, nil
+	return row.toEntity(), nil
+}
+
+// GetAppByClientID finds an app by its oauth client id.
+func (s *Storage) GetAppByClientID(ctx context.Context, clientID string) (*entity.App, error) {
+	const op = "storage.GetAppByClientID"
+
+	row := appRow{}
+
+	err := s.db.GetContext(ctx, &row, s.db.Rebind(GetAppByClientIDQuery), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAppNotFound
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return row.toEntity(), nil
+}
+
+// SaveApp registers a new app with a generated client id and returns it with
+// the assigned id.
+func (s *Storage) SaveApp(ctx context.Context, app *entity.App) (*entity.App, error) {
+	const op = "storage.SaveApp"
+
+	saved := *app
+	saved.ClientID = uuid.NewString()
+
+	row := newAppRow(&saved)
+
+	err := s.db.GetContext(ctx, &saved.ID, s.db.Rebind(SaveAppQuery),
+		row.Name,
+		row.ClientID,
+		row.ClientSecretHash,
+		row.RedirectURIs,
+		row.AccessTTL,
+		row.RefreshTTL,
+		row.IdleTimeout,
+		row.Audience,
+		row.AllowedGrantTypes)
+	if err != nil {
+		// the id sequence of postgres is behind rows inserted with explicit ids.
+		if isPrimaryKeyViolation(err) {
+			return nil, fmt.Errorf("%s: %w", op, ErrAppIDTaken)
+		}
+
+		if isUniqueViolation(err) {
+			return nil, ErrAppExists
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &saved, nil
+}
+
+// UpdateApp replaces the name, redirect uris and token policy of an app.
+// The client secret hash is only replaced if set.
+func (s *Storage) UpdateApp(ctx context.Context, app *entity.App) error {
+	const op = "storage.UpdateApp"
+
+	row := newAppRow(app)
+
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(UpdateAppQuery),
+		row.Name,
+		row.ClientSecretHash,
+		row.RedirectURIs,
+		row.AccessTTL,
+		row.RefreshTTL,
+		row.IdleTimeout,
+		row.Audience,
+		row.AllowedGrantTypes,
+		row.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrAppExists
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if updated == 0 {
+		return ErrAppNotFound
+	}
+
+	return nil
+}
+
+// ListApps returns every registered app ordered by id.
+func (s *Storage) ListApps(ctx context.Context) ([]entity.App, error) {
+	const op = "storage.ListApps"
+
+	var rows []appRow
+
+	err := s.db.SelectContext(ctx, &rows, s.db.Rebind(ListAppsQuery))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	apps := make([]entity.App, 0, len(rows))
+
+	for _, row := range rows {
+		apps = append(apps, *row.toEntity())
+	}
+
+	return apps, nil
+}
+
+// DeleteApp removes an app together with its refresh sessions.
+func (s *Storage) DeleteApp(ctx context.Context, appID int32) error {
+	const op = "storage.DeleteApp"
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	result, err := tx.ExecContext(ctx, s.db.Rebind(DeleteAppQuery), appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if deleted == 0 {
+		return ErrAppNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, s.db.Rebind(DeleteAppRefreshSessionsQuery), appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
 }
 
+// NewRefreshSession stores the first refresh token of a login.
 func (s *Storage) NewRefreshSession(
 	ctx context.Context,
+	session *entity.RefreshSession) error {
+	const op = "storage.NewRefreshSession"
+
+	err := s.insertRefreshSession(ctx, s.db, session)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RotateRefreshSession marks refreshToken used and stores next as its
+// successor in one transaction. The token is only consumed if it is still
+// unused, so of concurrent rotations with the same token exactly one wins.
+// next inherits the family and scope of the rotated token.
+//
+// The token is only rotated for the app it was issued for, next.AppID.
+// Sessions stored before apps were recorded belong to none and are rejected.
+//
+// Presenting a token that was already used returns ErrRefreshTokenReused
+// together with the session, so the caller can revoke its family.
+func (s *Storage) RotateRefreshSession(ctx context.Context,
 	refreshToken, userID string,
-	refreshTTL time.Duration) error {
-	const op = "storage.sqlite.NewRefreshSession"
+	next *entity.RefreshSession) (*entity.RefreshSession, error) {
+	const op = "storage.RotateRefreshSession"
+
+	tokenHash := s.hashToken(refreshToken)
+	now := time.Now()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	// compare-and-set: only an unused, live token is consumed.
+	result, err := tx.ExecContext(ctx, s.db.Rebind(UseRefreshTokenQuery),
+		now.Unix(), tokenHash, userID, next.AppID, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	consumed, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	row := refreshSessionRow{}
+
+	err = tx.GetContext(ctx, &row, s.db.Rebind(GetRefreshSessionQuery), tokenHash, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRefreshTokenNotFound
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session := row.toEntity()
+
+	if consumed == 0 {
+		switch {
+		case row.IsUsed:
+			return session, ErrRefreshTokenReused
+		case row.IsRevoked || row.ExpiresAt <= now.Unix():
+			return session, tokens.ErrInvalidRefreshToken
+		default:
+			// a live token presented to another app
+			return session, ErrRefreshAppMismatch
+		}
+	}
+
+	next.ParentToken = refreshToken
+	next.FamilyID = session.FamilyID
+	next.Scope = session.Scope
+	next.SessionExpiresAt = session.SessionExpiresAt
+
+	// a successor never outlives the login session.
+	if !next.SessionExpiresAt.IsZero() && next.ExpiresAt.After(next.SessionExpiresAt) {
+		next.ExpiresAt = next.SessionExpiresAt
+	}
+
+	err = s.insertRefreshSession(ctx, tx, next)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
 
-	_, err := s.db.ExecContext(
+func (s *Storage) insertRefreshSession(ctx context.Context,
+	exec sqlx.ExecerContext,
+	session *entity.RefreshSession) error {
+	var parentHash []byte
+	if session.ParentToken != "" {
+		parentHash = s.hashToken(session.ParentToken)
+	}
+
+	var sessionExpiresAt int64
+	if !session.SessionExpiresAt.IsZero() {
+		sessionExpiresAt = session.SessionExpiresAt.Unix()
+	}
+
+	_, err := exec.ExecContext(
 		ctx,
-		NewRefreshSessionQuery,
-		refreshToken,
-		userID,
-		time.Now().Add(refreshTTL).Unix())
+		s.db.Rebind(NewRefreshSessionQuery),
+		s.hashToken(session.RefreshToken),
+		session.UserID,
+		session.AppID,
+		session.ExpiresAt.Unix(),
+		session.FamilyID,
+		parentHash,
+		sessionExpiresAt,
+		session.Scope)
+	if err != nil {
+		return fmt.Errorf("failed to insert refresh session: %w", err)
+	}
+
+	return nil
+}
+
+// GetRefreshSession finds the session of a refresh token, whatever its state.
+func (s *Storage) GetRefreshSession(ctx context.Context,
+	refreshToken string) (*entity.RefreshSession, error) {
+	const op = "storage.GetRefreshSession"
+
+	row := refreshSessionRow{}
+
+	err := s.db.GetContext(ctx, &row, s.db.Rebind(GetRefreshSessionByTokenQuery), s.hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRefreshTokenNotFound
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return row.toEntity(), nil
+}
+
+// SaveAuthorizationCode stores an authorization code by its hash.
+func (s *Storage) SaveAuthorizationCode(ctx context.Context,
+	code *entity.AuthorizationCode) error {
+	const op = "storage.SaveAuthorizationCode"
+
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(SaveAuthorizationCodeQuery),
+		s.hashToken(code.Code),
+		code.UserID,
+		code.AppID,
+		code.RedirectURI,
+		code.CodeChallenge,
+		code.FamilyID,
+		code.Scope,
+		code.Nonce,
+		code.ExpiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeAuthorizationCode marks a live authorization code used and returns it.
+// Of concurrent exchanges of one code exactly one succeeds. Presenting a code
+// that was already used returns ErrAuthCodeReused together with the code, so
+// the caller can revoke the tokens it was exchanged for.
+func (s *Storage) ConsumeAuthorizationCode(ctx context.Context,
+	code string) (*entity.AuthorizationCode, error) {
+	const op = "storage.ConsumeAuthorizationCode"
+
+	codeHash := s.hashToken(code)
+	now := time.Now()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	result, err := tx.ExecContext(ctx, s.db.Rebind(UseAuthorizationCodeQuery), codeHash, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	consumed, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	row := authorizationCodeRow{}
+
+	err = tx.GetContext(ctx, &row, s.db.Rebind(GetAuthorizationCodeQuery), codeHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAuthCodeNotFound
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	authCode := row.toEntity()
+
+	if consumed == 0 {
+		if row.IsUsed {
+			return authCode, ErrAuthCodeReused
+		}
+
+		// expired
+		return nil, ErrAuthCodeNotFound
+	}
+
+	return authCode, nil
+}
+
+// SaveDeviceAuthorization stores a pending device authorization by the hash
+// of its device code. A user code taken by another request, live or not,
+// returns ErrUserCodeExists.
+func (s *Storage) SaveDeviceAuthorization(ctx context.Context,
+	auth *entity.DeviceAuthorization) error {
+	const op = "storage.SaveDeviceAuthorization"
+
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(SaveDeviceAuthorizationQuery),
+		s.hashToken(auth.DeviceCode),
+		auth.UserCode,
+		auth.AppID,
+		auth.Scope,
+		int64(auth.Interval.Seconds()),
+		auth.ExpiresAt.Unix())
 	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrUserCodeExists
+		}
+
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *Storage) ValidateRefreshToken(ctx context.Context, refreshToken, userID string) error {
-	const op = "storage.sqlite.ValidateRefreshToken"
+// GetDeviceAuthorization finds a pending, live device authorization by its user code.
+func (s *Storage) GetDeviceAuthorization(ctx context.Context,
+	userCode string) (*entity.DeviceAuthorization, error) {
+	const op = "storage.GetDeviceAuthorization"
+
+	row := deviceAuthorizationRow{}
+
+	err := s.db.GetContext(ctx, &row, s.db.Rebind(GetDeviceAuthorizationQuery), userCode, time.Now().Unix())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDeviceCodeNotFound
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return row.toEntity(), nil
+}
+
+// DecideDeviceAuthorization records the user approving or denying a pending,
+// live device authorization. A request is decided only once.
+func (s *Storage) DecideDeviceAuthorization(ctx context.Context,
+	userCode, userID string,
+	approved bool) error {
+	const op = "storage.DecideDeviceAuthorization"
+
+	status := entity.DeviceStatusDenied
+	if approved {
+		status = entity.DeviceStatusApproved
+	}
+
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(DecideDeviceAuthorizationQuery),
+		status, userID, userCode, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	decided, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if decided == 0 {
+		return ErrDeviceCodeNotFound
+	}
+
+	return nil
+}
+
+// PollDeviceAuthorization records a poll of the device authorization of appID
+// and returns its state. An approved request is returned only once, later
+// polls get ErrDeviceCodeNotFound.
+//
+// A poll sooner than the interval after the previous one returns
+// ErrDeviceSlowDown and makes the interval longer by DeviceSlowDownStep,
+// RFC 8628 section 3.5.
+func (s *Storage) PollDeviceAuthorization(ctx context.Context,
+	deviceCode string,
+	appID int32) (*entity.DeviceAuthorization, error) {
+	const op = "storage.PollDeviceAuthorization"
+
+	codeHash := s.hashToken(deviceCode)
+	now := time.Now()
+
+	// the row is locked until commit, so polls of one code are serialized.
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback() //nolint:errcheck
 
-	result := struct {
-		ExpiresAt int64 `db:"expiresAt"`
-		IsUsed    bool  `db:"isUsed"`
-	}{}
+	row := deviceAuthorizationRow{}
 
-	err := s.db.GetContext(ctx,
-		&result,
-		ValidateRefreshTokenQuery,
-		refreshToken, userID)
+	err = tx.GetContext(ctx, &row, s.db.Rebind(s.forUpdate(GetDeviceAuthorizationByCodeQuery)), codeHash, appID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return ErrRefreshTokenNotFound
+			return nil, ErrDeviceCodeNotFound
 		}
 
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch {
+	case row.IsUsed:
+		return nil, ErrDeviceCodeNotFound
+	case row.ExpiresAt <= now.Unix():
+		return nil, ErrDeviceCodeExpired
+	}
+
+	var pollErr error
+
+	interval := row.PollInterval
+
+	if now.Unix() < row.LastPolledAt+row.PollInterval {
+		pollErr = ErrDeviceSlowDown
+		interval += int64(DeviceSlowDownStep.Seconds())
+	}
+
+	// the approval is consumed by the poll that receives it.
+	isUsed := pollErr == nil && row.Status == entity.DeviceStatusApproved
+
+	_, err = tx.ExecContext(ctx, s.db.Rebind(PollDeviceAuthorizationQuery),
+		now.Unix(), interval, isUsed, codeHash)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if pollErr != nil {
+		return nil, pollErr
+	}
+
+	return row.toEntity(), nil
+}
+
+// RevokeRefreshFamilyByToken invalidates the family of a refresh token,
+// whatever the state of the token itself.
+func (s *Storage) RevokeRefreshFamilyByToken(ctx context.Context, refreshToken string) error {
+	const op = "storage.RevokeRefreshFamilyByToken"
+
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(RevokeRefreshFamilyByTokenQuery), s.hashToken(refreshToken))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if revoked == 0 {
+		return ErrRefreshTokenNotFound
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshSessions invalidates live refresh sessions of a user issued
+// for appID, or for every app if appID is 0. Returns the number of revoked sessions.
+func (s *Storage) RevokeUserRefreshSessions(ctx context.Context,
+	userID string, appID int32) (int64, error) {
+	const op = "storage.RevokeUserRefreshSessions"
+
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(RevokeUserRefreshSessionsQuery),
+		userID, appID, appID, time.Now().Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revoked, nil
+}
+
+// RevokeRefreshFamily invalidates every token descending from one login.
+func (s *Storage) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	const op = "storage.RevokeRefreshFamily"
+
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(RevokeRefreshFamilyQuery), familyID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredRefreshSessions deletes at most limit refresh sessions that
+// expired or were used at or before the given time. Returns the number of
+// deleted sessions.
+func (s *Storage) DeleteExpiredRefreshSessions(ctx context.Context,
+	before time.Time, limit int) (int64, error) {
+	const op = "storage.DeleteExpiredRefreshSessions"
+
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(DeleteExpiredRefreshSessionsQuery),
+		before.Unix(), before.Unix(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
+
+// RevokeAccessToken denylists an access token by its jti until the token
+// expires. Entries of already expired tokens are dropped on the way.
+func (s *Storage) RevokeAccessToken(ctx context.Context,
+	jti string, expiresAt time.Time) error {
+	const op = "storage.RevokeAccessToken"
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	_, err = tx.ExecContext(ctx, s.db.Rebind(DeleteExpiredRevokedAccessTokensQuery), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, s.db.Rebind(RevokeAccessTokenQuery), jti, expiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether the access token with the jti is denylisted.
+func (s *Storage) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	const op = "storage.IsAccessTokenRevoked"
+
+	var revoked bool
+
+	err := s.db.GetContext(ctx, &revoked, s.db.Rebind(IsAccessTokenRevokedQuery), jti, time.Now().Unix())
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revoked, nil
+}
+
+// SetTokensValidAfter rejects every access token of the user issued at or
+// before validAfter. The watermark never moves backwards.
+func (s *Storage) SetTokensValidAfter(ctx context.Context,
+	userID string, validAfter time.Time) error {
+	const op = "storage.SetTokensValidAfter"
+
+	result, err := s.db.ExecContext(ctx, s.db.Rebind(SetTokensValidAfterQuery),
+		validAfter.Unix(), validAfter.Unix(), userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if result.IsUsed {
-		return tokens.ErrInvalidRefreshToken
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// TokensValidAfter returns the access token watermark of the user, zero time if not set.
+func (s *Storage) TokensValidAfter(ctx context.Context, userID string) (time.Time, error) {
+	const op = "storage.TokensValidAfter"
+
+	var validAfter int64
+
+	err := s.db.GetContext(ctx, &validAfter, s.db.Rebind(TokensValidAfterQuery), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, ErrUserNotFound
+		}
+
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if validAfter == 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(validAfter, 0), nil
+}
+
+// ReserveLoginAttempt counts a login attempt for key at attemptAt as failed
+// before its password is checked, unless check rejects the failures counted
+// so far; then the error of check is returned and nothing is counted. The
+// counter restarts if the previous failure was at or before resetBefore.
+//
+// The row is locked from check to count, so concurrent attempts see each
+// other's reservations. Returns the updated count.
+func (s *Storage) ReserveLoginAttempt(ctx context.Context,
+	key string,
+	attemptAt, resetBefore time.Time,
+	check func(*entity.LoginFailures) error) (*entity.LoginFailures, error) {
+	const op = "storage.ReserveLoginAttempt"
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	// a row must exist to be locked.
+	_, err = tx.ExecContext(ctx, s.db.Rebind(CreateLoginFailuresQuery), key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	row := loginFailuresRow{}
+
+	err = tx.GetContext(ctx, &row, s.db.Rebind(s.forUpdate(GetLoginFailuresQuery)), key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if row.LastFailureAt <= resetBefore.Unix() {
+		row = loginFailuresRow{}
+	}
+
+	err = check(row.toEntity())
+	if err != nil {
+		return nil, err //nolint:wrapcheck
 	}
 
-	if time.Now().Unix() >= result.ExpiresAt {
-		return tokens.ErrInvalidRefreshToken
+	row.Failures++
+	row.LastFailureAt = attemptAt.Unix()
+
+	_, err = tx.ExecContext(ctx, s.db.Rebind(UpdateLoginFailuresQuery), row.Failures, row.LastFailureAt, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	_, err = s.db.ExecContext(ctx, SetRefreshTokenUsedQuery, refreshToken)
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return row.toEntity(), nil
+}
+
+// ReleaseLoginAttempt takes back an attempt reserved for key that did not
+// fail. The time of the last failure is kept.
+func (s *Storage) ReleaseLoginAttempt(ctx context.Context, key string) error {
+	const op = "storage.ReleaseLoginAttempt"
+
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(ReleaseLoginAttemptQuery), key)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -178,15 +1024,296 @@ func (s *Storage) ValidateRefreshToken(ctx context.Context, refreshToken, userID
 	return nil
 }
 
+// ResetLoginFailures forgets the failed logins counted for key.
+func (s *Storage) ResetLoginFailures(ctx context.Context, key string) error {
+	const op = "storage.ResetLoginFailures"
+
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(ResetLoginFailuresQuery), key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+type loginFailuresRow struct {
+	Failures      int   `db:"failures"`
+	LastFailureAt int64 `db:"lastFailureAt"`
+}
+
+func (r *loginFailuresRow) toEntity() *entity.LoginFailures {
+	return &entity.LoginFailures{
+		Failures:      r.Failures,
+		LastFailureAt: time.Unix(r.LastFailureAt, 0),
+	}
+}
+
+type deviceAuthorizationRow struct {
+	UserCode     string         `db:"userCode"`
+	AppID        int32          `db:"appID"`
+	Scope        string         `db:"scope"`
+	Status       string         `db:"status"`
+	UserID       sql.NullString `db:"userID"`
+	PollInterval int64          `db:"pollInterval"`
+	LastPolledAt int64          `db:"lastPolledAt"`
+	ExpiresAt    int64          `db:"expiresAt"`
+	IsUsed       bool           `db:"isUsed"`
+}
+
+func (r *deviceAuthorizationRow) toEntity() *entity.DeviceAuthorization {
+	auth := &entity.DeviceAuthorization{
+		UserCode:  r.UserCode,
+		AppID:     r.AppID,
+		Scope:     r.Scope,
+		Status:    r.Status,
+		UserID:    r.UserID.String,
+		Interval:  time.Duration(r.PollInterval) * time.Second,
+		ExpiresAt: time.Unix(r.ExpiresAt, 0),
+	}
+
+	if r.LastPolledAt != 0 {
+		auth.LastPolledAt = time.Unix(r.LastPolledAt, 0)
+	}
+
+	return auth
+}
+
+type refreshSessionRow struct {
+	UserID           string `db:"userID"`
+	AppID            int32  `db:"appID"`
+	FamilyID         string `db:"familyID"`
+	Scope            string `db:"scope"`
+	ExpiresAt        int64  `db:"expiresAt"`
+	SessionExpiresAt int64  `db:"sessionExpiresAt"`
+	IsUsed           bool   `db:"isUsed"`
+	IsRevoked        bool   `db:"isRevoked"`
+}
+
+func (r *refreshSessionRow) toEntity() *entity.RefreshSession {
+	session := &entity.RefreshSession{
+		UserID:    r.UserID,
+		AppID:     r.AppID,
+		FamilyID:  r.FamilyID,
+		Scope:     r.Scope,
+		ExpiresAt: time.Unix(r.ExpiresAt, 0),
+		IsUsed:    r.IsUsed,
+		IsRevoked: r.IsRevoked,
+	}
+
+	if r.SessionExpiresAt != 0 {
+		session.SessionExpiresAt = time.Unix(r.SessionExpiresAt, 0)
+	}
+
+	return session
+}
+
+type authorizationCodeRow struct {
+	UserID        string `db:"userID"`
+	AppID         int32  `db:"appID"`
+	RedirectURI   string `db:"redirectURI"`
+	CodeChallenge string `db:"codeChallenge"`
+	FamilyID      string `db:"familyID"`
+	Scope         string `db:"scope"`
+	Nonce         string `db:"nonce"`
+	ExpiresAt     int64  `db:"expiresAt"`
+	IsUsed        bool   `db:"isUsed"`
+}
+
+func (r *authorizationCodeRow) toEntity() *entity.AuthorizationCode {
+	return &entity.AuthorizationCode{
+		UserID:        r.UserID,
+		AppID:         r.AppID,
+		RedirectURI:   r.RedirectURI,
+		CodeChallenge: r.CodeChallenge,
+		FamilyID:      r.FamilyID,
+		Scope:         r.Scope,
+		Nonce:         r.Nonce,
+		ExpiresAt:     time.Unix(r.ExpiresAt, 0),
+		IsUsed:        r.IsUsed,
+	}
+}
+
+// appRow stores durations in seconds, grant types comma and redirect uris
+// space separated.
+type appRow struct {
+	ID                int32          `db:"id"`
+	Name              string         `db:"name"`
+	ClientID          sql.NullString `db:"clientID"`
+	ClientSecretHash  []byte         `db:"clientSecretHash"`
+	RedirectURIs      string         `db:"redirectURIs"`
+	AccessTTL         int64          `db:"accessTTL"`
+	RefreshTTL        int64          `db:"refreshTTL"`
+	IdleTimeout       int64          `db:"idleTimeout"`
+	Audience          string         `db:"audience"`
+	AllowedGrantTypes string         `db:"allowedGrantTypes"`
+}
+
+func (r *appRow) toEntity() *entity.App {
+	app := &entity.App{
+		ID:               r.ID,
+		Name:             r.Name,
+		ClientID:         r.ClientID.String,
+		ClientSecretHash: r.ClientSecretHash,
+		AccessTTL:        time.Duration(r.AccessTTL) * time.Second,
+		RefreshTTL:       time.Duration(r.RefreshTTL) * time.Second,
+		IdleTimeout:      time.Duration(r.IdleTimeout) * time.Second,
+		Audience:         r.Audience,
+	}
+
+	if r.AllowedGrantTypes != "" {
+		app.AllowedGrantTypes = strings.Split(r.AllowedGrantTypes, ",")
+	}
+
+	if r.RedirectURIs != "" {
+		app.RedirectURIs = strings.Split(r.RedirectURIs, " ")
+	}
+
+	return app
+}
+
+func newAppRow(app *entity.App) *appRow {
+	return &appRow{
+		ID:                app.ID,
+		Name:              app.Name,
+		ClientID:          sql.NullString{String: app.ClientID, Valid: app.ClientID != ""},
+		ClientSecretHash:  app.ClientSecretHash,
+		RedirectURIs:      strings.Join(app.RedirectURIs, " "),
+		AccessTTL:         int64(app.AccessTTL / time.Second),
+		RefreshTTL:        int64(app.RefreshTTL / time.Second),
+		IdleTimeout:       int64(app.IdleTimeout / time.Second),
+		Audience:          app.Audience,
+		AllowedGrantTypes: strings.Join(app.AllowedGrantTypes, ","),
+	}
+}
+
+// HashLegacyRefreshTokens replaces refresh tokens stored in plaintext before
+// hashing was introduced with their hashes. Returns the number of converted rows.
+func (s *Storage) HashLegacyRefreshTokens(ctx context.Context) (int, error) {
+	const op = "storage.HashLegacyRefreshTokens"
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var sessions []struct {
+		RefreshToken []byte `db:"tokenHash"`
+		UserID       string `db:"userID"`
+	}
+
+	err = tx.SelectContext(ctx, &sessions, s.db.Rebind(GetLegacyRefreshSessionsQuery))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, session := range sessions {
+		refreshToken, userID := string(session.RefreshToken), session.UserID
+
+		// Login used to store the user id and the token swapped.
+		if uuid.Validate(refreshToken) == nil && uuid.Validate(userID) != nil {
+			refreshToken, userID = userID, refreshToken
+		}
+
+		_, err = tx.ExecContext(ctx, s.db.Rebind(HashLegacyRefreshSessionQuery),
+			s.hashToken(refreshToken), userID, session.RefreshToken)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return len(sessions), nil
+}
+
+// hashToken is the keyed hash a refresh token is stored and looked up by,
+// so a leaked database does not hand out live sessions.
+func (s *Storage) hashToken(refreshToken string) []byte {
+	mac := hmac.New(sha256.New, s.hashKey)
+	mac.Write([]byte(refreshToken))
+
+	return mac.Sum(nil)
+}
+
 const (
-	SaveUserQuery             = `insert into users(id, email, passHash) values(?, ?, ?)`
-	GetUserQuery              = `select id, email, passHash from users where email = ?`
-	IsAdminQuery              = `select isAdmin from users where id = ?`
-	GetAppQuery               = `select id, name from apps where id = ?`
-	ValidateRefreshTokenQuery = `select expiresAt, isUsed from
-	refresh_session where refreshToken = ? AND userID = ?`
-	SetRefreshTokenUsedQuery = `update refresh_session set isUsed = true where refreshToken = ?`
-	NewRefreshSessionQuery   = `insert into
-	refresh_session(refreshToken, userID, expiresAt)
-	values(?, ?, ?)`
+	SaveUserQuery           = `insert into users(id, email, passHash) values(?, ?, ?)`
+	GetUserQuery            = `select id, email, passHash from users where email = ?`
+	GetUserByIDQuery        = `select id, email, passHash from users where id = ?`
+	IsAdminQuery            = `select isAdmin from users where id = ?`
+	UpdatePasswordHashQuery = `update users set passHash = ? where id = ?`
+	GetAppQuery             = `select id, name, clientID, clientSecretHash, redirectURIs,
+	accessTTL, refreshTTL, idleTimeout, audience, allowedGrantTypes from apps where id = ?`
+	GetAppByClientIDQuery = `select id, name, clientID, clientSecretHash, redirectURIs,
+	accessTTL, refreshTTL, idleTimeout, audience, allowedGrantTypes from apps where clientID = ?`
+	ListAppsQuery = `select id, name, clientID, clientSecretHash, redirectURIs,
+	accessTTL, refreshTTL, idleTimeout, audience, allowedGrantTypes from apps order by id`
+	SaveAppQuery = `insert into apps(name, clientID, clientSecretHash, redirectURIs,
+	accessTTL, refreshTTL, idleTimeout, audience, allowedGrantTypes)
+	values(?, ?, ?, ?, ?, ?, ?, ?, ?) returning id`
+	UpdateAppQuery = `update apps set name = ?,
+	clientSecretHash = coalesce(?, clientSecretHash), redirectURIs = ?,
+	accessTTL = ?, refreshTTL = ?, idleTimeout = ?,
+	audience = ?, allowedGrantTypes = ? where id = ?`
+	DeleteAppQuery                = `delete from apps where id = ?`
+	DeleteAppRefreshSessionsQuery = `delete from refresh_session where appID = ?`
+	GetRefreshSessionByTokenQuery = `select userID, appID, familyID, scope, expiresAt, sessionExpiresAt, isUsed, isRevoked from
+	refresh_session where tokenHash = ? AND isHashed`
+	SaveAuthorizationCodeQuery = `insert into
+	authorization_code(codeHash, userID, appID, redirectURI, codeChallenge, familyID, scope, nonce, expiresAt)
+	values(?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	UseAuthorizationCodeQuery = `update authorization_code set isUsed = true
+	where codeHash = ? AND NOT isUsed AND expiresAt > ?`
+	GetAuthorizationCodeQuery = `select userID, appID, redirectURI, codeChallenge, familyID, scope, nonce,
+	expiresAt, isUsed
+	from authorization_code where codeHash = ?`
+	SaveDeviceAuthorizationQuery = `insert into
+	device_authorization(deviceCodeHash, userCode, appID, scope, pollInterval, expiresAt)
+	values(?, ?, ?, ?, ?, ?)`
+	GetDeviceAuthorizationQuery = `select userCode, appID, scope, status, userID, pollInterval,
+	lastPolledAt, expiresAt, isUsed from device_authorization
+	where userCode = ? AND status = 'pending' AND expiresAt > ?`
+	GetDeviceAuthorizationByCodeQuery = `select userCode, appID, scope, status, userID, pollInterval,
+	lastPolledAt, expiresAt, isUsed from device_authorization
+	where deviceCodeHash = ? AND appID = ?`
+	DecideDeviceAuthorizationQuery = `update device_authorization set status = ?, userID = ?
+	where userCode = ? AND status = 'pending' AND expiresAt > ?`
+	PollDeviceAuthorizationQuery = `update device_authorization
+	set lastPolledAt = ?, pollInterval = ?, isUsed = ? where deviceCodeHash = ?`
+	GetRefreshSessionQuery = `select userID, appID, familyID, scope, expiresAt, sessionExpiresAt, isUsed, isRevoked from
+	refresh_session where tokenHash = ? AND userID = ? AND isHashed`
+	UseRefreshTokenQuery = `update refresh_session set isUsed = true, usedAt = ?
+	where tokenHash = ? AND userID = ? AND isHashed AND appID = ?
+	AND NOT isUsed AND NOT isRevoked AND expiresAt > ?`
+	NewRefreshSessionQuery = `insert into
+	refresh_session(tokenHash, userID, appID, expiresAt, familyID, parentHash, sessionExpiresAt, scope, isHashed)
+	values(?, ?, ?, ?, ?, ?, ?, ?, true)`
+	RevokeRefreshFamilyQuery        = `update refresh_session set isRevoked = true where familyID = ?`
+	RevokeRefreshFamilyByTokenQuery = `update refresh_session set isRevoked = true
+	where familyID = (select familyID from refresh_session where tokenHash = ?)`
+	RevokeUserRefreshSessionsQuery = `update refresh_session set isRevoked = true
+	where userID = ? AND (? = 0 OR appID = ?)
+	AND NOT isUsed AND NOT isRevoked AND expiresAt > ?`
+	DeleteExpiredRefreshSessionsQuery = `delete from refresh_session where tokenHash in
+	(select tokenHash from refresh_session where expiresAt <= ? OR (isUsed AND usedAt <= ?) limit ?)`
+	GetLegacyRefreshSessionsQuery = `select tokenHash, userID from refresh_session where not isHashed`
+	HashLegacyRefreshSessionQuery = `update refresh_session
+	set tokenHash = ?, userID = ?, isHashed = true where tokenHash = ?`
+	RevokeAccessTokenQuery = `insert into revoked_access_token(jti, expiresAt) values(?, ?)
+	on conflict(jti) do nothing`
+	IsAccessTokenRevokedQuery = `select exists(select 1 from revoked_access_token
+	where jti = ? AND expiresAt > ?)`
+	DeleteExpiredRevokedAccessTokensQuery = `delete from revoked_access_token where expiresAt <= ?`
+	SetTokensValidAfterQuery              = `update users
+	set tokensValidAfter = case when tokensValidAfter > ? then tokensValidAfter else ? end where id = ?`
+	TokensValidAfterQuery    = `select tokensValidAfter from users where id = ?`
+	GetLoginFailuresQuery    = `select failures, lastFailureAt from login_failure where key = ?`
+	CreateLoginFailuresQuery = `insert into login_failure(key, failures, lastFailureAt) values(?, 0, 0)
+	on conflict(key) do nothing`
+	UpdateLoginFailuresQuery = `update login_failure set failures = ?, lastFailureAt = ? where key = ?`
+	ReleaseLoginAttemptQuery = `update login_failure set failures = failures - 1 where key = ? and failures > 0`
+	ResetLoginFailuresQuery  = `delete from login_failure where key = ?`
 )
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+)
+
+func TestRevokeAccessToken(t *testing.T) {
+	forEachBackend(t, testRevokeAccessToken)
+}
+
+func testRevokeAccessToken(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	liveJTI, expiredJTI := uuid.NewString(), uuid.NewString()
+
+	err := strg.RevokeAccessToken(ctx, expiredJTI, time.Now().Add(-time.Second))
+	require.NoError(t, err)
+
+	err = strg.RevokeAccessToken(ctx, liveJTI, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	// revoking twice is not an error.
+	err = strg.RevokeAccessToken(ctx, liveJTI, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	cases := []struct {
+		testName        string
+		jti             string
+		expectedRevoked bool
+	}{
+		{
+			testName:        "revoked token case",
+			jti:             liveJTI,
+			expectedRevoked: true,
+		},
+		{
+			testName:        "expired entry case",
+			jti:             expiredJTI,
+			expectedRevoked: false,
+		},
+		{
+			testName:        "unknown token case",
+			jti:             uuid.NewString(),
+			expectedRevoked: false,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			revoked, err := strg.IsAccessTokenRevoked(ctx, tcase.jti)
+			require.NoError(t, err)
+			require.Equal(t, tcase.expectedRevoked, revoked)
+		})
+	}
+}
+
+func TestRevokeAccessTokenPurge(t *testing.T) {
+	strg, db := newMigratedStorage(t)
+	ctx := context.Background()
+
+	err := strg.RevokeAccessToken(ctx, uuid.NewString(), time.Now().Add(-time.Second))
+	require.NoError(t, err)
+
+	err = strg.RevokeAccessToken(ctx, uuid.NewString(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	// entries of expired tokens are dropped.
+	var count int
+
+	err = db.Get(&count, `select count(*) from revoked_access_token`)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestTokensValidAfter(t *testing.T) {
+	forEachBackend(t, testTokensValidAfter)
+}
+
+func testTokensValidAfter(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	userID, err := strg.SaveUser(ctx, "watermark@test.com", []byte("passHash"))
+	require.NoError(t, err)
+
+	validAfter, err := strg.TokensValidAfter(ctx, userID)
+	require.NoError(t, err)
+	require.True(t, validAfter.IsZero())
+
+	watermark := time.Now().Truncate(time.Second)
+
+	err = strg.SetTokensValidAfter(ctx, userID, watermark)
+	require.NoError(t, err)
+
+	// the watermark never moves backwards.
+	err = strg.SetTokensValidAfter(ctx, userID, watermark.Add(-time.Hour))
+	require.NoError(t, err)
+
+	validAfter, err = strg.TokensValidAfter(ctx, userID)
+	require.NoError(t, err)
+	require.True(t, watermark.Equal(validAfter))
+
+	err = strg.SetTokensValidAfter(ctx, uuid.NewString(), watermark)
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = strg.TokensValidAfter(ctx, uuid.NewString())
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+}
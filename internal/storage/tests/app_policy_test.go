@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+func TestGetAppTokenPolicy(t *testing.T) {
+	strg, db := newMigratedStorage(t)
+	ctx := context.Background()
+
+	_, err := db.Exec(`insert into apps(id, name) values(1, 'default')`)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`insert into apps(id, name, accessTTL, refreshTTL, idleTimeout, audience, allowedGrantTypes)
+		values(2, 'console', 300, 3600, 600, 'console-api', 'password,refresh_token')`)
+	require.NoError(t, err)
+
+	cases := []struct {
+		testName    string
+		appID       int32
+		expectedApp *entity.App
+	}{
+		{
+			testName: "default policy case",
+			appID:    1,
+			expectedApp: &entity.App{
+				ID:   1,
+				Name: "default",
+			},
+		},
+		{
+			testName: "own policy case",
+			appID:    2,
+			expectedApp: &entity.App{
+				ID:                2,
+				Name:              "console",
+				AccessTTL:         5 * time.Minute,
+				RefreshTTL:        time.Hour,
+				IdleTimeout:       10 * time.Minute,
+				Audience:          "console-api",
+				AllowedGrantTypes: []string{entity.GrantTypePassword, entity.GrantTypeRefreshToken},
+			},
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			app, err := strg.GetApp(ctx, tcase.appID)
+			require.NoError(t, err)
+			require.Equal(t, tcase.expectedApp, app)
+		})
+	}
+}
+
+func TestRotateRefreshSessionIdleTimeout(t *testing.T) {
+	forEachBackend(t, testRotateRefreshSessionIdleTimeout)
+}
+
+func testRotateRefreshSessionIdleTimeout(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	refreshToken, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+
+	sessionExpiresAt := time.Now().Add(time.Minute).Truncate(time.Second)
+
+	err = strg.NewRefreshSession(ctx, &entity.RefreshSession{
+		RefreshToken:     *refreshToken,
+		UserID:           userID,
+		FamilyID:         uuid.NewString(),
+		ExpiresAt:        time.Now().Add(30 * time.Second),
+		SessionExpiresAt: sessionExpiresAt,
+	})
+	require.NoError(t, err)
+
+	// the idle window would reach past the end of the login session.
+	next := nextSession(t)
+
+	_, err = strg.RotateRefreshSession(ctx, *refreshToken, userID, next)
+	require.NoError(t, err)
+	require.True(t, sessionExpiresAt.Equal(next.SessionExpiresAt))
+	require.True(t, sessionExpiresAt.Equal(next.ExpiresAt))
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+func TestSaveApp(t *testing.T) {
+	forEachBackend(t, testSaveApp)
+}
+
+func testSaveApp(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	app := &entity.App{
+		Name:              "console",
+		ClientSecretHash:  []byte("secret hash"),
+		RedirectURIs:      []string{"https://console.test/callback", "http://localhost:8000/cb"},
+		AccessTTL:         5 * time.Minute,
+		AllowedGrantTypes: []string{entity.GrantTypePassword},
+	}
+
+	saved, err := strg.SaveApp(ctx, app)
+	require.NoError(t, err)
+	require.NotZero(t, saved.ID)
+	require.NotEmpty(t, saved.ClientID)
+
+	stored, err := strg.GetApp(ctx, saved.ID)
+	require.NoError(t, err)
+	require.Equal(t, saved, stored)
+
+	_, err = strg.SaveApp(ctx, &entity.App{Name: app.Name})
+	require.ErrorIs(t, err, storage.ErrAppExists)
+
+	another, err := strg.SaveApp(ctx, &entity.App{Name: "mobile"})
+	require.NoError(t, err)
+	require.NotEqual(t, saved.ClientID, another.ClientID)
+
+	apps, err := strg.ListApps(ctx)
+	require.NoError(t, err)
+	require.Len(t, apps, 2)
+	require.Equal(t, *saved, apps[0])
+}
+
+// TestSaveAppAfterExplicitID inserts an app the way migrations seed them.
+// sqlite generates ids past it, the postgres sequence does not move and the
+// collision must not read as a taken name.
+func TestSaveAppAfterExplicitID(t *testing.T) {
+	strg, db := newMigratedStorage(t)
+	ctx := context.Background()
+
+	_, err := db.Exec(db.Rebind(`insert into apps(id, name) values(?, ?)`), 1, "seeded")
+	require.NoError(t, err)
+
+	saved, err := strg.SaveApp(ctx, &entity.App{Name: "created"})
+
+	if db.DriverName() == storage.DriverPostgres {
+		require.ErrorIs(t, err, storage.ErrAppIDTaken)
+		require.NotErrorIs(t, err, storage.ErrAppExists)
+
+		return
+	}
+
+	require.NoError(t, err)
+	require.Equal(t, int32(2), saved.ID)
+}
+
+func TestUpdateApp(t *testing.T) {
+	forEachBackend(t, testUpdateApp)
+}
+
+func testUpdateApp(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	saved, err := strg.SaveApp(ctx, &entity.App{
+		Name:             "console",
+		ClientSecretHash: []byte("secret hash"),
+	})
+	require.NoError(t, err)
+
+	_, err = strg.SaveApp(ctx, &entity.App{Name: "mobile"})
+	require.NoError(t, err)
+
+	cases := []struct {
+		testName           string
+		app                *entity.App
+		expectedSecretHash []byte
+		expectedError      error
+	}{
+		{
+			testName: "keep secret case",
+			app: &entity.App{
+				ID:           saved.ID,
+				Name:         "admin console",
+				RedirectURIs: []string{"https://console.test/callback"},
+			},
+			expectedSecretHash: []byte("secret hash"),
+		},
+		{
+			testName: "rotate secret case",
+			app: &entity.App{
+				ID:               saved.ID,
+				Name:             "admin console",
+				ClientSecretHash: []byte("new secret hash"),
+			},
+			expectedSecretHash: []byte("new secret hash"),
+		},
+		{
+			testName: "taken name case",
+			app: &entity.App{
+				ID:   saved.ID,
+				Name: "mobile",
+			},
+			expectedError: storage.ErrAppExists,
+		},
+		{
+			testName: "app not found case",
+			app: &entity.App{
+				ID:   saved.ID + 100,
+				Name: "unknown",
+			},
+			expectedError: storage.ErrAppNotFound,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			err := strg.UpdateApp(ctx, tcase.app)
+			require.ErrorIs(t, err, tcase.expectedError)
+
+			if tcase.expectedError != nil {
+				return
+			}
+
+			updated, err := strg.GetApp(ctx, tcase.app.ID)
+			require.NoError(t, err)
+			require.Equal(t, tcase.app.Name, updated.Name)
+			require.Equal(t, tcase.app.RedirectURIs, updated.RedirectURIs)
+			require.Equal(t, saved.ClientID, updated.ClientID)
+			require.Equal(t, tcase.expectedSecretHash, updated.ClientSecretHash)
+		})
+	}
+}
+
+func TestDeleteApp(t *testing.T) {
+	forEachBackend(t, testDeleteApp)
+}
+
+func testDeleteApp(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	saved, err := strg.SaveApp(ctx, &entity.App{Name: "console"})
+	require.NoError(t, err)
+
+	refreshToken, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+
+	err = strg.NewRefreshSession(ctx, &entity.RefreshSession{
+		RefreshToken: *refreshToken,
+		UserID:       userID,
+		AppID:        saved.ID,
+		FamilyID:     uuid.NewString(),
+		ExpiresAt:    time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	err = strg.DeleteApp(ctx, saved.ID)
+	require.NoError(t, err)
+
+	_, err = strg.GetApp(ctx, saved.ID)
+	require.ErrorIs(t, err, storage.ErrAppNotFound)
+
+	// its refresh sessions are deleted with it.
+	_, err = strg.GetRefreshSession(ctx, *refreshToken)
+	require.ErrorIs(t, err, storage.ErrRefreshTokenNotFound)
+
+	err = strg.DeleteApp(ctx, saved.ID)
+	require.ErrorIs(t, err, storage.ErrAppNotFound)
+
+	// the id of the deleted newest app is not given to the next one, tokens
+	// issued for the deleted app must not become valid for it.
+	next, err := strg.SaveApp(ctx, &entity.App{Name: "console"})
+	require.NoError(t, err)
+	require.Greater(t, next.ID, saved.ID)
+}
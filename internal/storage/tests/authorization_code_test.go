@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+func TestConsumeAuthorizationCode(t *testing.T) {
+	forEachBackend(t, testConsumeAuthorizationCode)
+}
+
+func testConsumeAuthorizationCode(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	newCode := func(t *testing.T, expiresAt time.Time) *entity.AuthorizationCode {
+		t.Helper()
+
+		return newAuthorizationCode(t, strg, expiresAt)
+	}
+
+	t.Run("ok case", func(t *testing.T) {
+		saved := newCode(t, time.Now().Add(time.Minute))
+
+		consumed, err := strg.ConsumeAuthorizationCode(ctx, saved.Code)
+		require.NoError(t, err)
+		require.Equal(t, saved.UserID, consumed.UserID)
+		require.Equal(t, saved.AppID, consumed.AppID)
+		require.Equal(t, saved.RedirectURI, consumed.RedirectURI)
+		require.Equal(t, saved.CodeChallenge, consumed.CodeChallenge)
+		require.Equal(t, saved.FamilyID, consumed.FamilyID)
+		require.Equal(t, saved.Scope, consumed.Scope)
+		require.Equal(t, saved.Nonce, consumed.Nonce)
+
+		// the second exchange reports the family of the first one.
+		replayed, err := strg.ConsumeAuthorizationCode(ctx, saved.Code)
+		require.ErrorIs(t, err, storage.ErrAuthCodeReused)
+		require.Equal(t, saved.FamilyID, replayed.FamilyID)
+	})
+
+	t.Run("expired code case", func(t *testing.T) {
+		saved := newCode(t, time.Now().Add(-time.Second))
+
+		_, err := strg.ConsumeAuthorizationCode(ctx, saved.Code)
+		require.ErrorIs(t, err, storage.ErrAuthCodeNotFound)
+	})
+
+	t.Run("not found case", func(t *testing.T) {
+		code, err := tokens.NewAuthorizationCode()
+		require.NoError(t, err)
+
+		_, err = strg.ConsumeAuthorizationCode(ctx, *code)
+		require.ErrorIs(t, err, storage.ErrAuthCodeNotFound)
+	})
+
+}
+
+func TestAuthorizationCodeHashedAtRest(t *testing.T) {
+	strg, db := newMigratedStorage(t)
+
+	saved := newAuthorizationCode(t, strg, time.Now().Add(time.Minute))
+
+	var count int
+
+	err := db.Get(&count, db.Rebind(`select count(*) from authorization_code where codeHash = ?`), saved.Code)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func newAuthorizationCode(t *testing.T, strg Store, expiresAt time.Time) *entity.AuthorizationCode {
+	t.Helper()
+
+	code, err := tokens.NewAuthorizationCode()
+	require.NoError(t, err)
+
+	authCode := &entity.AuthorizationCode{
+		Code:          *code,
+		UserID:        userID,
+		AppID:         1,
+		RedirectURI:   "https://client.test/callback",
+		CodeChallenge: tokens.PKCEChallenge("verifier"),
+		FamilyID:      uuid.NewString(),
+		Scope:         "openid email",
+		Nonce:         "nonce",
+		ExpiresAt:     expiresAt,
+	}
+
+	err = strg.SaveAuthorizationCode(context.Background(), authCode)
+	require.NoError(t, err)
+
+	return authCode
+}
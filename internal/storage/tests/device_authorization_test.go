@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+func TestPollDeviceAuthorization(t *testing.T) {
+	forEachBackend(t, testPollDeviceAuthorization)
+}
+
+func testPollDeviceAuthorization(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	newAuthorization := func(t *testing.T,
+		interval time.Duration,
+		expiresAt time.Time) *entity.DeviceAuthorization {
+		t.Helper()
+
+		deviceCode, err := tokens.NewDeviceCode()
+		require.NoError(t, err)
+
+		userCode, err := tokens.NewUserCode()
+		require.NoError(t, err)
+
+		auth := &entity.DeviceAuthorization{
+			DeviceCode: *deviceCode,
+			UserCode:   userCode,
+			AppID:      1,
+			Scope:      "openid",
+			Interval:   interval,
+			ExpiresAt:  expiresAt,
+		}
+
+		err = strg.SaveDeviceAuthorization(ctx, auth)
+		require.NoError(t, err)
+
+		return auth
+	}
+
+	t.Run("approved case", func(t *testing.T) {
+		auth := newAuthorization(t, 0, time.Now().Add(time.Minute))
+
+		polled, err := strg.PollDeviceAuthorization(ctx, auth.DeviceCode, auth.AppID)
+		require.NoError(t, err)
+		require.Equal(t, entity.DeviceStatusPending, polled.Status)
+
+		pending, err := strg.GetDeviceAuthorization(ctx, auth.UserCode)
+		require.NoError(t, err)
+		require.Equal(t, auth.AppID, pending.AppID)
+
+		err = strg.DecideDeviceAuthorization(ctx, auth.UserCode, userID, true)
+		require.NoError(t, err)
+
+		// a request is decided once.
+		err = strg.DecideDeviceAuthorization(ctx, auth.UserCode, userID, false)
+		require.ErrorIs(t, err, storage.ErrDeviceCodeNotFound)
+
+		polled, err = strg.PollDeviceAuthorization(ctx, auth.DeviceCode, auth.AppID)
+		require.NoError(t, err)
+		require.Equal(t, entity.DeviceStatusApproved, polled.Status)
+		require.Equal(t, userID, polled.UserID)
+		require.Equal(t, auth.Scope, polled.Scope)
+
+		// the approval is consumed.
+		_, err = strg.PollDeviceAuthorization(ctx, auth.DeviceCode, auth.AppID)
+		require.ErrorIs(t, err, storage.ErrDeviceCodeNotFound)
+	})
+
+	t.Run("denied case", func(t *testing.T) {
+		auth := newAuthorization(t, 0, time.Now().Add(time.Minute))
+
+		err := strg.DecideDeviceAuthorization(ctx, auth.UserCode, userID, false)
+		require.NoError(t, err)
+
+		polled, err := strg.PollDeviceAuthorization(ctx, auth.DeviceCode, auth.AppID)
+		require.NoError(t, err)
+		require.Equal(t, entity.DeviceStatusDenied, polled.Status)
+	})
+
+	t.Run("slow down case", func(t *testing.T) {
+		auth := newAuthorization(t, time.Hour, time.Now().Add(time.Minute))
+
+		_, err := strg.PollDeviceAuthorization(ctx, auth.DeviceCode, auth.AppID)
+		require.NoError(t, err)
+
+		_, err = strg.PollDeviceAuthorization(ctx, auth.DeviceCode, auth.AppID)
+		require.ErrorIs(t, err, storage.ErrDeviceSlowDown)
+
+		pending, err := strg.GetDeviceAuthorization(ctx, auth.UserCode)
+		require.NoError(t, err)
+		require.Equal(t, time.Hour+storage.DeviceSlowDownStep, pending.Interval)
+	})
+
+	t.Run("expired case", func(t *testing.T) {
+		auth := newAuthorization(t, 0, time.Now().Add(-time.Second))
+
+		_, err := strg.PollDeviceAuthorization(ctx, auth.DeviceCode, auth.AppID)
+		require.ErrorIs(t, err, storage.ErrDeviceCodeExpired)
+
+		err = strg.DecideDeviceAuthorization(ctx, auth.UserCode, userID, true)
+		require.ErrorIs(t, err, storage.ErrDeviceCodeNotFound)
+	})
+
+	t.Run("another app case", func(t *testing.T) {
+		auth := newAuthorization(t, 0, time.Now().Add(time.Minute))
+
+		_, err := strg.PollDeviceAuthorization(ctx, auth.DeviceCode, auth.AppID+1)
+		require.ErrorIs(t, err, storage.ErrDeviceCodeNotFound)
+	})
+
+	t.Run("user code exists case", func(t *testing.T) {
+		auth := newAuthorization(t, 0, time.Now().Add(time.Minute))
+
+		deviceCode, err := tokens.NewDeviceCode()
+		require.NoError(t, err)
+
+		err = strg.SaveDeviceAuthorization(ctx, &entity.DeviceAuthorization{
+			DeviceCode: *deviceCode,
+			UserCode:   auth.UserCode,
+			AppID:      auth.AppID,
+			ExpiresAt:  auth.ExpiresAt,
+		})
+		require.ErrorIs(t, err, storage.ErrUserCodeExists)
+	})
+}
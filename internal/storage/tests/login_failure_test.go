@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+)
+
+var errBlocked = errors.New("blocked")
+
+func TestLoginFailures(t *testing.T) {
+	forEachBackend(t, testLoginFailures)
+}
+
+func testLoginFailures(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	const key = "account:test-mail"
+
+	// stored with second precision.
+	firstAt := time.Now().Truncate(time.Second)
+	secondAt := firstAt.Add(time.Second)
+
+	var counted entity.LoginFailures
+
+	record := func(failures *entity.LoginFailures) error {
+		counted = *failures
+
+		return nil
+	}
+
+	failures, err := strg.ReserveLoginAttempt(ctx, key, firstAt, firstAt.Add(-time.Hour), record)
+	require.NoError(t, err)
+	require.Equal(t, 1, failures.Failures)
+	require.Zero(t, counted.Failures)
+
+	failures, err = strg.ReserveLoginAttempt(ctx, key, secondAt, secondAt.Add(-time.Hour), record)
+	require.NoError(t, err)
+	require.Equal(t, 2, failures.Failures)
+	require.True(t, secondAt.Equal(failures.LastFailureAt))
+	require.Equal(t, 1, counted.Failures)
+	require.True(t, firstAt.Equal(counted.LastFailureAt))
+
+	// a rejected attempt is not counted.
+	_, err = strg.ReserveLoginAttempt(ctx, key, secondAt, secondAt.Add(-time.Hour),
+		func(*entity.LoginFailures) error {
+			return errBlocked
+		})
+	require.ErrorIs(t, err, errBlocked)
+
+	// a released attempt is taken back, the time of the last failure is kept.
+	err = strg.ReleaseLoginAttempt(ctx, key)
+	require.NoError(t, err)
+
+	failures, err = strg.ReserveLoginAttempt(ctx, key, secondAt, secondAt.Add(-time.Hour), record)
+	require.NoError(t, err)
+	require.Equal(t, 2, failures.Failures)
+	require.Equal(t, 1, counted.Failures)
+	require.True(t, secondAt.Equal(counted.LastFailureAt))
+
+	// other keys are counted apart.
+	failures, err = strg.ReserveLoginAttempt(ctx, "ip:192.0.2.1", secondAt, secondAt.Add(-time.Hour), record)
+	require.NoError(t, err)
+	require.Equal(t, 1, failures.Failures)
+
+	// the last failure is older than resetBefore, counting starts over.
+	thirdAt := secondAt.Add(2 * time.Hour)
+
+	failures, err = strg.ReserveLoginAttempt(ctx, key, thirdAt, thirdAt.Add(-time.Hour), record)
+	require.NoError(t, err)
+	require.Equal(t, 1, failures.Failures)
+	require.Zero(t, counted.Failures)
+
+	err = strg.ResetLoginFailures(ctx, key)
+	require.NoError(t, err)
+
+	failures, err = strg.ReserveLoginAttempt(ctx, key, thirdAt, thirdAt.Add(-time.Hour), record)
+	require.NoError(t, err)
+	require.Equal(t, 1, failures.Failures)
+
+	// resetting or releasing a key without failures is not an error.
+	err = strg.ResetLoginFailures(ctx, key)
+	require.NoError(t, err)
+
+	err = strg.ResetLoginFailures(ctx, key)
+	require.NoError(t, err)
+
+	err = strg.ReleaseLoginAttempt(ctx, key)
+	require.NoError(t, err)
+}
+
+func TestReserveLoginAttemptConcurrently(t *testing.T) {
+	forEachBackend(t, testReserveLoginAttemptConcurrently)
+}
+
+func testReserveLoginAttemptConcurrently(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	const (
+		key      = "ip:192.0.2.1"
+		attempts = 10
+		allowed  = 3
+	)
+
+	now := time.Now()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+		errs     []error
+	)
+
+	for range attempts {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := strg.ReserveLoginAttempt(ctx, key, now, now.Add(-time.Hour),
+				func(failures *entity.LoginFailures) error {
+					if failures.Failures >= allowed {
+						return errBlocked
+					}
+
+					return nil
+				})
+			if errors.Is(err, errBlocked) {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, err)
+
+				return
+			}
+
+			reserved++
+		}()
+	}
+
+	wg.Wait()
+
+	require.Empty(t, errs)
+	require.Equal(t, allowed, reserved)
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+func TestRevokeRefreshFamilyByToken(t *testing.T) {
+	forEachBackend(t, testRevokeRefreshFamilyByToken)
+}
+
+func testRevokeRefreshFamilyByToken(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	refreshToken, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+
+	err = strg.NewRefreshSession(ctx, &entity.RefreshSession{
+		RefreshToken: *refreshToken,
+		UserID:       userID,
+		AppID:        1,
+		FamilyID:     uuid.NewString(),
+		ExpiresAt:    time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	next := nextSession(t)
+	next.AppID = 1
+
+	_, err = strg.RotateRefreshSession(ctx, *refreshToken, userID, next)
+	require.NoError(t, err)
+
+	// logging out with the latest token revokes the whole family.
+	err = strg.RevokeRefreshFamilyByToken(ctx, next.RefreshToken)
+	require.NoError(t, err)
+
+	for _, token := range []string{*refreshToken, next.RefreshToken} {
+		session, err := strg.GetRefreshSession(ctx, token)
+		require.NoError(t, err)
+		require.True(t, session.IsRevoked)
+	}
+
+	_, err = strg.RotateRefreshSession(ctx, next.RefreshToken, userID, nextSession(t))
+	require.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+
+	unknownToken, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+
+	err = strg.RevokeRefreshFamilyByToken(ctx, *unknownToken)
+	require.ErrorIs(t, err, storage.ErrRefreshTokenNotFound)
+}
+
+func TestRevokeUserRefreshSessions(t *testing.T) {
+	otherUserID := uuid.NewString()
+
+	cases := []struct {
+		testName        string
+		appID           int32
+		expectedRevoked int64
+	}{
+		{
+			testName:        "every app case",
+			appID:           0,
+			expectedRevoked: 3,
+		},
+		{
+			testName:        "single app case",
+			appID:           1,
+			expectedRevoked: 2,
+		},
+		{
+			testName:        "app without sessions case",
+			appID:           3,
+			expectedRevoked: 0,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, strg Store) {
+				ctx := context.Background()
+				otherToken := ""
+
+				sessions := []struct {
+					userID    string
+					appID     int32
+					expiresAt time.Time
+				}{
+					{userID: userID, appID: 1, expiresAt: time.Now().Add(time.Hour)},
+					{userID: userID, appID: 1, expiresAt: time.Now().Add(time.Hour)},
+					{userID: userID, appID: 2, expiresAt: time.Now().Add(time.Hour)},
+					{userID: userID, appID: 1, expiresAt: time.Now().Add(-time.Second)},
+					{userID: otherUserID, appID: 1, expiresAt: time.Now().Add(time.Hour)},
+				}
+
+				for _, session := range sessions {
+					refreshToken, err := tokens.NewRefreshToken()
+					require.NoError(t, err)
+
+					err = strg.NewRefreshSession(ctx, &entity.RefreshSession{
+						RefreshToken: *refreshToken,
+						UserID:       session.userID,
+						AppID:        session.appID,
+						FamilyID:     uuid.NewString(),
+						ExpiresAt:    session.expiresAt,
+					})
+					require.NoError(t, err)
+
+					if session.userID == otherUserID {
+						otherToken = *refreshToken
+					}
+				}
+
+				revoked, err := strg.RevokeUserRefreshSessions(ctx, userID, tcase.appID)
+				require.NoError(t, err)
+				require.Equal(t, tcase.expectedRevoked, revoked)
+
+				// sessions of other users are never touched.
+				other, err := strg.GetRefreshSession(ctx, otherToken)
+				require.NoError(t, err)
+				require.False(t, other.IsRevoked)
+			})
+		})
+	}
+}
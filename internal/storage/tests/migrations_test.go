@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+)
+
+func TestCheckSchema(t *testing.T) {
+	driver, storagePath := newEmptyDatabase(t)
+
+	expected, err := storage.SchemaVersion(driver)
+	require.NoError(t, err)
+
+	err = storage.CheckSchema(driver, storagePath)
+	require.ErrorIs(t, err, storage.ErrSchemaMismatch)
+
+	err = storage.MigrateUp(driver, storagePath)
+	require.NoError(t, err)
+
+	err = storage.CheckSchema(driver, storagePath)
+	require.NoError(t, err)
+
+	mInstance, err := storage.NewMigrator(driver, storagePath)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		mInstance.Close()
+	})
+
+	// a database behind the binary is refused.
+	err = mInstance.Steps(-1)
+	require.NoError(t, err)
+
+	err = storage.CheckSchema(driver, storagePath)
+	require.ErrorIs(t, err, storage.ErrSchemaMismatch)
+
+	// so is a dirty one, left by a failed migration, until its version is forced.
+	db, err := storage.Open(driver, storagePath)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	_, err = db.Exec(`update schema_migrations set dirty = true`)
+	require.NoError(t, err)
+
+	err = storage.CheckSchema(driver, storagePath)
+	require.ErrorIs(t, err, storage.ErrSchemaMismatch)
+
+	err = mInstance.Force(int(expected) - 1)
+	require.NoError(t, err)
+
+	err = mInstance.Up()
+	require.NoError(t, err)
+
+	err = storage.CheckSchema(driver, storagePath)
+	require.NoError(t, err)
+}
+
+func TestSchemaVersion(t *testing.T) {
+	cases := []struct {
+		testName        string
+		driver          string
+		expectedVersion uint
+		expectedErr     error
+	}{
+		{
+			testName:        "sqlite case",
+			driver:          storage.DriverSQLite,
+			expectedVersion: 14,
+		},
+		{
+			testName:        "postgres case",
+			driver:          storage.DriverPostgres,
+			expectedVersion: 4,
+		},
+		{
+			testName:    "memory case",
+			driver:      storage.DriverMemory,
+			expectedErr: storage.ErrUnknownDriver,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			version, err := storage.SchemaVersion(tcase.driver)
+			require.ErrorIs(t, err, tcase.expectedErr)
+			require.Equal(t, tcase.expectedVersion, version)
+		})
+	}
+}
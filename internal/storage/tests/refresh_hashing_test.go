@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+func TestRefreshTokenHashedAtRest(t *testing.T) {
+	strg, db := newMigratedStorage(t)
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	refreshToken, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+
+	err = strg.NewRefreshSession(ctx, &entity.RefreshSession{
+		RefreshToken: *refreshToken,
+		UserID:       userID,
+		FamilyID:     uuid.NewString(),
+		ExpiresAt:    time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+
+	var rows []struct {
+		TokenHash []byte `db:"tokenHash"`
+		UserID    string `db:"userID"`
+	}
+
+	err = db.Select(&rows, `select tokenHash, userID from refresh_session`)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+
+	// neither the raw token nor any part of it is stored.
+	require.NotContains(t, string(rows[0].TokenHash), *refreshToken)
+	require.NotContains(t, string(rows[0].TokenHash),
+		strings.TrimPrefix(*refreshToken, tokens.RefreshTokenPrefix)[:16])
+	require.Equal(t, userID, rows[0].UserID)
+
+	// the hash alone is not a valid token.
+	_, err = strg.RotateRefreshSession(ctx, string(rows[0].TokenHash), userID, nextSession(t))
+	require.ErrorIs(t, err, storage.ErrRefreshTokenNotFound)
+
+	_, err = strg.RotateRefreshSession(ctx, *refreshToken, userID, nextSession(t))
+	require.NoError(t, err)
+}
+
+func TestHashLegacyRefreshTokens(t *testing.T) {
+	strg, db := newMigratedStorage(t)
+	ctx := context.Background()
+
+	cases := []struct {
+		testName     string
+		refreshToken string
+		userID       string
+		swapped      bool // stored by Login with token and user id swapped
+	}{
+		{
+			testName:     "plaintext case",
+			refreshToken: "e8072fc7dfc55a232794a3b8d14e16c4e997bc5f490cd9cd57c8d4e8ff194554",
+			userID:       uuid.NewString(),
+		},
+		{
+			testName:     "swapped case",
+			refreshToken: "0b6f0b1f7c3b4ec8d0bb0a78c7b9f25c5fd2ae0e95e1f0a3bdf1e0f3f6c58c4e",
+			userID:       uuid.NewString(),
+			swapped:      true,
+		},
+	}
+
+	for _, tcase := range cases {
+		tokenColumn, userColumn := tcase.refreshToken, tcase.userID
+		if tcase.swapped {
+			tokenColumn, userColumn = userColumn, tokenColumn
+		}
+
+		_, err := db.Exec(db.Rebind(`insert into refresh_session(tokenHash, userID, expiresAt)
+			values(?, ?, ?)`), []byte(tokenColumn), userColumn, time.Now().Add(time.Hour).Unix())
+		require.NoError(t, err)
+	}
+
+	hashed, err := strg.HashLegacyRefreshTokens(ctx)
+	require.NoError(t, err)
+	require.Equal(t, len(cases), hashed)
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			var count int
+
+			err := db.Get(&count, db.Rebind(`select count(*) from refresh_session where tokenHash = ?`),
+				[]byte(tcase.refreshToken))
+			require.NoError(t, err)
+			require.Zero(t, count)
+
+			_, err = strg.RotateRefreshSession(ctx, tcase.refreshToken, tcase.userID, nextSession(t))
+			require.NoError(t, err)
+		})
+	}
+
+	// converting twice is a no-op.
+	hashed, err = strg.HashLegacyRefreshTokens(ctx)
+	require.NoError(t, err)
+	require.Zero(t, hashed)
+}
@@ -2,42 +2,100 @@ package storage
 
 import (
 	"context"
-	"log"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
 	"github.com/aspirin100/gRPC-SSO/internal/storage"
 	"github.com/aspirin100/gRPC-SSO/internal/tokens"
 )
 
 var userID = "48fd672b-81cb-4a37-a33f-8e2b1e0031d5"
-var refreshTokenPrepared = "e8072fc7dfc55a232794a3b8d14e16c4e997bc5f490cd9cd57c8d4e8ff194554" //nolint:gosec
 
 func TestNewRefreshSession(t *testing.T) {
-	refreshToken, err := tokens.NewRefreshToken()
-	if err != nil {
-		log.Print(err)
-		t.Fail()
-	}
+	forEachBackend(t, func(t *testing.T, strg Store) {
+		ctx := context.Background()
 
-	err = Storage.NewRefreshSession(context.Background(),
-		*refreshToken,
-		userID, time.Minute*60)
-	if err != nil {
-		log.Print(err)
-		t.Fail()
-	}
+		refreshToken, err := tokens.NewRefreshToken()
+		require.NoError(t, err)
+
+		session := &entity.RefreshSession{
+			RefreshToken: *refreshToken,
+			UserID:       userID,
+			AppID:        1,
+			FamilyID:     uuid.NewString(),
+			Scope:        "openid",
+			ExpiresAt:    time.Now().Add(time.Minute * 60).Truncate(time.Second),
+		}
+
+		err = strg.NewRefreshSession(ctx, session)
+		require.NoError(t, err)
+
+		// the token itself is never returned.
+		stored, err := strg.GetRefreshSession(ctx, *refreshToken)
+		require.NoError(t, err)
+		require.Equal(t, &entity.RefreshSession{
+			UserID:    session.UserID,
+			AppID:     session.AppID,
+			FamilyID:  session.FamilyID,
+			Scope:     session.Scope,
+			ExpiresAt: session.ExpiresAt,
+		}, stored)
+
+		_, err = strg.GetRefreshSession(ctx, "")
+		require.ErrorIs(t, err, storage.ErrRefreshTokenNotFound)
+	})
 }
 
-func TestValidateRefreshToken(t *testing.T) {
+func TestRotateRefreshSession(t *testing.T) {
+	forEachBackend(t, testRotateRefreshSession)
+}
+
+func testRotateRefreshSession(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	newSession := func(t *testing.T, expiresAt time.Time) string {
+		t.Helper()
+
+		refreshToken, err := tokens.NewRefreshToken()
+		require.NoError(t, err)
+
+		err = strg.NewRefreshSession(ctx, &entity.RefreshSession{
+			RefreshToken: *refreshToken,
+			UserID:       userID,
+			FamilyID:     uuid.NewString(),
+			ExpiresAt:    expiresAt,
+		})
+		require.NoError(t, err)
+
+		return *refreshToken
+	}
+
+	usedToken := newSession(t, time.Now().Add(time.Hour))
+	_, err := strg.RotateRefreshSession(ctx, usedToken, userID, nextSession(t))
+	require.NoError(t, err)
+
+	revokedToken := newSession(t, time.Now().Add(time.Hour))
+	err = strg.RevokeRefreshFamilyByToken(ctx, revokedToken)
+	require.NoError(t, err)
+
 	cases := []struct {
 		testName      string
 		refreshToken  string
 		userID        string
 		expectedError error
 	}{
+		{
+			testName:     "ok case",
+			refreshToken: newSession(t, time.Now().Add(time.Hour)),
+			userID:       userID,
+		},
 		{
 			testName:      "not found case",
 			refreshToken:  "",
@@ -45,19 +103,181 @@ func TestValidateRefreshToken(t *testing.T) {
 			expectedError: storage.ErrRefreshTokenNotFound,
 		},
 		{
-			testName:      "invalid refresh token case",
-			refreshToken:  refreshTokenPrepared,
+			testName:      "another user case",
+			refreshToken:  newSession(t, time.Now().Add(time.Hour)),
+			userID:        uuid.NewString(),
+			expectedError: storage.ErrRefreshTokenNotFound,
+		},
+		{
+			testName:      "expired refresh token case",
+			refreshToken:  newSession(t, time.Now().Add(-time.Second)),
+			userID:        userID,
+			expectedError: tokens.ErrInvalidRefreshToken,
+		},
+		{
+			testName:      "revoked refresh token case",
+			refreshToken:  revokedToken,
 			userID:        userID,
 			expectedError: tokens.ErrInvalidRefreshToken,
 		},
+		{
+			testName:      "used refresh token case",
+			refreshToken:  usedToken,
+			userID:        userID,
+			expectedError: storage.ErrRefreshTokenReused,
+		},
 	}
 
 	for _, tcase := range cases {
 		t.Run(tcase.testName, func(t *testing.T) {
-			err := Storage.ValidateRefreshToken(context.Background(),
-				tcase.refreshToken, tcase.userID)
+			next := nextSession(t)
+
+			_, err := strg.RotateRefreshSession(ctx,
+				tcase.refreshToken, tcase.userID, next)
+			require.ErrorIs(t, err, tcase.expectedError)
 
-			require.EqualValues(t, tcase.expectedError, err)
+			// the successor is only stored if the rotation succeeds.
+			_, err = strg.GetRefreshSession(ctx, next.RefreshToken)
+			if tcase.expectedError == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, storage.ErrRefreshTokenNotFound)
+			}
 		})
 	}
 }
+
+func TestRotateRefreshSessionConcurrent(t *testing.T) {
+	forEachBackend(t, testRotateRefreshSessionConcurrent)
+}
+
+func testRotateRefreshSessionConcurrent(t *testing.T, strg Store) {
+	const goroutines = 50
+
+	ctx := context.Background()
+	familyID := uuid.NewString()
+
+	refreshToken, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+
+	err = strg.NewRefreshSession(ctx, &entity.RefreshSession{
+		RefreshToken: *refreshToken,
+		UserID:       userID,
+		FamilyID:     familyID,
+		ExpiresAt:    time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	var (
+		wg        sync.WaitGroup
+		rotated   atomic.Int32
+		reused    atomic.Int32
+		failures  = make(chan error, goroutines)
+		startLine = make(chan struct{})
+		nexts     = make([]*entity.RefreshSession, 0, goroutines)
+	)
+
+	for range goroutines {
+		next := nextSession(t)
+		nexts = append(nexts, next)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-startLine
+
+			_, err := strg.RotateRefreshSession(ctx, *refreshToken, userID, next)
+
+			switch {
+			case err == nil:
+				rotated.Add(1)
+			case errors.Is(err, storage.ErrRefreshTokenReused):
+				reused.Add(1)
+			default:
+				failures <- err
+			}
+		}()
+	}
+
+	close(startLine)
+	wg.Wait()
+	close(failures)
+
+	for err := range failures {
+		require.NoError(t, err)
+	}
+
+	require.EqualValues(t, 1, rotated.Load())
+	require.EqualValues(t, goroutines-1, reused.Load())
+
+	// exactly one successor joined the family.
+	var stored int
+
+	for _, next := range nexts {
+		session, err := strg.GetRefreshSession(ctx, next.RefreshToken)
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			continue
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, familyID, session.FamilyID)
+
+		stored++
+	}
+
+	require.Equal(t, 1, stored)
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	forEachBackend(t, testRefreshTokenReuse)
+}
+
+func testRefreshTokenReuse(t *testing.T, strg Store) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	refreshToken, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+
+	err = strg.NewRefreshSession(ctx, &entity.RefreshSession{
+		RefreshToken: *refreshToken,
+		UserID:       userID,
+		FamilyID:     uuid.NewString(),
+		ExpiresAt:    time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	next := nextSession(t)
+	next.UserID = userID
+
+	session, err := strg.RotateRefreshSession(ctx, *refreshToken, userID, next)
+	require.NoError(t, err)
+	require.Equal(t, session.FamilyID, next.FamilyID)
+
+	// replaying the used token reports its family.
+	replayed, err := strg.RotateRefreshSession(ctx, *refreshToken, userID, nextSession(t))
+	require.ErrorIs(t, err, storage.ErrRefreshTokenReused)
+	require.Equal(t, session.FamilyID, replayed.FamilyID)
+
+	err = strg.RevokeRefreshFamily(ctx, session.FamilyID)
+	require.NoError(t, err)
+
+	// the descendant dies with its family.
+	_, err = strg.RotateRefreshSession(ctx, next.RefreshToken, userID, nextSession(t))
+	require.ErrorIs(t, err, tokens.ErrInvalidRefreshToken)
+}
+
+func nextSession(t *testing.T) *entity.RefreshSession {
+	t.Helper()
+
+	refreshToken, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+
+	return &entity.RefreshSession{
+		RefreshToken: *refreshToken,
+		UserID:       userID,
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+func TestDeleteExpiredRefreshSessions(t *testing.T) {
+	forEachBackend(t, testDeleteExpiredRefreshSessions)
+}
+
+func testDeleteExpiredRefreshSessions(t *testing.T, strg Store) {
+	ctx := context.Background()
+
+	newSession := func(t *testing.T, expiresAt time.Time) string {
+		t.Helper()
+
+		refreshToken, err := tokens.NewRefreshToken()
+		require.NoError(t, err)
+
+		err = strg.NewRefreshSession(ctx, &entity.RefreshSession{
+			RefreshToken: *refreshToken,
+			UserID:       userID,
+			FamilyID:     uuid.NewString(),
+			ExpiresAt:    expiresAt,
+		})
+		require.NoError(t, err)
+
+		return *refreshToken
+	}
+
+	liveToken := newSession(t, time.Now().Add(time.Hour))
+	expiredTokens := []string{
+		newSession(t, time.Now().Add(-time.Hour)),
+		newSession(t, time.Now().Add(-time.Minute)),
+		newSession(t, time.Now().Add(-time.Second)),
+	}
+
+	usedToken := newSession(t, time.Now().Add(time.Hour))
+	next := nextSession(t)
+
+	_, err := strg.RotateRefreshSession(ctx, usedToken, userID, next)
+	require.NoError(t, err)
+
+	// a used token is kept until it was used before the given time.
+	deleted, err := strg.DeleteExpiredRefreshSessions(ctx, time.Now().Add(-time.Hour), 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, deleted)
+
+	// at most limit sessions are deleted at once.
+	deleted, err = strg.DeleteExpiredRefreshSessions(ctx, time.Now(), 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, deleted)
+
+	deleted, err = strg.DeleteExpiredRefreshSessions(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, deleted)
+
+	for _, token := range append(expiredTokens, usedToken) {
+		_, err = strg.GetRefreshSession(ctx, token)
+		require.ErrorIs(t, err, storage.ErrRefreshTokenNotFound)
+	}
+
+	for _, token := range []string{liveToken, next.RefreshToken} {
+		_, err = strg.GetRefreshSession(ctx, token)
+		require.NoError(t, err)
+	}
+}
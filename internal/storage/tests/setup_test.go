@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/service/apps"
+	"github.com/aspirin100/gRPC-SSO/internal/service/auth"
+	"github.com/aspirin100/gRPC-SSO/internal/service/janitor"
+	"github.com/aspirin100/gRPC-SSO/internal/storage"
+	"github.com/aspirin100/gRPC-SSO/internal/storage/memory"
+)
+
+const (
+	// connection url of a postgres server the suite may create databases on,
+	// the suite runs against sqlite if not set. See make test-postgres.
+	postgresURLEnv = "TEST_POSTGRES_URL"
+
+	HashKey = "test_hash_key"
+)
+
+// Store is what the services need from a storage backend. Every backend must
+// pass the tests run with forEachBackend.
+type Store interface {
+	auth.AuthManager
+	apps.AppManager
+	janitor.SessionPurger
+	HashLegacyRefreshTokens(ctx context.Context) (int, error)
+}
+
+var (
+	_ Store = (*storage.Storage)(nil)
+	_ Store = (*memory.Storage)(nil)
+)
+
+// forEachBackend runs test against an empty store of every backend: the sql
+// one of newMigratedStorage and the memory one.
+func forEachBackend(t *testing.T, test func(t *testing.T, strg Store)) {
+	t.Helper()
+
+	backends := []struct {
+		name     string
+		newStore func(t *testing.T) Store
+	}{
+		{
+			name: "sql",
+			newStore: func(t *testing.T) Store {
+				t.Helper()
+
+				strg, _ := newMigratedStorage(t)
+
+				return strg
+			},
+		},
+		{
+			name: "memory",
+			newStore: func(_ *testing.T) Store {
+				return memory.New()
+			},
+		},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			test(t, backend.newStore(t))
+		})
+	}
+}
+
+// newMigratedStorage creates a storage over an empty database with every
+// migration applied. The raw connection lets tests inspect stored rows.
+func newMigratedStorage(t *testing.T) (*storage.Storage, *sqlx.DB) {
+	t.Helper()
+
+	driver, storagePath := newEmptyDatabase(t)
+
+	err := storage.MigrateUp(driver, storagePath)
+	require.NoError(t, err)
+
+	db, err := storage.Open(driver, storagePath)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	strg, err := storage.New(slog.Default(), driver, storagePath, []byte(HashKey))
+	require.NoError(t, err)
+
+	return strg, db
+}
+
+// newEmptyDatabase returns the driver and storage path of an empty database,
+// a postgres one if TEST_POSTGRES_URL is set.
+func newEmptyDatabase(t *testing.T) (string, string) {
+	t.Helper()
+
+	if serverURL := os.Getenv(postgresURLEnv); serverURL != "" {
+		return storage.DriverPostgres, newPostgresDatabase(t, serverURL)
+	}
+
+	return storage.DriverSQLite, filepath.Join(t.TempDir(), "sso.db")
+}
+
+// newPostgresDatabase creates an empty database dropped after the test and
+// returns its connection url.
+func newPostgresDatabase(t *testing.T, serverURL string) string {
+	t.Helper()
+
+	server, err := sqlx.Open("postgres", serverURL)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	suffix := make([]byte, 8)
+
+	_, err = rand.Read(suffix)
+	require.NoError(t, err)
+
+	name := "sso_test_" + hex.EncodeToString(suffix)
+
+	_, err = server.Exec("create database " + name)
+	require.NoError(t, err)
+
+	// registered before the cleanups closing connections, so it runs after them.
+	t.Cleanup(func() {
+		_, err := server.Exec("drop database if exists " + name + " with (force)")
+		require.NoError(t, err)
+	})
+
+	databaseURL, err := url.Parse(serverURL)
+	require.NoError(t, err)
+
+	databaseURL.Path = "/" + name
+
+	return databaseURL.String()
+}
@@ -2,130 +2,187 @@ package storage
 
 import (
 	"context"
-	"log/slog"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
 	"github.com/aspirin100/gRPC-SSO/internal/storage"
 )
 
-const StoragePath = "../sso.db"
-
-var Storage, _ = storage.New(slog.Default(), StoragePath)
-
 func TestSaveUser(t *testing.T) {
-	cases := []struct {
-		testName    string
-		email       string
-		passHash    []byte
-		expectedErr error
-	}{
-		{
-			testName:    "ok case",
-			email:       "test-mail",
-			passHash:    []byte("test-pass"),
-			expectedErr: nil,
-		},
-		{
-			testName:    "user exists case",
-			email:       "test-mail",
-			passHash:    []byte("test-pass"),
-			expectedErr: storage.ErrUserExists,
-		},
-	}
-
-	for _, tcase := range cases {
-		t.Run(tcase.testName, func(t *testing.T) {
-			_, err := Storage.SaveUser(context.Background(),
-				tcase.email, tcase.passHash)
-
-			require.EqualValues(t, tcase.expectedErr, err)
-		})
-	}
+	forEachBackend(t, func(t *testing.T, strg Store) {
+		cases := []struct {
+			testName    string
+			email       string
+			passHash    []byte
+			expectedErr error
+		}{
+			{
+				testName:    "ok case",
+				email:       "test-mail",
+				passHash:    []byte("test-pass"),
+				expectedErr: nil,
+			},
+			{
+				testName:    "user exists case",
+				email:       "test-mail",
+				passHash:    []byte("test-pass"),
+				expectedErr: storage.ErrUserExists,
+			},
+		}
+
+		for _, tcase := range cases {
+			t.Run(tcase.testName, func(t *testing.T) {
+				_, err := strg.SaveUser(context.Background(),
+					tcase.email, tcase.passHash)
+
+				require.ErrorIs(t, err, tcase.expectedErr)
+			})
+		}
+	})
 }
 
 func TestGetUser(t *testing.T) {
-	cases := []struct {
-		testName    string
-		email       string
-		expectedErr error
-	}{
-		{
-			testName:    "ok case",
-			email:       "test-mail",
-			expectedErr: nil,
-		},
-		{
-			testName:    "user not found case",
-			email:       "wrong-test-mail",
-			expectedErr: storage.ErrUserNotFound,
-		},
-	}
-
-	for _, tcase := range cases {
-		t.Run(tcase.testName, func(t *testing.T) {
-			_, err := Storage.GetUser(context.Background(),
-				tcase.email)
-
-			require.EqualValues(t, tcase.expectedErr, err)
-		})
-	}
+	forEachBackend(t, func(t *testing.T, strg Store) {
+		ctx := context.Background()
+
+		userID, err := strg.SaveUser(ctx, "test-mail", []byte("test-pass"))
+		require.NoError(t, err)
+
+		cases := []struct {
+			testName     string
+			email        string
+			expectedUser *entity.User
+			expectedErr  error
+		}{
+			{
+				testName: "ok case",
+				email:    "test-mail",
+				expectedUser: &entity.User{
+					UserID:   userID,
+					Email:    "test-mail",
+					PassHash: []byte("test-pass"),
+				},
+				expectedErr: nil,
+			},
+			{
+				testName:    "user not found case",
+				email:       "wrong-test-mail",
+				expectedErr: storage.ErrUserNotFound,
+			},
+		}
+
+		for _, tcase := range cases {
+			t.Run(tcase.testName, func(t *testing.T) {
+				user, err := strg.GetUser(ctx, tcase.email)
+				require.ErrorIs(t, err, tcase.expectedErr)
+				require.Equal(t, tcase.expectedUser, user)
+			})
+		}
+
+		byID, err := strg.GetUserByID(ctx, userID)
+		require.NoError(t, err)
+		require.Equal(t, "test-mail", byID.Email)
+
+		_, err = strg.GetUserByID(ctx, uuid.NewString())
+		require.ErrorIs(t, err, storage.ErrUserNotFound)
+	})
 }
 
 func TestIsAdmin(t *testing.T) {
-	cases := []struct {
-		testName    string
-		userID      string
-		expectedErr error
-	}{
-		{
-			testName:    "ok case",
-			userID:      "4f1eb1b5-0520-4917-b865-3f2d460f9603",
-			expectedErr: nil,
-		},
-		{
-			testName:    "user not found case",
-			userID:      uuid.Nil.String(),
-			expectedErr: storage.ErrUserNotFound,
-		},
-	}
-
-	for _, tcase := range cases {
-		t.Run(tcase.testName, func(t *testing.T) {
-			_, err := Storage.IsAdmin(context.Background(),
-				tcase.userID)
-
-			require.EqualValues(t, tcase.expectedErr, err)
-		})
-	}
+	forEachBackend(t, func(t *testing.T, strg Store) {
+		userID, err := strg.SaveUser(context.Background(), "test-mail", []byte("test-pass"))
+		require.NoError(t, err)
+
+		cases := []struct {
+			testName    string
+			userID      string
+			expectedErr error
+		}{
+			{
+				testName:    "ok case",
+				userID:      userID,
+				expectedErr: nil,
+			},
+			{
+				testName:    "user not found case",
+				userID:      uuid.Nil.String(),
+				expectedErr: storage.ErrUserNotFound,
+			},
+		}
+
+		for _, tcase := range cases {
+			t.Run(tcase.testName, func(t *testing.T) {
+				isAdmin, err := strg.IsAdmin(context.Background(),
+					tcase.userID)
+				require.ErrorIs(t, err, tcase.expectedErr)
+
+				if tcase.expectedErr == nil {
+					// users are registered without the admin role.
+					require.False(t, *isAdmin)
+				}
+			})
+		}
+	})
 }
 
 func TestGetApp(t *testing.T) {
-	cases := []struct {
-		testName    string
-		appID       int32
-		expectedErr error
-	}{
-		{
-			testName:    "ok case",
-			appID:       1,
-			expectedErr: nil,
-		},
-		{
-			testName:    "app not found case",
-			appID:       0,
-			expectedErr: storage.ErrAppNotFound,
-		},
-	}
-
-	for _, tcase := range cases {
-		t.Run(tcase.testName, func(t *testing.T) {
-			_, err := Storage.GetApp(context.Background(),
-				tcase.appID)
-
-			require.EqualValues(t, tcase.expectedErr, err)
-		})
-	}
+	forEachBackend(t, func(t *testing.T, strg Store) {
+		saved, err := strg.SaveApp(context.Background(), &entity.App{Name: "test-app"})
+		require.NoError(t, err)
+
+		cases := []struct {
+			testName    string
+			appID       int32
+			expectedErr error
+		}{
+			{
+				testName:    "ok case",
+				appID:       saved.ID,
+				expectedErr: nil,
+			},
+			{
+				testName:    "app not found case",
+				appID:       0,
+				expectedErr: storage.ErrAppNotFound,
+			},
+		}
+
+		for _, tcase := range cases {
+			t.Run(tcase.testName, func(t *testing.T) {
+				_, err := strg.GetApp(context.Background(),
+					tcase.appID)
+
+				require.ErrorIs(t, err, tcase.expectedErr)
+			})
+		}
+
+		byClientID, err := strg.GetAppByClientID(context.Background(), saved.ClientID)
+		require.NoError(t, err)
+		require.Equal(t, saved, byClientID)
+
+		_, err = strg.GetAppByClientID(context.Background(), uuid.NewString())
+		require.ErrorIs(t, err, storage.ErrAppNotFound)
+	})
+}
+
+func TestUpdatePasswordHash(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, strg Store) {
+		ctx := context.Background()
+
+		userID, err := strg.SaveUser(ctx, "test-mail", []byte("test-pass"))
+		require.NoError(t, err)
+
+		err = strg.UpdatePasswordHash(ctx, userID, []byte("new-test-pass"))
+		require.NoError(t, err)
+
+		user, err := strg.GetUser(ctx, "test-mail")
+		require.NoError(t, err)
+		require.Equal(t, []byte("new-test-pass"), user.PassHash)
+
+		err = strg.UpdatePasswordHash(ctx, uuid.NewString(), []byte("new-test-pass"))
+		require.ErrorIs(t, err, storage.ErrUserNotFound)
+	})
 }
@@ -0,0 +1,73 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	UserCodeLen = 8
+	// consonants only, so user codes don't spell words and are easy to type,
+	// RFC 8628 section 6.1.
+	userCodeAlphabet  = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeSeparator = "-"
+)
+
+// NewDeviceCode generates an oauth device code in the refresh token format
+// with the ssodc1_ prefix.
+func NewDeviceCode() (*string, error) {
+	return newOpaqueToken(DeviceCodePrefix)
+}
+
+// IsDeviceCode validates prefix, length and checksum of a device code.
+func IsDeviceCode(code string) bool {
+	return isOpaqueToken(code, DeviceCodePrefix)
+}
+
+// NewUserCode generates the code a user types on the verification page, in
+// the normalized form without a separator.
+func NewUserCode() (string, error) {
+	alphabetLen := big.NewInt(int64(len(userCodeAlphabet)))
+
+	var code strings.Builder
+
+	for range UserCodeLen {
+		idx, err := rand.Int(rand.Reader, alphabetLen)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate user code: %w", err)
+		}
+
+		code.WriteByte(userCodeAlphabet[idx.Int64()])
+	}
+
+	return code.String(), nil
+}
+
+// FormatUserCode splits a normalized user code in halves for display: WDJB-MJHT.
+func FormatUserCode(code string) string {
+	if len(code) != UserCodeLen {
+		return code
+	}
+
+	return code[:UserCodeLen/2] + userCodeSeparator + code[UserCodeLen/2:]
+}
+
+// NormalizeUserCode accepts a user code typed in any case, with or without
+// separators, and returns its normalized form.
+func NormalizeUserCode(input string) (string, bool) {
+	code := strings.ToUpper(strings.NewReplacer(userCodeSeparator, "", " ", "").Replace(input))
+
+	if len(code) != UserCodeLen {
+		return "", false
+	}
+
+	for _, char := range code {
+		if !strings.ContainsRune(userCodeAlphabet, char) {
+			return "", false
+		}
+	}
+
+	return code, true
+}
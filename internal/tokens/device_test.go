@@ -0,0 +1,57 @@
+package tokens_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+func TestUserCode(t *testing.T) {
+	code, err := tokens.NewUserCode()
+	require.NoError(t, err)
+	require.Len(t, code, tokens.UserCodeLen)
+
+	normalized, ok := tokens.NormalizeUserCode(code)
+	require.True(t, ok)
+	require.Equal(t, code, normalized)
+
+	cases := []struct {
+		testName string
+		input    string
+		expected string
+		ok       bool
+	}{
+		{
+			testName: "formatted case",
+			input:    "WDJB-MJHT",
+			expected: "WDJBMJHT",
+			ok:       true,
+		},
+		{
+			testName: "lower case with spaces case",
+			input:    " wdjb mjht ",
+			expected: "WDJBMJHT",
+			ok:       true,
+		},
+		{
+			testName: "vowel case",
+			input:    "WDJB-MJHA",
+		},
+		{
+			testName: "short case",
+			input:    "WDJB-MJH",
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			normalized, ok := tokens.NormalizeUserCode(tcase.input)
+			require.Equal(t, tcase.ok, ok)
+			require.Equal(t, tcase.expected, normalized)
+		})
+	}
+
+	require.Equal(t, "WDJB-MJHT", tokens.FormatUserCode("WDJBMJHT"))
+}
@@ -0,0 +1,54 @@
+package tokens
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+)
+
+// IDTokenParams describe an OpenID Connect ID token to issue.
+type IDTokenParams struct {
+	User     entity.UserInfo // claims released by the granted scopes, sub is required.
+	ClientID string          // aud
+	Issuer   string
+	TTL      time.Duration
+	Nonce    string // nonce of the authorization request, optional.
+}
+
+// idClaims are the ID token claims of OpenID Connect Core section 2.
+type idClaims struct {
+	jwt.RegisteredClaims
+
+	Nonce             string `json:"nonce,omitempty"`
+	Email             string `json:"email,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"` //nolint:tagliatelle
+}
+
+// NewIDToken issues an ID token telling the client who logged in.
+func NewIDToken(params IDTokenParams, key *SigningKey) (*string, error) {
+	now := time.Now()
+
+	claims := idClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    params.Issuer,
+			Subject:   params.User.Subject,
+			Audience:  jwt.ClaimStrings{params.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(params.TTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Nonce:             params.Nonce,
+		Email:             params.User.Email,
+		PreferredUsername: params.User.PreferredUsername,
+	}
+
+	token := jwt.NewWithClaims(key.Method(), claims)
+
+	signed, err := key.sign(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &signed, nil
+}
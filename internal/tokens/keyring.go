@@ -0,0 +1,201 @@
+package tokens
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+)
+
+// KeyRing holds the key new tokens are signed with, the keys scheduled to
+// take over and every older key whose tokens may still be alive. A rotated
+// out key keeps verifying tokens until the retention period (the longest
+// access token TTL) has elapsed.
+//
+// Which key signs and which verify follows from the schedule and the clock
+// alone, so replicas with the same configuration agree on the keys whenever
+// they started.
+type KeyRing struct {
+	mu        sync.RWMutex
+	initial   *SigningKey            // signs until the first scheduled key activates
+	scheduled []scheduledKey         // by activation time
+	previous  map[string]retiringKey // kid -> key
+	retention time.Duration
+}
+
+type scheduledKey struct {
+	key        *SigningKey
+	activateAt time.Time
+}
+
+type retiringKey struct {
+	key      *SigningKey
+	retireAt time.Time
+}
+
+// NewKeyRing creates a key ring signing with current. Previous keys are only
+// used for verification and retire once retention has elapsed.
+func NewKeyRing(current *SigningKey,
+	retention time.Duration,
+	previous ...*SigningKey) *KeyRing {
+	ring := &KeyRing{
+		initial:   current,
+		previous:  make(map[string]retiringKey, len(previous)),
+		retention: retention,
+	}
+
+	retireAt := time.Now().Add(retention)
+
+	for _, key := range previous {
+		if key.ID() == current.ID() {
+			continue
+		}
+
+		ring.previous[key.ID()] = retiringKey{
+			key:      key,
+			retireAt: retireAt,
+		}
+	}
+
+	return ring
+}
+
+// Schedule makes key the signing key at activateAt, a time in the past
+// activates it right away. The key it takes over from retires the retention
+// period after activateAt. Until then the scheduled key already verifies and
+// is published, so verifiers know it before the first token signed with it.
+func (r *KeyRing) Schedule(key *SigningKey, activateAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.scheduled = append(r.scheduled, scheduledKey{
+		key:        key,
+		activateAt: activateAt,
+	})
+
+	slices.SortStableFunc(r.scheduled, func(a, b scheduledKey) int {
+		return a.activateAt.Compare(b.activateAt)
+	})
+}
+
+// SigningKey returns the key new tokens must be signed with.
+func (r *KeyRing) SigningKey() *SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, _ := r.signingKeyAt(time.Now())
+
+	return key
+}
+
+// signingKeyAt returns the key signing at now and its index in the schedule,
+// -1 for the initial key.
+func (r *KeyRing) signingKeyAt(now time.Time) (*SigningKey, int) {
+	for i := len(r.scheduled) - 1; i >= 0; i-- {
+		if !now.Before(r.scheduled[i].activateAt) {
+			return r.scheduled[i].key, i
+		}
+	}
+
+	return r.initial, -1
+}
+
+// Retention returns how long a rotated out key keeps verifying tokens, no
+// token may live longer.
+func (r *KeyRing) Retention() time.Duration {
+	return r.retention
+}
+
+// VerificationKey finds an active or scheduled key by its kid.
+func (r *KeyRing) VerificationKey(kid string) (*SigningKey, bool) {
+	for _, key := range r.VerificationKeys() {
+		if key.ID() == kid {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+// VerificationKeys returns every active key: the current signing key first,
+// then the scheduled ones and the rotated out ones not retired yet. Retired
+// keys are left out.
+func (r *KeyRing) VerificationKeys() []*SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	current, index := r.signingKeyAt(now)
+
+	keys := []*SigningKey{current}
+
+	for _, key := range r.scheduled[index+1:] {
+		keys = append(keys, key.key)
+	}
+
+	retiring := make([]retiringKey, 0, len(r.previous)+index+1)
+
+	for _, key := range r.previous {
+		retiring = append(retiring, key)
+	}
+
+	// every key up to the current one retires after its successor activated.
+	if index >= 0 {
+		retiring = append(retiring, retiringKey{
+			key:      r.initial,
+			retireAt: r.scheduled[0].activateAt.Add(r.retention),
+		})
+	}
+
+	for i := range index {
+		retiring = append(retiring, retiringKey{
+			key:      r.scheduled[i].key,
+			retireAt: r.scheduled[i+1].activateAt.Add(r.retention),
+		})
+	}
+
+	// newest keys retire last, keep them first.
+	slices.SortFunc(retiring, func(a, b retiringKey) int {
+		return b.retireAt.Compare(a.retireAt)
+	})
+
+	for _, key := range retiring {
+		if now.Before(key.retireAt) && !slices.ContainsFunc(keys, func(k *SigningKey) bool {
+			return k.ID() == key.key.ID()
+		}) {
+			keys = append(keys, key.key)
+		}
+	}
+
+	return keys
+}
+
+// JWKS returns the public part of every active asymmetric key.
+func (r *KeyRing) JWKS() *entity.JSONWebKeySet {
+	return JWKS(r.VerificationKeys()...)
+}
+
+// Keyfunc resolves the verification key of a token by its kid header.
+// Tokens issued before kids were introduced are checked against the current key.
+func (r *KeyRing) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := r.SigningKey(), true
+	if kid != "" {
+		key, ok = r.VerificationKey(kid)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, kid)
+	}
+
+	if !key.Verifies(token.Method.Alg()) {
+		return nil, fmt.Errorf("%w: %q", ErrUnexpectedSigningMethod, token.Method.Alg())
+	}
+
+	return key.PublicKey(), nil
+}
@@ -0,0 +1,155 @@
+package tokens_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens/tokenstest"
+)
+
+var testTokenParams = tokens.AccessTokenParams{
+	UserID: "test user id",
+	AppID:  1,
+	Issuer: "test issuer",
+	TTL:    time.Minute,
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	const retention = 200 * time.Millisecond
+
+	oldKey, err := tokenstest.GenerateSigningKey(jwt.SigningMethodEdDSA)
+	require.NoError(t, err)
+
+	newKey, err := tokenstest.GenerateSigningKey(jwt.SigningMethodEdDSA)
+	require.NoError(t, err)
+
+	ring := tokens.NewKeyRing(oldKey, retention)
+	ring.Schedule(newKey, time.Now().Add(retention))
+
+	oldToken, err := tokens.NewAccessToken(testTokenParams, ring.SigningKey())
+	require.NoError(t, err)
+
+	// the scheduled key is published before it signs.
+	require.Len(t, ring.JWKS().Keys, 2)
+	require.Equal(t, oldKey.ID(), ring.JWKS().Keys[0].Kid)
+
+	time.Sleep(retention)
+
+	require.Equal(t, newKey.ID(), ring.SigningKey().ID())
+
+	newToken, err := tokens.NewAccessToken(testTokenParams, ring.SigningKey())
+	require.NoError(t, err)
+
+	// both keys are published and verify their tokens during the overlap.
+	require.Len(t, ring.JWKS().Keys, 2)
+	require.Equal(t, newKey.ID(), ring.JWKS().Keys[0].Kid)
+
+	for _, token := range []string{*oldToken, *newToken} {
+		_, err = jwt.Parse(token, ring.Keyfunc)
+		require.NoError(t, err)
+	}
+
+	time.Sleep(retention)
+
+	require.Len(t, ring.JWKS().Keys, 1)
+
+	_, err = jwt.Parse(*oldToken, ring.Keyfunc)
+	require.ErrorIs(t, err, tokens.ErrUnknownKeyID)
+
+	_, err = jwt.Parse(*newToken, ring.Keyfunc)
+	require.NoError(t, err)
+}
+
+func TestKeyRingSchedule(t *testing.T) {
+	const retention = time.Hour
+
+	keys := make([]*tokens.SigningKey, 3)
+
+	for i := range keys {
+		key, err := tokenstest.GenerateSigningKey(jwt.SigningMethodEdDSA)
+		require.NoError(t, err)
+
+		keys[i] = key
+	}
+
+	// the second key activated longer ago than the retention, the third
+	// recently. Any replica starting now ends up with the same keys.
+	now := time.Now()
+
+	for range 2 {
+		ring := tokens.NewKeyRing(keys[0], retention)
+		ring.Schedule(keys[2], now.Add(-time.Minute))
+		ring.Schedule(keys[1], now.Add(-2*retention))
+
+		require.Equal(t, keys[2].ID(), ring.SigningKey().ID())
+
+		_, ok := ring.VerificationKey(keys[1].ID())
+		require.True(t, ok)
+
+		_, ok = ring.VerificationKey(keys[0].ID())
+		require.False(t, ok)
+	}
+}
+
+func TestKeyRingPreviousKeys(t *testing.T) {
+	previous, err := tokens.NewSecretKey("previous_secret_key")
+	require.NoError(t, err)
+
+	current, err := tokenstest.GenerateSigningKey(jwt.SigningMethodES256)
+	require.NoError(t, err)
+
+	previousToken, err := tokens.NewAccessToken(testTokenParams, previous)
+	require.NoError(t, err)
+
+	ring := tokens.NewKeyRing(current, time.Minute, previous)
+
+	token, err := jwt.Parse(*previousToken, ring.Keyfunc)
+	require.NoError(t, err)
+	require.Equal(t, previous.ID(), token.Header["kid"])
+
+	// symmetric keys verify but are never published.
+	require.Len(t, ring.JWKS().Keys, 1)
+	require.Equal(t, current.ID(), ring.JWKS().Keys[0].Kid)
+}
+
+func TestKeyRingPreviousKeyMethods(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	psKey, err := tokens.NewSigningKey(jwt.SigningMethodPS384, rsaKey)
+	require.NoError(t, err)
+
+	hsKey, err := tokens.LoadSigningKey("HS512", "", "previous_secret_key")
+	require.NoError(t, err)
+
+	current, err := tokenstest.GenerateSigningKey(jwt.SigningMethodES256)
+	require.NoError(t, err)
+
+	// previous keys are configured without their method.
+	previousRSA, err := tokens.LoadVerificationKey(writePrivateKey(t, rsaKey))
+	require.NoError(t, err)
+
+	previousSecret, err := tokens.NewVerificationSecretKey("previous_secret_key")
+	require.NoError(t, err)
+
+	ring := tokens.NewKeyRing(current, time.Minute, previousRSA, previousSecret)
+
+	for _, key := range []*tokens.SigningKey{psKey, hsKey} {
+		token, err := tokens.NewAccessToken(testTokenParams, key)
+		require.NoError(t, err)
+
+		_, err = jwt.Parse(*token, ring.Keyfunc)
+		require.NoError(t, err, key.Method().Alg())
+	}
+
+	// the current key verifies its own method only.
+	require.True(t, current.Verifies(jwt.SigningMethodES256.Alg()))
+	require.False(t, current.Verifies(jwt.SigningMethodES384.Alg()))
+	require.False(t, previousRSA.Verifies(jwt.SigningMethodES256.Alg()))
+}
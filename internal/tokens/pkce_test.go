@@ -0,0 +1,54 @@
+package tokens_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B.
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+
+	require.Equal(t, challenge, tokens.PKCEChallenge(verifier))
+	require.True(t, tokens.IsCodeChallenge(challenge))
+
+	cases := []struct {
+		testName string
+		verifier string
+		expected bool
+	}{
+		{
+			testName: "ok case",
+			verifier: verifier,
+			expected: true,
+		},
+		{
+			testName: "wrong verifier case",
+			verifier: strings.ToUpper(verifier),
+			expected: false,
+		},
+		{
+			testName: "short verifier case",
+			verifier: verifier[:42],
+			expected: false,
+		},
+		{
+			testName: "reserved characters case",
+			verifier: verifier + "/+=",
+			expected: false,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			require.Equal(t, tcase.expected, tokens.VerifyPKCE(tcase.verifier, challenge))
+		})
+	}
+}
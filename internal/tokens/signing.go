@@ -0,0 +1,349 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+)
+
+var (
+	ErrUnsupportedSigningMethod = errors.New("unsupported signing method")
+	ErrEmptySecretKey           = errors.New("secret key is required for HMAC signing")
+	ErrEmptyPrivateKeyPath      = errors.New("private key path is required for asymmetric signing")
+	ErrInvalidPrivateKey        = errors.New("private key does not match signing method")
+)
+
+const keyIDBytesLen = 12
+
+// SigningKey is a private key paired with the jwt method it signs with.
+type SigningKey struct {
+	id      string // kid header value
+	method  jwt.SigningMethod
+	private any // []byte for HMAC, crypto.Signer otherwise.
+	// the method of previous keys is not configured, they verify every
+	// method of their key type.
+	anyMethod bool
+}
+
+// LoadSigningKey builds a signing key for the given method. HMAC methods use
+// secretKey, asymmetric ones read a PEM encoded private key from privateKeyPath.
+func LoadSigningKey(method, privateKeyPath, secretKey string) (*SigningKey, error) {
+	signingMethod := jwt.GetSigningMethod(method)
+	if signingMethod == nil || signingMethod == jwt.SigningMethodNone {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedSigningMethod, method)
+	}
+
+	if _, ok := signingMethod.(*jwt.SigningMethodHMAC); ok {
+		if secretKey == "" {
+			return nil, ErrEmptySecretKey
+		}
+
+		return newHMACKey(signingMethod, []byte(secretKey)), nil
+	}
+
+	if privateKeyPath == "" {
+		return nil, ErrEmptyPrivateKeyPath
+	}
+
+	pemBytes, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	privateKey, err := ParsePrivateKey(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSigningKey(signingMethod, privateKey)
+}
+
+// LoadVerificationKey reads a PEM encoded private key that was used for signing
+// before a rotation. It verifies tokens of every method of its key type, RSA
+// keys for example RS256 to PS512.
+func LoadVerificationKey(privateKeyPath string) (*SigningKey, error) {
+	pemBytes, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	privateKey, err := ParsePrivateKey(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var method jwt.SigningMethod
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		method = ecdsaMethodByBits(key.Curve.Params().BitSize)
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	}
+
+	if method == nil {
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidPrivateKey, privateKey)
+	}
+
+	key, err := NewSigningKey(method, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key.anyMethod = true
+
+	return key, nil
+}
+
+// NewVerificationSecretKey creates a key from a shared secret that was used for
+// signing before a rotation. It verifies tokens of HS256, HS384 and HS512.
+func NewVerificationSecretKey(secretKey string) (*SigningKey, error) {
+	key, err := NewSecretKey(secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key.anyMethod = true
+
+	return key, nil
+}
+
+// NewSecretKey creates an HS256 key from a shared secret.
+func NewSecretKey(secretKey string) (*SigningKey, error) {
+	if secretKey == "" {
+		return nil, ErrEmptySecretKey
+	}
+
+	return newHMACKey(jwt.SigningMethodHS256, []byte(secretKey)), nil
+}
+
+// NewSigningKey pairs an already parsed private key with a signing method.
+func NewSigningKey(method jwt.SigningMethod, privateKey crypto.Signer) (*SigningKey, error) {
+	if !keyMatchesMethod(method, privateKey) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPrivateKey, method.Alg())
+	}
+
+	key := &SigningKey{
+		method:  method,
+		private: privateKey,
+	}
+
+	jwk, _ := key.JWK()
+	key.id = thumbprint(jwk)
+
+	return key, nil
+}
+
+// ParsePrivateKey decodes a PEM block holding a PKCS#8, PKCS#1 or SEC 1 private key.
+func ParsePrivateKey(pemBytes []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found", ErrInvalidPrivateKey)
+	}
+
+	var (
+		key any
+		err error
+	)
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidPrivateKey, key)
+	}
+
+	return signer, nil
+}
+
+// ID is the key identifier stamped into the kid header of every token signed with the key.
+func (k *SigningKey) ID() string {
+	return k.id
+}
+
+func (k *SigningKey) Method() jwt.SigningMethod {
+	return k.method
+}
+
+// Verifies reports whether tokens signed with alg are checked against the key.
+func (k *SigningKey) Verifies(alg string) bool {
+	if !k.anyMethod {
+		return alg == k.method.Alg()
+	}
+
+	method := jwt.GetSigningMethod(alg)
+
+	if k.IsSymmetric() {
+		_, isHMAC := method.(*jwt.SigningMethodHMAC)
+
+		return isHMAC
+	}
+
+	signer, ok := k.private.(crypto.Signer)
+
+	return ok && keyMatchesMethod(method, signer)
+}
+
+// PublicKey returns the key used to verify signatures: the public half for
+// asymmetric methods and the shared secret for HMAC.
+func (k *SigningKey) PublicKey() any {
+	if signer, ok := k.private.(crypto.Signer); ok {
+		return signer.Public()
+	}
+
+	return k.private
+}
+
+// IsSymmetric reports whether the key is a shared HMAC secret, which must never be published.
+func (k *SigningKey) IsSymmetric() bool {
+	_, ok := k.private.([]byte)
+
+	return ok
+}
+
+func (k *SigningKey) sign(token *jwt.Token) (string, error) {
+	token.Header["kid"] = k.id
+
+	signed, err := token.SignedString(k.private)
+	if err != nil {
+		return "", fmt.Errorf("jwt token signing failure: %w", err)
+	}
+
+	return signed, nil
+}
+
+// JWK returns the public part of the key in JSON Web Key form. Symmetric keys
+// have no public part, so ok is false for them.
+func (k *SigningKey) JWK() (jwk entity.JSONWebKey, ok bool) {
+	jwk = entity.JSONWebKey{
+		Kid: k.id,
+		Use: "sig",
+		Alg: k.method.Alg(),
+	}
+
+	switch pub := k.PublicKey().(type) {
+	case *rsa.PublicKey:
+		// RS* and PS* share RSA keys, verifiers must go by the token header.
+		if k.anyMethod {
+			jwk.Alg = ""
+		}
+
+		jwk.Kty = "RSA"
+		jwk.N = encodeBase64URL(pub.N.Bytes())
+		jwk.E = encodeBase64URL(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecKey, err := pub.ECDH()
+		if err != nil {
+			return jwk, false
+		}
+
+		// uncompressed point: 0x04 || X || Y, both coordinates padded to the curve size.
+		point := ecKey.Bytes()
+		size := (len(point) - 1) / 2 //nolint:mnd
+
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = encodeBase64URL(point[1 : 1+size])
+		jwk.Y = encodeBase64URL(point[1+size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeBase64URL(pub)
+	default:
+		return jwk, false
+	}
+
+	return jwk, true
+}
+
+func newHMACKey(method jwt.SigningMethod, secret []byte) *SigningKey {
+	// the secret must not be derivable from the kid, so only a truncated hash is exposed.
+	sum := sha256.Sum256(secret)
+
+	return &SigningKey{
+		id:      encodeBase64URL(sum[:keyIDBytesLen]),
+		method:  method,
+		private: secret,
+	}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint used as kid for asymmetric keys.
+func thumbprint(jwk entity.JSONWebKey) string {
+	var members string
+
+	// required members only, in lexicographic order.
+	switch jwk.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, jwk.E, jwk.Kty, jwk.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y)
+	default:
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Crv, jwk.Kty, jwk.X)
+	}
+
+	sum := sha256.Sum256([]byte(members))
+
+	return encodeBase64URL(sum[:])
+}
+
+func ecdsaMethodByBits(bits int) jwt.SigningMethod {
+	switch bits {
+	case jwt.SigningMethodES256.CurveBits:
+		return jwt.SigningMethodES256
+	case jwt.SigningMethodES384.CurveBits:
+		return jwt.SigningMethodES384
+	case jwt.SigningMethodES512.CurveBits:
+		return jwt.SigningMethodES512
+	default:
+		return nil
+	}
+}
+
+func keyMatchesMethod(method jwt.SigningMethod, privateKey crypto.Signer) bool {
+	switch method := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := privateKey.(*rsa.PrivateKey)
+
+		return ok
+	case *jwt.SigningMethodECDSA:
+		key, ok := privateKey.(*ecdsa.PrivateKey)
+
+		return ok && key.Curve.Params().BitSize == method.CurveBits
+	case *jwt.SigningMethodEd25519:
+		_, ok := privateKey.(ed25519.PrivateKey)
+
+		return ok
+	default:
+		return false
+	}
+}
+
+func encodeBase64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,133 @@
+package tokens_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+func TestLoadSigningKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	cases := []struct {
+		testName      string
+		method        string
+		privateKey    crypto.Signer
+		secretKey     string
+		expectedKty   string
+		expectedError error
+	}{
+		{
+			testName:  "hmac case",
+			method:    "HS256",
+			secretKey: "secret_test_key",
+		},
+		{
+			testName:    "rsa case",
+			method:      "RS256",
+			privateKey:  rsaKey,
+			expectedKty: "RSA",
+		},
+		{
+			testName:    "ecdsa case",
+			method:      "ES256",
+			privateKey:  ecKey,
+			expectedKty: "EC",
+		},
+		{
+			testName:    "ed25519 case",
+			method:      "EdDSA",
+			privateKey:  edKey,
+			expectedKty: "OKP",
+		},
+		{
+			testName:      "empty secret case",
+			method:        "HS256",
+			expectedError: tokens.ErrEmptySecretKey,
+		},
+		{
+			testName:      "key mismatch case",
+			method:        "ES384",
+			privateKey:    ecKey,
+			expectedError: tokens.ErrInvalidPrivateKey,
+		},
+		{
+			testName:      "unsupported method case",
+			method:        "none",
+			expectedError: tokens.ErrUnsupportedSigningMethod,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			var keyPath string
+			if tcase.privateKey != nil {
+				keyPath = writePrivateKey(t, tcase.privateKey)
+			}
+
+			key, err := tokens.LoadSigningKey(tcase.method, keyPath, tcase.secretKey)
+			require.ErrorIs(t, err, tcase.expectedError)
+
+			if tcase.expectedError != nil {
+				return
+			}
+
+			token, err := tokens.NewAccessToken(testTokenParams, key)
+			require.NoError(t, err)
+
+			parsed, err := jwt.Parse(*token, func(*jwt.Token) (any, error) {
+				return key.PublicKey(), nil
+			}, jwt.WithValidMethods([]string{tcase.method}))
+			require.NoError(t, err)
+			require.True(t, parsed.Valid)
+
+			jwks := tokens.JWKS(key)
+			if tcase.expectedKty == "" {
+				require.Empty(t, jwks.Keys)
+
+				return
+			}
+
+			require.Len(t, jwks.Keys, 1)
+			require.Equal(t, tcase.expectedKty, jwks.Keys[0].Kty)
+			require.Equal(t, tcase.method, jwks.Keys[0].Alg)
+		})
+	}
+}
+
+func writePrivateKey(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "private.pem")
+
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	}), 0o600)
+	require.NoError(t, err)
+
+	return path
+}
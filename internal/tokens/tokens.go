@@ -1,56 +1,210 @@
 package tokens
 
 import (
-	"encoding/hex"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"math/rand"
+	"hash/crc32"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
 )
 
 var (
-	ErrInvalidRefreshToken = errors.New("refresh token is expired")
+	ErrInvalidRefreshToken     = errors.New("refresh token is expired")
+	ErrMalformedRefreshToken   = errors.New("refresh token is malformed")
+	ErrUnknownKeyID            = errors.New("unknown signing key id")
+	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
 )
 
 const (
 	RefreshTokenBytesLen = 32
+	RefreshTokenPrefix   = "ssort1_" // sso refresh token, format version 1
+	ClientSecretPrefix   = "ssocs1_" // sso client secret, format version 1
+	AuthCodePrefix       = "ssoac1_" // sso oauth authorization code, format version 1
+	DeviceCodePrefix     = "ssodc1_" // sso oauth device code, format version 1
+
+	opaqueTokenSeparator   = "_"
+	opaqueTokenRandomLen   = 43 // base64url of RefreshTokenBytesLen
+	opaqueTokenChecksumLen = 6  // base64url of crc32
 )
 
-func NewAccessToken(userID string,
-	appID int32,
-	ttl time.Duration,
-	secretKey string) (
+// AccessTokenParams describe an access token to issue.
+type AccessTokenParams struct {
+	UserID   string // sub, the client id of service account tokens.
+	AppID    int32
+	Issuer   string
+	TTL      time.Duration
+	Audience string // extra aud claim value next to the app id, optional.
+	Scope    string // granted oauth scopes, space separated, optional.
+	// issued with the client credentials grant, there is no user.
+	ServiceAccount bool
+	LegacyClaims   bool // also emit appID, userID and expiresAt claims for old verifiers.
+}
+
+// accessClaims are RFC 7519 registered claims plus the legacy claim names
+// issued before them.
+type accessClaims struct {
+	jwt.RegisteredClaims
+
+	Scope          string `json:"scope,omitempty"`
+	ServiceAccount bool   `json:"service_account,omitempty"` //nolint:tagliatelle
+
+	LegacyAppID     *int32 `json:"appID,omitempty"`
+	LegacyUserID    string `json:"userID,omitempty"`
+	LegacyExpiresAt int64  `json:"expiresAt,omitempty"`
+}
+
+func NewAccessToken(params AccessTokenParams, key *SigningKey) (
 	*string, error) {
-	claims := jwt.MapClaims{
-		"appID":     appID,
-		"userID":    userID,
-		"expiresAt": time.Now().Add(ttl).Unix(),
+	now := time.Now()
+
+	// the app id always comes first, verification by app relies on it.
+	audience := jwt.ClaimStrings{AppAudience(params.AppID)}
+	if params.Audience != "" && params.Audience != audience[0] {
+		audience = append(audience, params.Audience)
+	}
+
+	claims := accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    params.Issuer,
+			Subject:   params.UserID,
+			Audience:  audience,
+			ExpiresAt: jwt.NewNumericDate(now.Add(params.TTL)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.NewString(),
+		},
+		Scope:          params.Scope,
+		ServiceAccount: params.ServiceAccount,
+	}
+
+	if params.LegacyClaims {
+		claims.LegacyAppID = &params.AppID
+		claims.LegacyUserID = params.UserID
+		claims.LegacyExpiresAt = claims.ExpiresAt.Unix()
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(key.Method(), claims)
 
-	signed, err := token.SignedString([]byte(secretKey))
+	signed, err := key.sign(token)
 	if err != nil {
-		return nil, fmt.Errorf("jwt token signing failure: %w", err)
+		return nil, err
 	}
 
 	return &signed, nil
 }
 
+// AppAudience is the aud claim value of tokens issued for the app.
+func AppAudience(appID int32) string {
+	return strconv.FormatInt(int64(appID), 10)
+}
+
+// JWKS returns the public keys that verify tokens signed with the given keys.
+// Symmetric keys are skipped.
+func JWKS(keys ...*SigningKey) *entity.JSONWebKeySet {
+	set := &entity.JSONWebKeySet{
+		Keys: make([]entity.JSONWebKey, 0, len(keys)),
+	}
+
+	for _, key := range keys {
+		jwk, ok := key.JWK()
+		if ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	return set
+}
+
+// NewRefreshToken generates an opaque refresh token:
+//
+//	ssort1_<43 chars of base64url random>_<6 chars of base64url crc32>
+//
+// The prefix makes leaked tokens recognisable by secret scanners and the
+// checksum lets malformed tokens be rejected before any storage lookup.
 func NewRefreshToken() (*string, error) {
-	randBytes := make([]byte, RefreshTokenBytesLen)
+	return newOpaqueToken(RefreshTokenPrefix)
+}
 
-	src := rand.NewSource(time.Now().Unix())
-	r := rand.New(src) //nolint:gosec
+// CheckRefreshTokenFormat validates prefix, length and checksum of a refresh token.
+func CheckRefreshTokenFormat(token string) error {
+	if !isOpaqueToken(token, RefreshTokenPrefix) {
+		return ErrMalformedRefreshToken
+	}
+
+	return nil
+}
 
-	_, err := r.Read(randBytes)
+// NewClientSecret generates an app client secret in the refresh token format
+// with the ssocs1_ prefix.
+func NewClientSecret() (*string, error) {
+	return newOpaqueToken(ClientSecretPrefix)
+}
+
+// IsClientSecret validates prefix, length and checksum of a client secret.
+func IsClientSecret(secret string) bool {
+	return isOpaqueToken(secret, ClientSecretPrefix)
+}
+
+// NewAuthorizationCode generates an oauth authorization code in the refresh
+// token format with the ssoac1_ prefix.
+func NewAuthorizationCode() (*string, error) {
+	return newOpaqueToken(AuthCodePrefix)
+}
+
+// IsAuthorizationCode validates prefix, length and checksum of an authorization code.
+func IsAuthorizationCode(code string) bool {
+	return isOpaqueToken(code, AuthCodePrefix)
+}
+
+func newOpaqueToken(prefix string) (*string, error) {
+	randBytes := make([]byte, RefreshTokenBytesLen)
+
+	_, err := rand.Read(randBytes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate token: %w", err)
 	}
 
-	token := hex.EncodeToString(randBytes)
+	body := prefix + base64.RawURLEncoding.EncodeToString(randBytes)
+	token := body + opaqueTokenSeparator + opaqueTokenChecksum(body)
 
 	return &token, nil
-}
\ No newline at end of file
+}
+
+func isOpaqueToken(token, prefix string) bool {
+	bodyLen := len(prefix) + opaqueTokenRandomLen
+
+	if len(token) != bodyLen+len(opaqueTokenSeparator)+opaqueTokenChecksumLen ||
+		!strings.HasPrefix(token, prefix) {
+		return false
+	}
+
+	body, checksum := token[:bodyLen], token[bodyLen+1:]
+
+	if token[bodyLen:bodyLen+1] != opaqueTokenSeparator {
+		return false
+	}
+
+	_, err := base64.RawURLEncoding.DecodeString(body[len(prefix):])
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(checksum), []byte(opaqueTokenChecksum(body))) == 1
+}
+
+func opaqueTokenChecksum(body string) string {
+	checksum := make([]byte, crc32.Size)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE([]byte(body)))
+
+	return base64.RawURLEncoding.EncodeToString(checksum)
+}
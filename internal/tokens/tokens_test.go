@@ -2,9 +2,12 @@ package tokens_test
 
 import (
 	"log"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/aspirin100/gRPC-SSO/internal/entity"
 	"github.com/aspirin100/gRPC-SSO/internal/tokens"
 )
@@ -18,7 +21,17 @@ func TestNewAccessToken(t *testing.T) {
 		ID: 1,
 	}
 
-	token, err := tokens.NewAccessToken(user.UserID, app.ID, time.Minute*15, "secret_test_key")
+	key, err := tokens.LoadSigningKey("HS256", "", "secret_test_key")
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+
+	token, err := tokens.NewAccessToken(tokens.AccessTokenParams{
+		UserID: user.UserID,
+		AppID:  app.ID,
+		TTL:    time.Minute * 15,
+	}, key)
 	if err != nil {
 		log.Print(err)
 		t.Fail()
@@ -29,10 +42,72 @@ func TestNewAccessToken(t *testing.T) {
 
 func TestNewRefreshToken(t *testing.T) {
 	token, err := tokens.NewRefreshToken()
-	if err != nil {
-		log.Print(err)
-		t.Fail()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(*token, tokens.RefreshTokenPrefix))
+	require.NoError(t, tokens.CheckRefreshTokenFormat(*token))
+
+	// tokens generated at the same moment must differ.
+	another, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+	require.NotEqual(t, *token, *another)
+}
+
+func TestCheckRefreshTokenFormat(t *testing.T) {
+	token, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+
+	// flips one character of the random part, keeping the checksum.
+	tampered := []byte(*token)
+	tampered[len(tokens.RefreshTokenPrefix)] ^= 'a' ^ 'b'
+
+	cases := []struct {
+		testName      string
+		token         string
+		expectedError error
+	}{
+		{
+			testName: "ok case",
+			token:    *token,
+		},
+		{
+			testName:      "empty token case",
+			token:         "",
+			expectedError: tokens.ErrMalformedRefreshToken,
+		},
+		{
+			testName:      "legacy hex token case",
+			token:         "e8072fc7dfc55a232794a3b8d14e16c4e997bc5f490cd9cd57c8d4e8ff194554",
+			expectedError: tokens.ErrMalformedRefreshToken,
+		},
+		{
+			testName:      "wrong prefix case",
+			token:         "xxxxx1_" + (*token)[len(tokens.RefreshTokenPrefix):],
+			expectedError: tokens.ErrMalformedRefreshToken,
+		},
+		{
+			testName:      "wrong checksum case",
+			token:         string(tampered),
+			expectedError: tokens.ErrMalformedRefreshToken,
+		},
 	}
 
-	log.Print(len(*token))
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			require.ErrorIs(t, tokens.CheckRefreshTokenFormat(tcase.token), tcase.expectedError)
+		})
+	}
+}
+
+func TestNewClientSecret(t *testing.T) {
+	secret, err := tokens.NewClientSecret()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(*secret, tokens.ClientSecretPrefix))
+	require.True(t, tokens.IsClientSecret(*secret))
+
+	// refresh tokens and client secrets are never mistaken for each other.
+	require.ErrorIs(t, tokens.CheckRefreshTokenFormat(*secret), tokens.ErrMalformedRefreshToken)
+
+	refreshToken, err := tokens.NewRefreshToken()
+	require.NoError(t, err)
+	require.False(t, tokens.IsClientSecret(*refreshToken))
 }
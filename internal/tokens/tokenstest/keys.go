@@ -0,0 +1,67 @@
+// Package tokenstest provides signing keys for tests.
+package tokenstest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+)
+
+const (
+	hmacKeyBytesLen = 32
+	rsaKeyBitsLen   = 2048
+)
+
+// GenerateSigningKey creates a fresh random key for the given method.
+func GenerateSigningKey(method jwt.SigningMethod) (*tokens.SigningKey, error) {
+	var (
+		privateKey crypto.Signer
+		err        error
+	)
+
+	switch method := method.(type) {
+	case *jwt.SigningMethodHMAC:
+		secret := make([]byte, hmacKeyBytesLen)
+
+		_, err = rand.Read(secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate secret: %w", err)
+		}
+
+		return tokens.LoadSigningKey(method.Alg(), "", base64.RawURLEncoding.EncodeToString(secret)) //nolint:wrapcheck
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		privateKey, err = rsa.GenerateKey(rand.Reader, rsaKeyBitsLen)
+	case *jwt.SigningMethodECDSA:
+		privateKey, err = ecdsa.GenerateKey(curveByBits(method.CurveBits), rand.Reader)
+	case *jwt.SigningMethodEd25519:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %q", tokens.ErrUnsupportedSigningMethod, method.Alg())
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+
+	return tokens.NewSigningKey(method, privateKey) //nolint:wrapcheck
+}
+
+func curveByBits(bits int) elliptic.Curve {
+	switch bits {
+	case elliptic.P384().Params().BitSize:
+		return elliptic.P384()
+	case elliptic.P521().Params().BitSize:
+		return elliptic.P521()
+	default:
+		return elliptic.P256()
+	}
+}
@@ -0,0 +1,113 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/aspirin100/gRPC-SSO/internal/entity"
+)
+
+var (
+	ErrTokenMalformed        = errors.New("access token is malformed")
+	ErrTokenSignatureInvalid = errors.New("access token signature is invalid")
+	ErrTokenExpired          = errors.New("access token is expired")
+	ErrTokenAppMismatch      = errors.New("access token is issued for another app")
+	ErrTokenInvalidClaims    = errors.New("access token claims are invalid")
+)
+
+// VerifyAccessToken checks the signature, registered claims and app binding
+// of an access token and returns its claims.
+func VerifyAccessToken(accessToken string,
+	keyRing *KeyRing,
+	issuer string,
+	appID int32) (*entity.TokenClaims, error) {
+	claims := &accessClaims{}
+
+	_, err := jwt.ParseWithClaims(accessToken, claims, keyRing.Keyfunc,
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(AppAudience(appID)),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt())
+	if err != nil {
+		switch {
+		case errors.Is(err, jwt.ErrTokenMalformed):
+			return nil, fmt.Errorf("%w: %w", ErrTokenMalformed, err)
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return nil, ErrTokenExpired
+		case errors.Is(err, jwt.ErrTokenInvalidAudience):
+			return nil, ErrTokenAppMismatch
+		case errors.Is(err, jwt.ErrTokenInvalidClaims):
+			return nil, fmt.Errorf("%w: %w", ErrTokenInvalidClaims, err)
+		default:
+			return nil, fmt.Errorf("%w: %w", ErrTokenSignatureInvalid, err)
+		}
+	}
+
+	// any aud value matches above, an extra audience equal to another app's
+	// id must not pass the token as that app's.
+	if claims.Audience[0] != AppAudience(appID) {
+		return nil, ErrTokenAppMismatch
+	}
+
+	if claims.Subject == "" || claims.ID == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: sub, jti and iat are required", ErrTokenInvalidClaims)
+	}
+
+	return &entity.TokenClaims{
+		ID:        claims.ID,
+		UserID:    claims.Subject,
+		AppID:     appID,
+		Scope:     claims.Scope,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+
+		IsServiceAccount: claims.ServiceAccount,
+	}, nil
+}
+
+// InspectAccessToken checks the signature and issuer of an access token issued
+// for any app and returns its claims. Expiry is not enforced, so callers must
+// check ExpiresAt themselves.
+func InspectAccessToken(accessToken string,
+	keyRing *KeyRing,
+	issuer string) (*entity.TokenClaims, error) {
+	claims := &accessClaims{}
+
+	_, err := jwt.ParseWithClaims(accessToken, claims, keyRing.Keyfunc,
+		jwt.WithoutClaimsValidation())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenMalformed) {
+			return nil, fmt.Errorf("%w: %w", ErrTokenMalformed, err)
+		}
+
+		return nil, fmt.Errorf("%w: %w", ErrTokenSignatureInvalid, err)
+	}
+
+	if claims.Issuer != issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrTokenInvalidClaims, claims.Issuer)
+	}
+
+	if claims.Subject == "" || claims.ID == "" ||
+		claims.IssuedAt == nil || claims.ExpiresAt == nil || len(claims.Audience) == 0 {
+		return nil, fmt.Errorf("%w: sub, jti, iat, exp and aud are required", ErrTokenInvalidClaims)
+	}
+
+	appID, err := strconv.ParseInt(claims.Audience[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: aud is not an app id", ErrTokenInvalidClaims)
+	}
+
+	return &entity.TokenClaims{
+		ID:        claims.ID,
+		UserID:    claims.Subject,
+		AppID:     int32(appID),
+		Scope:     claims.Scope,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+
+		IsServiceAccount: claims.ServiceAccount,
+	}, nil
+}
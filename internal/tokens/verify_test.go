@@ -0,0 +1,262 @@
+package tokens_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aspirin100/gRPC-SSO/internal/tokens"
+	"github.com/aspirin100/gRPC-SSO/internal/tokens/tokenstest"
+)
+
+func TestVerifyAccessToken(t *testing.T) {
+	const (
+		userID = "test user id"
+		appID  = 1
+		issuer = "test issuer"
+	)
+
+	key, err := tokenstest.GenerateSigningKey(jwt.SigningMethodRS256)
+	require.NoError(t, err)
+
+	foreignKey, err := tokenstest.GenerateSigningKey(jwt.SigningMethodRS256)
+	require.NoError(t, err)
+
+	ring := tokens.NewKeyRing(key, time.Minute)
+
+	cases := []struct {
+		testName      string
+		ttl           time.Duration
+		key           *tokens.SigningKey
+		issuer        string
+		appID         int32
+		token         string
+		expectedError error
+	}{
+		{
+			testName: "ok case",
+			ttl:      time.Minute,
+			key:      key,
+			issuer:   issuer,
+			appID:    appID,
+		},
+		{
+			testName:      "expired token case",
+			ttl:           -time.Minute,
+			key:           key,
+			issuer:        issuer,
+			appID:         appID,
+			expectedError: tokens.ErrTokenExpired,
+		},
+		{
+			testName:      "app mismatch case",
+			ttl:           time.Minute,
+			key:           key,
+			issuer:        issuer,
+			appID:         appID + 1,
+			expectedError: tokens.ErrTokenAppMismatch,
+		},
+		{
+			testName:      "foreign issuer case",
+			ttl:           time.Minute,
+			key:           key,
+			issuer:        "foreign issuer",
+			appID:         appID,
+			expectedError: tokens.ErrTokenInvalidClaims,
+		},
+		{
+			testName:      "unknown key case",
+			ttl:           time.Minute,
+			key:           foreignKey,
+			issuer:        issuer,
+			appID:         appID,
+			expectedError: tokens.ErrTokenSignatureInvalid,
+		},
+		{
+			testName:      "malformed token case",
+			appID:         appID,
+			token:         "not.a.jwt",
+			expectedError: tokens.ErrTokenMalformed,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			token := tcase.token
+
+			if token == "" {
+				signed, err := tokens.NewAccessToken(tokens.AccessTokenParams{
+					UserID: userID,
+					AppID:  appID,
+					Issuer: tcase.issuer,
+					TTL:    tcase.ttl,
+				}, tcase.key)
+				require.NoError(t, err)
+
+				token = *signed
+			}
+
+			claims, err := tokens.VerifyAccessToken(token, ring, issuer, tcase.appID)
+			require.ErrorIs(t, err, tcase.expectedError)
+
+			if tcase.expectedError != nil {
+				return
+			}
+
+			require.NotEmpty(t, claims.ID)
+			require.Equal(t, userID, claims.UserID)
+			require.EqualValues(t, appID, claims.AppID)
+			require.WithinDuration(t, time.Now().Add(tcase.ttl), claims.ExpiresAt, time.Second)
+		})
+	}
+}
+
+func TestAccessTokenClaims(t *testing.T) {
+	key, err := tokens.NewSecretKey("secret_test_key")
+	require.NoError(t, err)
+
+	cases := []struct {
+		testName     string
+		legacyClaims bool
+	}{
+		{
+			testName: "registered claims case",
+		},
+		{
+			testName:     "legacy claims case",
+			legacyClaims: true,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			params := testTokenParams
+			params.LegacyClaims = tcase.legacyClaims
+
+			token, err := tokens.NewAccessToken(params, key)
+			require.NoError(t, err)
+
+			claims := jwt.MapClaims{}
+
+			_, err = jwt.ParseWithClaims(*token, claims, func(*jwt.Token) (any, error) {
+				return key.PublicKey(), nil
+			})
+			require.NoError(t, err)
+
+			for _, claim := range []string{"sub", "aud", "iss", "exp", "iat", "nbf", "jti"} {
+				require.Contains(t, claims, claim)
+			}
+
+			require.Equal(t, params.UserID, claims["sub"])
+			require.Equal(t, params.Issuer, claims["iss"])
+
+			for _, claim := range []string{"appID", "userID", "expiresAt"} {
+				_, ok := claims[claim]
+				require.Equal(t, tcase.legacyClaims, ok, claim)
+			}
+		})
+	}
+}
+
+func TestInspectAccessToken(t *testing.T) {
+	key, err := tokens.NewSecretKey("secret_test_key")
+	require.NoError(t, err)
+
+	ring := tokens.NewKeyRing(key, time.Minute)
+
+	expiredParams := testTokenParams
+	expiredParams.TTL = -time.Minute
+
+	foreignParams := testTokenParams
+	foreignParams.Issuer = "foreign issuer"
+
+	cases := []struct {
+		testName      string
+		params        tokens.AccessTokenParams
+		expectedError error
+	}{
+		{
+			testName: "ok case",
+			params:   testTokenParams,
+		},
+		{
+			testName: "expired token case",
+			params:   expiredParams,
+		},
+		{
+			testName:      "foreign issuer case",
+			params:        foreignParams,
+			expectedError: tokens.ErrTokenInvalidClaims,
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.testName, func(t *testing.T) {
+			token, err := tokens.NewAccessToken(tcase.params, key)
+			require.NoError(t, err)
+
+			claims, err := tokens.InspectAccessToken(*token, ring, testTokenParams.Issuer)
+			require.ErrorIs(t, err, tcase.expectedError)
+
+			if tcase.expectedError != nil {
+				return
+			}
+
+			require.NotEmpty(t, claims.ID)
+			require.Equal(t, tcase.params.UserID, claims.UserID)
+			require.Equal(t, tcase.params.AppID, claims.AppID)
+			require.WithinDuration(t, time.Now().Add(tcase.params.TTL), claims.ExpiresAt, time.Second)
+		})
+	}
+}
+
+func TestAccessTokenAudience(t *testing.T) {
+	key, err := tokens.NewSecretKey("secret_test_key")
+	require.NoError(t, err)
+
+	ring := tokens.NewKeyRing(key, time.Minute)
+
+	params := testTokenParams
+	params.Audience = "console-api"
+
+	token, err := tokens.NewAccessToken(params, key)
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+
+	_, err = jwt.ParseWithClaims(*token, claims, func(*jwt.Token) (any, error) {
+		return key.PublicKey(), nil
+	}, jwt.WithAudience(params.Audience))
+	require.NoError(t, err)
+
+	// verification by app still works next to the extra audience.
+	verified, err := tokens.VerifyAccessToken(*token, ring, params.Issuer, params.AppID)
+	require.NoError(t, err)
+	require.Equal(t, params.AppID, verified.AppID)
+
+	inspected, err := tokens.InspectAccessToken(*token, ring, params.Issuer)
+	require.NoError(t, err)
+	require.Equal(t, params.AppID, inspected.AppID)
+}
+
+func TestAccessTokenAppIDAudience(t *testing.T) {
+	key, err := tokens.NewSecretKey("secret_test_key")
+	require.NoError(t, err)
+
+	ring := tokens.NewKeyRing(key, time.Minute)
+
+	// an extra audience shaped like the id of another app.
+	params := testTokenParams
+	params.Audience = tokens.AppAudience(params.AppID + 1)
+
+	token, err := tokens.NewAccessToken(params, key)
+	require.NoError(t, err)
+
+	_, err = tokens.VerifyAccessToken(*token, ring, params.Issuer, params.AppID+1)
+	require.ErrorIs(t, err, tokens.ErrTokenAppMismatch)
+
+	_, err = tokens.VerifyAccessToken(*token, ring, params.Issuer, params.AppID)
+	require.NoError(t, err)
+}
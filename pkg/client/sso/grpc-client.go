@@ -18,6 +18,18 @@ type Client struct {
 	api ssov1.AuthClient
 }
 
+// Claims are the claims of an access token verified by the sso service.
+type Claims struct {
+	UserID    uuid.UUID // zero for service account tokens
+	AppID     int32
+	IsAdmin   bool
+	ExpiresAt time.Time
+
+	// service account tokens are issued to an app acting on its own behalf.
+	IsServiceAccount bool
+	ClientID         string // client id of the app, service account tokens only
+}
+
 func New(
 	ctx context.Context,
 	addr string,
@@ -60,3 +72,37 @@ func (cl *Client) IsAdmin(ctx context.Context, userID uuid.UUID) (*bool, error)
 
 	return &isAdmin.IsAdmin, nil
 }
+
+// ValidateToken asks the sso service to verify an access token issued for appID.
+func (cl *Client) ValidateToken(ctx context.Context, accessToken string, appID int32) (*Claims, error) {
+	const op = "grpclient.ValidateToken"
+
+	resp, err := cl.api.ValidateToken(ctx, &ssov1.ValidateTokenRequest{
+		AccessToken: accessToken,
+		AppID:       appID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	claims := &Claims{
+		AppID:     resp.GetAppID(),
+		IsAdmin:   resp.GetIsAdmin(),
+		ExpiresAt: time.Unix(resp.GetExpiresAt(), 0),
+
+		IsServiceAccount: resp.GetIsServiceAccount(),
+	}
+
+	if claims.IsServiceAccount {
+		claims.ClientID = resp.GetUserID()
+
+		return claims, nil
+	}
+
+	claims.UserID, err = uuid.Parse(resp.GetUserID())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return claims, nil
+}
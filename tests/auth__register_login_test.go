@@ -2,6 +2,7 @@ package auth_test
 
 import (
 	"log"
+	"strconv"
 	"testing"
 
 	"github.com/brianvoe/gofakeit/v7"
@@ -54,8 +55,15 @@ func TestRegisterLogin(t *testing.T) {
 		})
 	require.NoError(t, err)
 
-	require.EqualValues(t, appID, int(claims["appID"].(float64)))                  //nolint:forcetypeassert
-	require.EqualValues(t, registerReponse.GetUserID(), claims["userID"].(string)) //nolint:forcetypeassert
+	audience, err := claims.GetAudience()
+	require.NoError(t, err)
+
+	subject, err := claims.GetSubject()
+	require.NoError(t, err)
+
+	require.EqualValues(t, []string{strconv.Itoa(appID)}, audience)
+	require.EqualValues(t, registerReponse.GetUserID(), subject)
+	require.Contains(t, claims, "jti")
 }
 
 func generatePassword(length int) string {